@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fileSettings holds the settings read from CONFIG_FILE, keyed by environment
+// variable name. Environment variables take precedence over them.
+var fileSettings map[string]string
+
+// loadConfigFiles reads the JSON files listed in CONFIG_FILE (comma-separated,
+// e.g. "config/base.json,config/production.json"), later files overriding
+// earlier ones. Each file is an object keyed by environment variable name;
+// lists and maps may be given as JSON arrays and objects.
+func loadConfigFiles() error {
+	settings := make(map[string]string)
+	for _, path := range strings.Split(os.Getenv("CONFIG_FILE"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CONFIG_FILE %s: %w", path, err)
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("failed to parse CONFIG_FILE %s: %w", path, err)
+		}
+		for key, value := range values {
+			setting, err := settingString(value)
+			if err != nil {
+				return fmt.Errorf("CONFIG_FILE %s: %s %w", path, key, err)
+			}
+			settings[key] = setting
+		}
+	}
+
+	fileSettings = settings
+	return nil
+}
+
+// settingString converts a config file value to its environment variable form
+func settingString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, object := item.(map[string]interface{}); object {
+				// Arrays of objects (e.g. OUTBOUND_WEBHOOKS) are read as JSON
+				data, _ := json.Marshal(v)
+				return string(data), nil
+			}
+			s, err := settingString(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		for _, item := range v {
+			if _, nested := item.(map[string]interface{}); nested {
+				// Objects of objects (e.g. NOTIFICATION_PROFILES) are read as JSON
+				data, _ := json.Marshal(v)
+				return string(data), nil
+			}
+		}
+		pairs := make([]string, 0, len(v))
+		for name, item := range v {
+			s, err := settingString(item)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, name+"="+s)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	}
+	return "", fmt.Errorf("has an unsupported value %v", value)
+}
+
+// lookupSetting returns the environment variable key, falling back to CONFIG_FILE
+func lookupSetting(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileSettings[key]
+}
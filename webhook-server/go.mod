@@ -2,10 +2,15 @@ module mdtalkman-webhook
 
 go 1.21
 
-require github.com/sideshow/apns2 v0.25.0
+require (
+	github.com/alicebob/miniredis/v2 v2.31.1
+	github.com/sideshow/apns2 v0.25.0
+)
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/golang-jwt/jwt/v4 v4.4.1 // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
 	golang.org/x/crypto v0.0.0-20170512130425-ab89591268e0 // indirect
 	golang.org/x/net v0.0.0-20220403103023-749bd193bc2b // indirect
 	golang.org/x/text v0.3.7 // indirect
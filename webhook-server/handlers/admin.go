@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mdtalkman-webhook/models"
+	"mdtalkman-webhook/services"
+)
+
+// AdminHandler provides operator endpoints protected by the admin token
+type AdminHandler struct {
+	githubService  *services.GitHubService
+	apnsService    *services.APNsService
+	webhookHandler *WebhookHandler
+	deviceStore    services.DeviceStore
+	isDevelopment  bool
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(githubService *services.GitHubService, apnsService *services.APNsService, webhookHandler *WebhookHandler, deviceStore services.DeviceStore, isDevelopment bool) *AdminHandler {
+	return &AdminHandler{
+		githubService:  githubService,
+		apnsService:    apnsService,
+		webhookHandler: webhookHandler,
+		deviceStore:    deviceStore,
+		isDevelopment:  isDevelopment,
+	}
+}
+
+// VerifySignature reports whether the request body would pass webhook signature
+// verification with the X-Hub-Signature-256 header sent alongside it
+func (a *AdminHandler) VerifySignature(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+	defer req.Body.Close()
+
+	signature := req.Header.Get("X-Hub-Signature-256")
+	verifyErr := a.githubService.VerifyWebhookSignatureE(body, signature)
+
+	response := struct {
+		Valid             bool   `json:"valid"`
+		Reason            string `json:"reason,omitempty"` // why the signature was rejected
+		ReceivedSignature string `json:"received_signature"`
+		ExpectedSignature string `json:"expected_signature,omitempty"`
+		BodyLength        int    `json:"body_length"`
+	}{
+		Valid:             verifyErr == nil,
+		ReceivedSignature: signature,
+		BodyLength:        len(body),
+	}
+	if verifyErr != nil {
+		response.Reason = verifyErr.Error()
+	}
+
+	// Only reveal the expected value in development, where it can't be used as a signing oracle
+	if a.isDevelopment {
+		response.ExpectedSignature = a.githubService.ExpectedSignature(body)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// PreviewNotification renders the APNs payload for either a processed event
+// ({"event": {...}}) or a raw GitHub payload ({"event_type": "push", "payload": {...}})
+// without sending anything
+func (a *AdminHandler) PreviewNotification(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestBody struct {
+		Event          *models.WebhookEvent `json:"event"`
+		EventType      string               `json:"event_type"`
+		Payload        json.RawMessage      `json:"payload"`
+		PayloadVersion int                  `json:"payload_version"` // the device's; 0 renders the legacy shape
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	event := requestBody.Event
+	if len(requestBody.Payload) > 0 && string(requestBody.Payload) != "null" {
+		payload, err := services.DecodePayload(requestBody.Payload)
+		if err != nil {
+			http.Error(rw, "Bad request", http.StatusBadRequest)
+			return
+		}
+		event = a.githubService.ProcessWebhookEvent(req.Context(), payload, requestBody.EventType)
+	}
+	if event == nil {
+		http.Error(rw, "Either event or event_type and payload required", http.StatusBadRequest)
+		return
+	}
+
+	response := struct {
+		Event       *models.WebhookEvent `json:"event"`
+		WouldNotify bool                 `json:"would_notify"`
+		Topic       string               `json:"topic"`
+		APNsPayload json.RawMessage      `json:"apns_payload"`
+	}{
+		Event:       event,
+		WouldNotify: a.githubService.ShouldNotifyApp(event),
+		Topic:       a.apnsService.Topic(models.Device{}, event.EventType),
+		APNsPayload: a.apnsService.RenderPayload(event, requestBody.PayloadVersion),
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// SetNotifications turns push notifications on or off ({"enabled": false}) without
+// a restart. The next SIGHUP reload resets the flag to NOTIFICATIONS_ENABLED.
+func (a *AdminHandler) SetNotifications(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestBody struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil || requestBody.Enabled == nil {
+		http.Error(rw, "enabled (true or false) required", http.StatusBadRequest)
+		return
+	}
+
+	a.webhookHandler.SetNotificationsEnabled(*requestBody.Enabled)
+	log.Printf("🔔 Notifications %s via admin endpoint", map[bool]string{true: "enabled", false: "disabled"}[*requestBody.Enabled])
+
+	response := struct {
+		Enabled bool `json:"enabled"`
+	}{
+		Enabled: a.webhookHandler.NotificationsEnabled(),
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// Page sizes for the admin device listing
+const (
+	defaultDevicePageSize = 100
+	maxDevicePageSize     = 1000
+)
+
+// ListDevices returns one page of registered devices (GET /admin/devices?limit=100&cursor=...)
+// with masked tokens. next_cursor is set while more devices remain.
+func (a *AdminHandler) ListDevices(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultDevicePageSize
+	if value := req.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(rw, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxDevicePageSize)
+	}
+
+	offset := 0
+	if cursor := req.URL.Query().Get("cursor"); cursor != "" {
+		parsed, err := strconv.Atoi(cursor)
+		if err != nil || parsed < 0 {
+			http.Error(rw, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	devices, total, err := a.deviceStore.ListPage(offset, limit)
+	if err != nil {
+		log.Printf("Error listing devices: %v", err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range devices {
+		devices[i].Token = services.MaskToken(devices[i].Token)
+	}
+
+	response := struct {
+		Devices    []models.Device `json:"devices"`
+		Total      int             `json:"total"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}{
+		Devices: devices,
+		Total:   total,
+	}
+	if next := offset + len(devices); next < total {
+		response.NextCursor = strconv.Itoa(next)
+	}
+
+	writeJSONWithETag(rw, req, response)
+}
+
+// UnsubscribeRepository removes a repository from every device's subscriptions,
+// e.g. after it was deleted or access to it was revoked. A device's last
+// subscription (with no organizations either) can't be dropped on its own,
+// since no subscriptions means every repository: such devices are unregistered when "delete_empty_devices" is set
+// and otherwise left as they are.
+func (a *AdminHandler) UnsubscribeRepository(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestBody struct {
+		Repository         string `json:"repository"`
+		DeleteEmptyDevices bool   `json:"delete_empty_devices"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+	repository := strings.TrimSpace(requestBody.Repository)
+	if repository == "" {
+		http.Error(rw, "Repository required", http.StatusBadRequest)
+		return
+	}
+
+	devices, err := a.deviceStore.List()
+	if err != nil {
+		log.Printf("Error listing devices: %v", err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Repository   string `json:"repository"`
+		Unsubscribed int    `json:"unsubscribed"`
+		Removed      int    `json:"removed"`
+		Kept         int    `json:"kept"` // only subscribed to repository, left registered
+	}{Repository: repository}
+
+	for _, listed := range devices {
+		if _, subscribed := services.Unsubscribe(listed, repository); !subscribed {
+			continue
+		}
+
+		// Decide on the device as stored now, so a registration since the List
+		// isn't overwritten with the listed subscriptions
+		var unsubscribed, removed, kept bool
+		_, err := a.deviceStore.Update(listed.Token, func(device *models.Device) bool {
+			remaining, subscribed := services.Unsubscribe(*device, repository)
+			switch {
+			case !subscribed:
+			case len(remaining) > 0 || len(device.Organizations) > 0:
+				device.Repositories = remaining
+				unsubscribed = true
+			case requestBody.DeleteEmptyDevices:
+				removed = true
+			default:
+				kept = true
+			}
+			return removed
+		})
+		if err != nil {
+			log.Printf("Error unsubscribing device %s from %s: %v", services.MaskToken(listed.Token), repository, err)
+			http.Error(rw, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if unsubscribed {
+			response.Unsubscribed++
+		} else if removed {
+			response.Removed++
+		} else if kept {
+			response.Kept++
+		}
+	}
+
+	log.Printf("🧹 Unsubscribed devices from %s: %d updated, %d removed, %d kept",
+		repository, response.Unsubscribed, response.Removed, response.Kept)
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// Stats reports percentiles of recent webhook processing times (the last 1024
+// deliveries), for operators without a metrics system
+func (a *AdminHandler) Stats(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := struct {
+		WebhookLatency services.LatencyPercentiles `json:"webhook_latency"`
+	}{
+		WebhookLatency: a.webhookHandler.Latency().Percentiles(),
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// RepoStats lists how many notifications each repository's events have sent
+// since startup, most first, to spot noisy repositories
+func (a *AdminHandler) RepoStats(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := struct {
+		Repositories []services.RepoStat `json:"repositories"`
+	}{
+		Repositories: a.webhookHandler.RepoStats().Snapshot(),
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// deviceExport is the backup format of /admin/export and /admin/import
+type deviceExport struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	Masked     bool            `json:"masked"` // tokens are masked; such exports can't be imported
+	Devices    []models.Device `json:"devices"`
+}
+
+// ExportDevices returns every registered device with its subscriptions and
+// settings, for backup or migration. Tokens are masked unless "?tokens=full".
+func (a *AdminHandler) ExportDevices(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	devices, err := a.deviceStore.List()
+	if err != nil {
+		log.Printf("Error listing devices: %v", err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	export := deviceExport{
+		ExportedAt: time.Now().UTC(),
+		Masked:     req.URL.Query().Get("tokens") != "full",
+		Devices:    devices,
+	}
+	if export.Masked {
+		for i := range export.Devices {
+			export.Devices[i].Token = services.MaskToken(export.Devices[i].Token)
+		}
+	}
+	log.Printf("📦 Exported %d devices (masked tokens: %t)", len(devices), export.Masked)
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(export)
+}
+
+// ImportDevices restores devices from an export made with "?tokens=full".
+// Devices are upserted by token, so importing the same export again changes nothing.
+// Each device is validated like a registration; invalid ones are reported, not imported.
+func (a *AdminHandler) ImportDevices(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var export deviceExport
+	if err := json.NewDecoder(req.Body).Decode(&export); err != nil {
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if export.Masked {
+		http.Error(rw, "Export has masked tokens; export with ?tokens=full to import", http.StatusBadRequest)
+		return
+	}
+
+	type rejectedDevice struct {
+		Token  string `json:"token"` // masked
+		Reason string `json:"reason"`
+	}
+	response := struct {
+		Created  int              `json:"created"`
+		Updated  int              `json:"updated"`
+		Skipped  int              `json:"skipped"` // devices without a usable token
+		Rejected []rejectedDevice `json:"rejected"`
+	}{Rejected: []rejectedDevice{}}
+	for _, device := range export.Devices {
+		if device.Token == "" || strings.Contains(device.Token, "...") || device.Token == "***" {
+			response.Skipped++
+			continue
+		}
+		if err := validateDevice(&device); err != nil {
+			log.Printf("Rejecting imported device %s: %v", services.MaskToken(device.Token), err)
+			response.Rejected = append(response.Rejected, rejectedDevice{Token: services.MaskToken(device.Token), Reason: err.Error()})
+			continue
+		}
+		created, err := a.deviceStore.Upsert(device)
+		if err != nil {
+			log.Printf("Error importing device %s: %v", services.MaskToken(device.Token), err)
+			http.Error(rw, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if created {
+			response.Created++
+		} else {
+			response.Updated++
+		}
+	}
+	log.Printf("📦 Imported devices: %d created, %d updated, %d skipped, %d rejected",
+		response.Created, response.Updated, response.Skipped, len(response.Rejected))
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/models"
+	"mdtalkman-webhook/services"
+)
+
+// importDevices posts an export to the import endpoint and returns the response
+func importDevices(t *testing.T, a *AdminHandler, export []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	a.ImportDevices(rec, httptest.NewRequest(http.MethodPost, "/admin/import", bytes.NewReader(export)))
+	return rec
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	registeredAt := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	devices := []models.Device{
+		{
+			Token:          "0123456789abcdef0123456789abcdef",
+			Platform:       services.PlatformIOS,
+			Repositories:   []string{"octocat/docs"},
+			IncludeAuthors: []string{"octocat"},
+			Paths:          []string{"docs/**/*.md"},
+			QuietHours:     &models.QuietHours{Start: "22:00", End: "07:00", TimeZone: "Europe/Berlin"},
+			Schedule:       &models.DeliverySchedule{Times: []string{"09:00", "17:00"}, TimeZone: "UTC"},
+			Canary:         true,
+			PayloadVersion: services.PayloadVersionEnriched,
+			RegisteredAt:   registeredAt,
+		},
+		{
+			Token:         "android-device-token-0001",
+			Platform:      services.PlatformAndroid,
+			Organizations: []string{"octo-org"},
+			RegisteredAt:  registeredAt,
+		},
+	}
+	source := services.NewMemoryDeviceStore()
+	for _, device := range devices {
+		if _, err := source.Upsert(device); err != nil {
+			t.Fatalf("registering device: %v", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	NewAdminHandler(nil, nil, nil, source, false).ExportDevices(rec, httptest.NewRequest(http.MethodGet, "/admin/export?tokens=full", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	target := services.NewMemoryDeviceStore()
+	admin := NewAdminHandler(nil, nil, nil, target, false)
+	for _, wantCreated := range []int{2, 0} {
+		imported := importDevices(t, admin, rec.Body.Bytes())
+		if imported.Code != http.StatusOK {
+			t.Fatalf("import status = %d, want %d: %s", imported.Code, http.StatusOK, imported.Body)
+		}
+		var result struct {
+			Created  int               `json:"created"`
+			Updated  int               `json:"updated"`
+			Rejected []json.RawMessage `json:"rejected"`
+		}
+		if err := json.Unmarshal(imported.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decoding import response: %v", err)
+		}
+		if result.Created != wantCreated || result.Created+result.Updated != len(devices) || len(result.Rejected) != 0 {
+			t.Errorf("import response = %s, want %d created of %d and none rejected", imported.Body, wantCreated, len(devices))
+		}
+	}
+
+	want, _ := source.List()
+	got, err := target.List()
+	if err != nil {
+		t.Fatalf("listing imported devices: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imported devices = %+v, want %+v", got, want)
+	}
+}
+
+func TestImportDevicesRejectsInvalidDevices(t *testing.T) {
+	valid := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+	invalid := map[string]models.Device{
+		"platform":        {Token: "invalid-platform-token-01", Platform: "windows"},
+		"topic suffix":    {Token: "invalid-topic-token-0002", TopicSuffix: "evil"},
+		"quiet hours":     {Token: "invalid-quiet-token-0003", QuietHours: &models.QuietHours{Start: "25:00", End: "07:00"}},
+		"schedule":        {Token: "invalid-sched-token-0004", Schedule: &models.DeliverySchedule{Times: []string{"noon"}}},
+		"token format":    {Token: "invalid token with spaces"},
+		"payload version": {Token: "invalid-payload-token-05", PayloadVersion: 99},
+	}
+
+	export := deviceExport{Devices: []models.Device{valid}}
+	for _, device := range invalid {
+		export.Devices = append(export.Devices, device)
+	}
+	body, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("encoding export: %v", err)
+	}
+
+	store := services.NewMemoryDeviceStore()
+	rec := importDevices(t, NewAdminHandler(nil, nil, nil, store, false), body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var result struct {
+		Created  int `json:"created"`
+		Rejected []struct {
+			Token  string `json:"token"`
+			Reason string `json:"reason"`
+		} `json:"rejected"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decoding import response: %v", err)
+	}
+	if result.Created != 1 {
+		t.Errorf("created = %d, want 1", result.Created)
+	}
+	if len(result.Rejected) != len(invalid) {
+		t.Errorf("rejected %d devices, want %d: %s", len(result.Rejected), len(invalid), rec.Body)
+	}
+	for _, rejected := range result.Rejected {
+		if rejected.Reason == "" {
+			t.Errorf("device %s was rejected without a reason", rejected.Token)
+		}
+	}
+
+	devices, _ := store.List()
+	if len(devices) != 1 || devices[0].Token != valid.Token {
+		t.Errorf("stored devices = %+v, want only the valid one", devices)
+	}
+}
+
+// registeringStore is an in-memory device store that runs register right after
+// the first List, like a registration racing an admin operation
+type registeringStore struct {
+	*services.MemoryDeviceStore
+	register func(store *services.MemoryDeviceStore)
+}
+
+func (s *registeringStore) List() ([]models.Device, error) {
+	devices, err := s.MemoryDeviceStore.List()
+	if s.register != nil {
+		s.register(s.MemoryDeviceStore)
+		s.register = nil
+	}
+	return devices, err
+}
+
+// unsubscribe posts an unsubscribe request to the admin handler and returns the response
+func unsubscribe(t *testing.T, a *AdminHandler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	a.UnsubscribeRepository(rec, httptest.NewRequest(http.MethodPost, "/admin/unsubscribe", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unsubscribe status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	return rec
+}
+
+func TestUnsubscribeRepositoryKeepsConcurrentRegistration(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+	store := &registeringStore{MemoryDeviceStore: services.NewMemoryDeviceStore()}
+	store.Upsert(models.Device{Token: token, Repositories: []string{"octocat/old", "octocat/docs"}})
+	store.register = func(s *services.MemoryDeviceStore) {
+		s.Upsert(models.Device{Token: token, Repositories: []string{"octocat/old", "octocat/docs", "octocat/blog"}, Canary: true})
+	}
+
+	unsubscribe(t, NewAdminHandler(nil, nil, nil, store, false), `{"repository": "octocat/old"}`)
+
+	devices, _ := store.MemoryDeviceStore.List()
+	if len(devices) != 1 {
+		t.Fatalf("devices = %+v, want one", devices)
+	}
+	want := []string{"octocat/docs", "octocat/blog"}
+	if !reflect.DeepEqual(devices[0].Repositories, want) || !devices[0].Canary {
+		t.Errorf("device = %+v, want the new registration with repositories %v", devices[0], want)
+	}
+}
+
+func TestUnsubscribeRepository(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantCounts  string
+		wantDevices int
+	}{
+		{
+			name:        "keeps devices left without subscriptions",
+			body:        `{"repository": "OctoCat/Old"}`,
+			wantCounts:  `"unsubscribed":1,"removed":0,"kept":1`,
+			wantDevices: 3,
+		},
+		{
+			name:        "removes devices left without subscriptions",
+			body:        `{"repository": "octocat/old", "delete_empty_devices": true}`,
+			wantCounts:  `"unsubscribed":1,"removed":1,"kept":0`,
+			wantDevices: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := services.NewMemoryDeviceStore()
+			store.Upsert(models.Device{Token: "several-repositories-0001", Repositories: []string{"octocat/old", "octocat/docs"}})
+			store.Upsert(models.Device{Token: "only-old-repository-00002", Repositories: []string{"octocat/old"}})
+			store.Upsert(models.Device{Token: "unrelated-repository-0003", Repositories: []string{"octocat/blog"}})
+
+			rec := unsubscribe(t, NewAdminHandler(nil, nil, nil, store, false), tt.body)
+			if !strings.Contains(rec.Body.String(), tt.wantCounts) {
+				t.Errorf("response = %s, want %s", rec.Body, tt.wantCounts)
+			}
+			if count, _ := store.Count(); count != tt.wantDevices {
+				t.Errorf("devices = %d, want %d", count, tt.wantDevices)
+			}
+		})
+	}
+}
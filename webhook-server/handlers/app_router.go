@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps a handler, e.g. to check headers before calling it
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// AppRouter serves several logical apps from one process under
+// /app/{id}/webhook/..., each with its own webhook handler (and so its own
+// secret, device store and APNs service)
+type AppRouter struct {
+	webhook      Middleware // wraps each app's webhook/github
+	registration Middleware // wraps each app's webhook/register and webhook/unregister
+	apps         map[string]map[string]http.HandlerFunc
+}
+
+// NewAppRouter creates a router without any apps. Each app's endpoints are
+// wrapped in the same middleware as the default app's, so the app paths can't
+// be used to bypass it; nil middleware leaves the endpoints unwrapped.
+func NewAppRouter(webhook, registration Middleware) *AppRouter {
+	return &AppRouter{
+		webhook:      webhook,
+		registration: registration,
+		apps:         make(map[string]map[string]http.HandlerFunc),
+	}
+}
+
+// Add serves the app's endpoints under /app/{id}/
+func (r *AppRouter) Add(id string, webhookHandler *WebhookHandler) {
+	r.apps[id] = map[string]http.HandlerFunc{
+		"webhook/github":     wrap(r.webhook, webhookHandler.HandleGitHubWebhook),
+		"webhook/register":   wrap(r.registration, webhookHandler.RegisterDevice),
+		"webhook/unregister": wrap(r.registration, webhookHandler.UnregisterDevice),
+		"webhook/status":     webhookHandler.GetStatus,
+	}
+}
+
+// wrap applies middleware to next, if there is any
+func wrap(middleware Middleware, next http.HandlerFunc) http.HandlerFunc {
+	if middleware == nil {
+		return next
+	}
+	return middleware(next)
+}
+
+// ServeHTTP routes /app/{id}/webhook/{github,register,unregister,status} to the
+// app's handler, answering 404 for unknown apps and endpoints
+func (r *AppRouter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	id, endpoint, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/app/"), "/")
+	endpoints, ok := r.apps[id]
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+
+	handler, ok := endpoints[endpoint]
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	handler(rw, req)
+}
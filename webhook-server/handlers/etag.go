@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// writeJSONWithETag writes v as JSON with an ETag derived from its content, or
+// 304 Not Modified without a body when the request's If-None-Match has it
+func writeJSONWithETag(rw http.ResponseWriter, req *http.Request, v interface{}) {
+	writeJSONWithETagOf(rw, req, v, v)
+}
+
+// writeJSONWithETagOf is writeJSONWithETag with the ETag derived from key
+// instead, for responses whose ever-changing fields (e.g. counters) shouldn't
+// defeat If-None-Match
+func writeJSONWithETagOf(rw http.ResponseWriter, req *http.Request, v, key interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		log.Printf("Error encoding ETag key: %v", err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(keyJSON)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	rw.Header().Set("ETag", etag)
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(append(body, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag (or is "*")
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -4,17 +4,23 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"mdtalkman-webhook/services"
 )
 
 // HealthHandler provides health check endpoints
 type HealthHandler struct {
-	startTime time.Time
+	startTime   time.Time
+	apnsService *services.APNsService
+	deviceStore services.DeviceStore
 }
 
 // NewHealthHandler creates a new health handler
-func NewHealthHandler() *HealthHandler {
+func NewHealthHandler(apnsService *services.APNsService, deviceStore services.DeviceStore) *HealthHandler {
 	return &HealthHandler{
-		startTime: time.Now(),
+		startTime:   time.Now(),
+		apnsService: apnsService,
+		deviceStore: deviceStore,
 	}
 }
 
@@ -28,38 +34,64 @@ func (h *HealthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	uptime := time.Since(h.startTime)
 	
 	response := struct {
-		Status    string  `json:"status"`
-		Timestamp string  `json:"timestamp"`
-		Uptime    string  `json:"uptime"`
-		Version   string  `json:"version"`
+		Status             string  `json:"status"`
+		Timestamp          string  `json:"timestamp"`
+		Uptime             string  `json:"uptime"`
+		Version            string  `json:"version"`
+		APNsEnvironment    string  `json:"apns_environment"`
+		LastSuccessfulPush *string `json:"last_successful_push"` // null until the first push succeeds
 	}{
-		Status:    "healthy",
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Uptime:    uptime.String(),
-		Version:   "1.0.0",
+		Status:          "healthy",
+		Timestamp:       time.Now().UTC().Format(time.RFC3339),
+		Uptime:          uptime.String(),
+		Version:         "1.0.0",
+		APNsEnvironment: h.apnsService.Environment(),
+	}
+	if last := h.apnsService.LastSuccessfulPush(); !last.IsZero() {
+		formatted := last.UTC().Format(time.RFC3339)
+		response.LastSuccessfulPush = &formatted
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// ReadinessCheck checks if the service is ready to accept requests
+// ReadinessCheck checks if the service is ready to accept requests, answering
+// 503 while the device store is failing, APNs isn't initialized yet or the APNs
+// circuit breaker is open
 func (h *HealthHandler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// In a more complex service, you might check database connections,
-	// external service availability, etc.
+	var problems []string
+	if _, err := h.deviceStore.Count(); err != nil {
+		problems = append(problems, "device store unavailable")
+	}
+	if !h.apnsService.Initialized() {
+		problems = append(problems, "APNs not initialized")
+	}
+	if h.apnsService.CircuitState() == services.CircuitOpen {
+		problems = append(problems, "APNs circuit breaker open")
+	}
+
 	response := struct {
-		Status string `json:"status"`
-		Ready  bool   `json:"ready"`
+		Status   string   `json:"status"`
+		Ready    bool     `json:"ready"`
+		Problems []string `json:"problems,omitempty"`
 	}{
-		Status: "ready",
-		Ready:  true,
+		Status:   "ready",
+		Ready:    len(problems) == 0,
+		Problems: problems,
+	}
+	status := http.StatusOK
+	if !response.Ready {
+		response.Status = "not_ready"
+		status = http.StatusServiceUnavailable
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
\ No newline at end of file
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithTimeout wraps next so each request runs with a context deadline.
+// Handlers that exceed it are abandoned and the client receives a 503.
+func WithTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.TimeoutHandler(next, timeout, `{"status": "error", "message": "Request timed out"}`)
+}
+
+// RequireAdminToken only lets requests through that carry "Authorization: Bearer <token>".
+// Admin endpoints are disabled entirely when no token is configured.
+func RequireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if token == "" {
+			http.NotFound(rw, req)
+			return
+		}
+
+		provided, bearer := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !bearer || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(rw, req)
+	}
+}
+
+// RequireHeaders rejects requests with 403 unless every configured header is
+// present with the expected value (e.g. a shared header injected by an API gateway)
+func RequireHeaders(required map[string]string, next http.HandlerFunc) http.HandlerFunc {
+	if len(required) == 0 {
+		return next
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		for name, expected := range required {
+			if subtle.ConstantTimeCompare([]byte(req.Header.Get(name)), []byte(expected)) != 1 {
+				log.Printf("Rejecting request to %s: required header %s missing or incorrect", req.URL.Path, name)
+				http.Error(rw, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		next(rw, req)
+	}
+}
+
+// RequireHTTPS rejects requests with 403 unless they arrived over TLS, so deliveries
+// can't bypass TLS by reaching a plaintext port directly. Behind a TLS-terminating
+// proxy (trustProxy) the proxy's X-Forwarded-Proto header decides instead; only
+// trust it when clients can't reach the server except through the proxy.
+func RequireHTTPS(required, trustProxy bool, next http.HandlerFunc) http.HandlerFunc {
+	if !required {
+		return next
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		secure := req.TLS != nil
+		if trustProxy {
+			// A chain of proxies appends to the header; the first value is the client's
+			proto, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Proto"), ",")
+			secure = strings.EqualFold(strings.TrimSpace(proto), "https")
+		}
+		if !secure {
+			log.Printf("Rejecting plaintext request to %s from %s", req.URL.Path, req.RemoteAddr)
+			http.Error(rw, "HTTPS required", http.StatusForbidden)
+			return
+		}
+
+		next(rw, req)
+	}
+}
+
+// RequireHookTarget rejects webhooks with 403 unless GitHub's
+// X-GitHub-Hook-Installation-Target-Type header equals targetType and the
+// X-GitHub-Hook-Installation-Target-ID header is one of targetIDs. Empty values
+// skip the respective check. This guards against webhooks misrouted from
+// another GitHub App, repository or organization.
+func RequireHookTarget(targetType string, targetIDs []string, next http.HandlerFunc) http.HandlerFunc {
+	if targetType == "" && len(targetIDs) == 0 {
+		return next
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		gotType := req.Header.Get("X-GitHub-Hook-Installation-Target-Type")
+		gotID := req.Header.Get("X-GitHub-Hook-Installation-Target-ID")
+
+		if targetType != "" && !strings.EqualFold(gotType, targetType) {
+			log.Printf("Rejecting webhook: hook target type %q, expected %q", gotType, targetType)
+			http.Error(rw, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if len(targetIDs) > 0 && !containsString(targetIDs, gotID) {
+			log.Printf("Rejecting webhook: unexpected hook target ID %q", gotID)
+			http.Error(rw, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(rw, req)
+	}
+}
+
+// containsString reports whether values includes value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
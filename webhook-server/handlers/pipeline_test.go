@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sideshow/apns2"
+	"mdtalkman-webhook/models"
+	"mdtalkman-webhook/services"
+)
+
+const testWebhookSecret = "pipeline-test-secret"
+
+// recordingPusher is a fake APNs client that accepts and records every push
+type recordingPusher struct {
+	mu     sync.Mutex
+	pushes []*apns2.Notification
+}
+
+func (p *recordingPusher) PushWithContext(ctx apns2.Context, n *apns2.Notification) (*apns2.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pushes = append(p.pushes, n)
+	return &apns2.Response{StatusCode: http.StatusOK, ApnsID: "test"}, nil
+}
+
+func (p *recordingPusher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.pushes)
+}
+
+// newTestPipeline builds a webhook handler with one registered device that
+// sends through a recording APNs client
+func newTestPipeline(t *testing.T, deviceStore services.DeviceStore) (*WebhookHandler, *recordingPusher) {
+	t.Helper()
+
+	if _, err := deviceStore.Upsert(models.Device{Token: "0123456789abcdef0123456789abcdef"}); err != nil {
+		t.Fatalf("registering device: %v", err)
+	}
+	pusher := &recordingPusher{}
+	apnsService := services.NewAPNsServiceWithPusher(pusher, "com.example.mdtalkman", true)
+	return NewWebhookHandler(services.NewGitHubService(testWebhookSecret), apnsService, deviceStore), pusher
+}
+
+// pushPayload returns a push event payload changing files in one commit
+func pushPayload(t *testing.T, files ...string) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(models.GitHubWebhookPayload{
+		Repository: models.Repository{Name: "docs", FullName: "octocat/docs"},
+		Sender:     models.User{Login: "octocat"},
+		Ref:        "refs/heads/main",
+		Commits: []models.Commit{{
+			ID:       "abc123",
+			Message:  "Update files",
+			Author:   models.CommitAuthor{Name: "Octo Cat", Username: "octocat"},
+			Modified: files,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("encoding payload: %v", err)
+	}
+	return body
+}
+
+// deliver sends a webhook delivery signed with the default secret to the
+// handler and returns the response
+func deliver(w *WebhookHandler, eventType, deliveryID string, body []byte) *httptest.ResponseRecorder {
+	return deliverSigned(w, testWebhookSecret, eventType, deliveryID, body)
+}
+
+// deliverSigned sends a webhook delivery signed with secret to the handler and returns the response
+func deliverSigned(w *WebhookHandler, secret, eventType, deliveryID string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/github", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", deliveryID)
+	req.Header.Set("X-Hub-Signature-256", services.ComputeSignature(secret, body))
+
+	rec := httptest.NewRecorder()
+	w.HandleGitHubWebhook(rec, req)
+	return rec
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []string
+		wantPushes int
+	}{
+		{name: "markdown push notifies", files: []string{"README.md"}, wantPushes: 1},
+		{name: "non-markdown push is skipped", files: []string{"main.go"}, wantPushes: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, pusher := newTestPipeline(t, services.NewMemoryDeviceStore())
+
+			rec := deliver(w, "push", "delivery-1", pushPayload(t, tt.files...))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if got := pusher.count(); got != tt.wantPushes {
+				t.Errorf("pushes = %d, want %d", got, tt.wantPushes)
+			}
+		})
+	}
+}
+
+// TestPipelineWithoutInstallation covers repository and organization webhooks,
+// which GitHub sends without an installation object
+func TestPipelineWithoutInstallation(t *testing.T) {
+	body := []byte(`{
+		"ref": "refs/heads/main",
+		"repository": {"name": "docs", "full_name": "octocat/docs"},
+		"sender": {"login": "octocat"},
+		"commits": [{"id": "abc123", "message": "Update README", "author": {"name": "Octo Cat", "username": "octocat"}, "modified": ["README.md"]}]
+	}`)
+
+	tests := []struct {
+		name          string
+		tenantSecrets map[string]string
+		signingSecret string
+	}{
+		{name: "default secret", signingSecret: testWebhookSecret},
+		{
+			name:          "repository secret",
+			tenantSecrets: map[string]string{"42": "installation-secret", "octocat/docs": "repository-secret"},
+			signingSecret: "repository-secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, pusher := newTestPipeline(t, services.NewMemoryDeviceStore())
+			w.githubService.SetWebhookSecrets(tt.tenantSecrets)
+
+			rec := deliverSigned(w, tt.signingSecret, "push", "delivery-1", body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if got := pusher.count(); got != 1 {
+				t.Errorf("pushes = %d, want 1", got)
+			}
+		})
+	}
+}
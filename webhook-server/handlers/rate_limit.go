@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket per client IP. Each client may make burst
+// requests at once, refilled at rate tokens per second.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time // when refilled buckets were last dropped
+}
+
+// rateLimitPruneInterval is how often Allow drops buckets that have refilled
+const rateLimitPruneInterval = time.Minute
+
+// tokenBucket holds one client's tokens as of the last request
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter allows perMinute requests per minute per client, with bursts of
+// up to burst. It returns nil, which disables limiting, when perMinute is zero.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		pruned:  time.Now(),
+	}
+}
+
+// Allow takes a token from the client's bucket. When it is empty, Allow returns
+// false and how long until the next token is refilled.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) >= rateLimitPruneInterval {
+		l.prune(now)
+	}
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst}
+		l.buckets[client] = bucket
+	} else {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	}
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// prune drops the buckets that have refilled completely, which behave like new
+// ones; callers hold mu
+func (l *RateLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= full {
+			delete(l.buckets, client)
+		}
+	}
+	l.pruned = now
+}
+
+// RateLimit rejects requests with 429 Too Many Requests once the client's bucket
+// is empty, with a Retry-After header (in whole seconds) saying when to try again.
+// Behind a proxy (trustProxy) clients are told apart by the proxy's X-Real-IP or
+// X-Forwarded-For header, since every connection comes from the proxy. A nil
+// limiter disables the limit.
+func RateLimit(limiter *RateLimiter, trustProxy bool, next http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return next
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		client := clientIP(req, trustProxy)
+
+		if ok, wait := limiter.Allow(client); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			log.Printf("🚦 Rate limiting %s on %s, retry after %ds", client, req.URL.Path, retryAfter)
+			rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(rw, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next(rw, req)
+	}
+}
+
+// clientIP returns the IP address a request came from: the connection's peer,
+// or with trustProxy the address the proxy reports for its client
+func clientIP(req *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := strings.TrimSpace(req.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		// A chain of proxies appends to the header; the first value is the client's
+		if ip, _, _ := strings.Cut(req.Header.Get("X-Forwarded-For"), ","); strings.TrimSpace(ip) != "" {
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
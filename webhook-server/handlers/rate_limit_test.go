@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitKeysOnClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		headers    map[string]string // second client's headers; both connect from the proxy's address
+		wantStatus int               // second client's status once the first is limited
+	}{
+		{name: "direct connections share the proxy's bucket", headers: map[string]string{"X-Real-IP": "203.0.113.2"}, wantStatus: http.StatusTooManyRequests},
+		{name: "trusted proxy X-Real-IP", trustProxy: true, headers: map[string]string{"X-Real-IP": "203.0.113.2"}, wantStatus: http.StatusOK},
+		{name: "trusted proxy X-Forwarded-For", trustProxy: true, headers: map[string]string{"X-Forwarded-For": "203.0.113.2, 10.0.0.1"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RateLimit(NewRateLimiter(1, 1), tt.trustProxy, func(rw http.ResponseWriter, req *http.Request) {})
+			request := func(headers map[string]string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/webhook/register", nil)
+				req.RemoteAddr = "10.0.0.1:54321"
+				for name, value := range headers {
+					req.Header.Set(name, value)
+				}
+				rec := httptest.NewRecorder()
+				handler(rec, req)
+				return rec
+			}
+
+			first := map[string]string{"X-Real-IP": "203.0.113.1", "X-Forwarded-For": "203.0.113.1"}
+			if rec := request(first); rec.Code != http.StatusOK {
+				t.Fatalf("first request status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			rec := request(first)
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("repeated request status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("limited response has no Retry-After header")
+			}
+			if rec := request(tt.headers); rec.Code != tt.wantStatus {
+				t.Errorf("other client's status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
+	"mdtalkman-webhook/metrics"
 	"mdtalkman-webhook/models"
 	"mdtalkman-webhook/services"
 )
@@ -16,16 +21,329 @@ import (
 type WebhookHandler struct {
 	githubService *services.GitHubService
 	apnsService   *services.APNsService
-	deviceTokens  []string // In production, this would be stored in a database
+	fcmService    *services.FCMService // Android delivery; nil when FCM isn't configured
+	deviceStore   services.DeviceStore
+	broker        services.EventBroker
+	deliveries    *services.DeliveryLog
+	seen          *services.SeenDeliveries  // delivery IDs already handled, so redeliveries don't push twice
+	journal       *services.DeliveryJournal // persisted deliveries for replay; nil when disabled
+	retries       *services.RetryQueue      // re-sends transiently failed pushes; nil when disabled
+	scheduled     *services.HoldQueue       // pushes batched for devices' scheduled delivery times
+	afterHours    *services.HoldQueue       // pushes held until business hours begin
+	repoStats     *services.RepoStats
+	latency       *services.LatencyRecorder // webhook processing times
+
+	responseSigningKey string                       // signs register/unregister responses when set
+	attestation        services.AttestationVerifier // required App Attest proof on registration; nil when disabled
+	asyncNotifications bool                         // send pushes in the background and answer 202
+	diagnoseSignatures bool                         // log why signatures fail to verify (development only)
+	retryOnError       bool                         // answer 500 on internal errors so GitHub redelivers
+	internalErrors     metrics.Counter
+
+	// Reloadable delivery settings, guarded by mu
+	mu                   sync.RWMutex
+	coalescer            *services.Coalescer
+	throttle             *services.DeviceThrottle
+	notificationsEnabled bool
+	debugHTTP            bool                       // log webhook headers and payloads
+	quietMode            string                     // services.QuietHoursSuppress or services.QuietHoursSilent
+	canaryDelay          time.Duration              // how long other devices wait after the canary group
+	replayTolerance      time.Duration              // reject deliveries older than this; 0 disables
+	replayHeader         string                     // header carrying the delivery timestamp; commits when empty
+	quietQueue           *services.HoldQueue        // summarizes pushes held during quiet hours, when enabled
+	businessHours        *services.BusinessHours    // send only in this window; nil sends any time
+	redactPaths          []string                   // JSON paths masked in logged payloads
+	welcomePush          bool                       // confirm new registrations with a push
+	outbound             *services.OutboundNotifier // also posts notifications to these URLs; nil when none
 }
 
+// deliveryLogCapacity is how many recent deliveries /webhook/changes can answer for
+const deliveryLogCapacity = 1000
+
 // NewWebhookHandler creates a new webhook handler
-func NewWebhookHandler(githubService *services.GitHubService, apnsService *services.APNsService) *WebhookHandler {
-	return &WebhookHandler{
+func NewWebhookHandler(githubService *services.GitHubService, apnsService *services.APNsService, deviceStore services.DeviceStore) *WebhookHandler {
+	w := &WebhookHandler{
 		githubService: githubService,
 		apnsService:   apnsService,
-		deviceTokens:  make([]string, 0),
+		deviceStore:   deviceStore,
+		deliveries:    services.NewDeliveryLog(deliveryLogCapacity),
+		seen:          services.NewSeenDeliveries(deliveryLogCapacity),
+		repoStats:     services.NewRepoStats(),
+		latency:       services.NewLatencyRecorder(),
+
+		notificationsEnabled: true,
+		quietMode:            services.QuietHoursSuppress,
+	}
+	w.scheduled = services.NewHoldQueue(w.sendSummary)
+	w.afterHours = services.NewHoldQueue(w.sendSummary)
+	return w
+}
+
+// SetOutboundNotifier also posts every notification to the notifier's
+// destinations (e.g. a Slack channel); nil disables it
+func (w *WebhookHandler) SetOutboundNotifier(notifier *services.OutboundNotifier) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.outbound = notifier
+}
+
+// SetBusinessHours restricts notifications to a server-wide window; events
+// outside it are delivered to each device as one digest when the window opens.
+// nil sends at any time.
+func (w *WebhookHandler) SetBusinessHours(hours *services.BusinessHours) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.businessHours = hours
+}
+
+// SetQuietHours configures pushes during a device's quiet hours: suppressed or
+// sent silently (mode), and optionally summarized once the quiet hours end
+func (w *WebhookHandler) SetQuietHours(mode string, summary bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.quietMode = mode
+	if !summary {
+		w.quietQueue = nil
+		return
+	}
+	if w.quietQueue == nil {
+		w.quietQueue = services.NewHoldQueue(w.sendSummary)
+	}
+}
+
+// SetDebugLogging logs every webhook's headers and payload, with the values at
+// redactPaths (e.g. "commits[].message") masked
+func (w *WebhookHandler) SetDebugLogging(enabled bool, redactPaths []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.debugHTTP = enabled
+	w.redactPaths = redactPaths
+}
+
+// SetNotificationsEnabled turns push notifications on or off globally. While
+// disabled, webhooks are still processed and acknowledged but nothing is sent.
+func (w *WebhookHandler) SetNotificationsEnabled(enabled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.notificationsEnabled = enabled
+}
+
+// NotificationsEnabled reports whether push notifications are currently sent
+func (w *WebhookHandler) NotificationsEnabled() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.notificationsEnabled
+}
+
+// EnableCoalescing holds notifications for window after the first delivery for a
+// coalescing key (see services.ParseCoalesceKey) and merges any further
+// deliveries with that key into a single push
+func (w *WebhookHandler) EnableCoalescing(window time.Duration, keyTemplate string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if window <= 0 {
+		w.coalescer = nil
+		return
+	}
+	if w.coalescer != nil && w.coalescer.Window() == window && w.coalescer.KeyTemplate() == keyTemplate {
+		return
 	}
+	w.coalescer = services.NewCoalescer(window, keyTemplate, func(event *models.WebhookEvent, deliveryIDs []string) {
+		// The originating requests have completed by the time the window closes
+		w.broadcast(context.Background(), event)
+		for _, deliveryID := range deliveryIDs {
+			w.completeDelivery(deliveryID)
+		}
+	})
+}
+
+// SetRetryOnInternalError answers verified webhooks with 500 when an internal
+// failure (e.g. the device store) prevents notifying, so GitHub redelivers them.
+// By default they are acknowledged anyway, which avoids redelivery storms while
+// the failure persists; failures are counted in /webhook/status either way.
+func (w *WebhookHandler) SetRetryOnInternalError(enabled bool) {
+	w.retryOnError = enabled
+}
+
+// SetSignatureDiagnostics logs the received algorithm, body length and whether
+// a SHA-1 signature would have matched when verification fails. Secrets and
+// expected signatures are never logged; enable only in development.
+func (w *WebhookHandler) SetSignatureDiagnostics(enabled bool) {
+	w.diagnoseSignatures = enabled
+}
+
+// SetReplayTolerance rejects deliveries whose timestamp (see
+// services.DeliveryTimestamp) is older than tolerance; 0 disables the check
+func (w *WebhookHandler) SetReplayTolerance(tolerance time.Duration, timestampHeader string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.replayTolerance = tolerance
+	w.replayHeader = timestampHeader
+}
+
+// SetCanaryDelay sends each notification to canary devices first and to all
+// other devices delay later; with no delay the groups are only sent in order
+func (w *WebhookHandler) SetCanaryDelay(delay time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.canaryDelay = delay
+}
+
+// RepoStats returns the per-repository notification counters
+func (w *WebhookHandler) RepoStats() *services.RepoStats {
+	return w.repoStats
+}
+
+// Latency returns the recorder of webhook processing times
+func (w *WebhookHandler) Latency() *services.LatencyRecorder {
+	return w.latency
+}
+
+// SetAttestationVerifier requires registrations to carry an App Attest proof
+// that verifier accepts before their token is stored
+func (w *WebhookHandler) SetAttestationVerifier(verifier services.AttestationVerifier) {
+	w.attestation = verifier
+}
+
+// SetWelcomePush sends a one-time push to each newly registered device, to
+// confirm notifications work end-to-end; re-registrations get none
+func (w *WebhookHandler) SetWelcomePush(enabled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.welcomePush = enabled
+}
+
+// sendWelcome pushes the welcome notification to a newly registered device
+func (w *WebhookHandler) sendWelcome(device models.Device) {
+	if !w.NotificationsEnabled() {
+		return
+	}
+	event := &models.WebhookEvent{EventType: services.WelcomeEventType}
+	if err := w.sendToDevice(context.Background(), device, event); err != nil {
+		log.Printf("Error sending welcome push to %s: %v", services.MaskToken(device.Token), err)
+	}
+}
+
+// UseFCM delivers notifications for Android-registered devices through FCM
+func (w *WebhookHandler) UseFCM(fcmService *services.FCMService) {
+	w.fcmService = fcmService
+}
+
+// UseDeliveryJournal journals every verified delivery and marks it once its
+// notification work is done, so ReplayPending can pick up the rest after a restart
+func (w *WebhookHandler) UseDeliveryJournal(journal *services.DeliveryJournal) {
+	w.journal = journal
+}
+
+// UseRetryQueue re-sends pushes that failed transiently during a broadcast
+// through queue, starting with the retries it loaded from disk
+func (w *WebhookHandler) UseRetryQueue(queue *services.RetryQueue) {
+	w.retries = queue
+	queue.Start(w.retrySend)
+}
+
+// retrySend sends one retried push. The device must still be registered and
+// accept the event, and the same gates as a broadcast apply, so a retry held back
+// by quiet hours or the throttle arrives later in a summary push. The badge isn't
+// raised again: the failed push already counted. Retries are dropped while
+// notifications are disabled.
+func (w *WebhookHandler) retrySend(ctx context.Context, device models.Device, event *models.WebhookEvent) error {
+	if !w.NotificationsEnabled() {
+		return nil
+	}
+
+	// Use the device's current settings and badge rather than those queued with the retry
+	devices, err := w.deviceStore.List()
+	if err != nil {
+		log.Printf("Error loading registered devices, retrying with the queued settings: %v", err)
+		devices = []models.Device{device}
+	}
+	var recipients []models.Device
+	for _, registered := range devices {
+		if registered.Token == device.Token {
+			recipients = services.FilterDevices([]models.Device{registered}, event)
+			break
+		}
+	}
+	recipients = w.deliverableNow(recipients, event)
+	if len(recipients) == 0 {
+		log.Printf("Not retrying push to device %s: it is unregistered, unsubscribed or held back", services.MaskToken(device.Token))
+		return nil
+	}
+	return w.sendToDevice(ctx, recipients[0], event)
+}
+
+// completeDelivery marks a journaled delivery as needing no further notification work
+func (w *WebhookHandler) completeDelivery(deliveryID string) {
+	if w.journal == nil || deliveryID == "" {
+		return
+	}
+	if err := w.journal.MarkNotified(deliveryID); err != nil {
+		log.Printf("Error updating delivery journal for %s: %v", deliveryID, err)
+	}
+}
+
+// ReplayPending re-processes journaled deliveries received within window whose
+// notifications never went out (e.g. the server stopped mid-delivery), so
+// devices catch up after downtime. Deliveries already notified are skipped.
+func (w *WebhookHandler) ReplayPending(window time.Duration) int {
+	if w.journal == nil {
+		return 0
+	}
+
+	pending := w.journal.Pending(window)
+	for _, entry := range pending {
+		payload, err := services.DecodePayload(entry.Payload)
+		if err != nil {
+			log.Printf("Skipping unreadable journaled delivery %s: %v", entry.DeliveryID, err)
+			w.completeDelivery(entry.DeliveryID)
+			continue
+		}
+
+		log.Printf("🔁 Replaying delivery %s (%s) received %s", entry.DeliveryID, entry.EventType, entry.ReceivedAt.Format(time.RFC3339))
+		event := w.githubService.ProcessWebhookEvent(context.Background(), payload, entry.EventType)
+		event.DeliveryID = entry.DeliveryID
+		if event.HasMarkdownChanges {
+			w.deliveries.Record(entry.DeliveryID, services.CollectMarkdownChanges(services.PushCommits(payload)))
+		}
+		if w.githubService.ShouldNotifyApp(event) && w.NotificationsEnabled() {
+			w.notify(context.Background(), event)
+		} else {
+			w.completeDelivery(entry.DeliveryID)
+		}
+	}
+	return len(pending)
+}
+
+// SetAsyncNotifications sends pushes in the background instead of before responding to GitHub
+func (w *WebhookHandler) SetAsyncNotifications(async bool) {
+	w.asyncNotifications = async
+}
+
+// SetResponseSigningKey enables HMAC signing of register/unregister response bodies
+// in the X-Response-Signature header, so clients can verify they came from this server
+func (w *WebhookHandler) SetResponseSigningKey(key string) {
+	w.responseSigningKey = key
+}
+
+// writeSignedResponse writes a JSON body, signing it when a response signing key is configured
+func (w *WebhookHandler) writeSignedResponse(rw http.ResponseWriter, status int, body string) {
+	rw.Header().Set("Content-Type", "application/json")
+	if w.responseSigningKey != "" {
+		rw.Header().Set("X-Response-Signature", services.ComputeSignature(w.responseSigningKey, []byte(body)))
+	}
+	rw.WriteHeader(status)
+	io.WriteString(rw, body)
 }
 
 // HandleGitHubWebhook handles incoming GitHub webhook requests
@@ -35,6 +353,13 @@ func (w *WebhookHandler) HandleGitHubWebhook(rw http.ResponseWriter, req *http.R
 		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	start := time.Now()
+	metrics.WebhooksReceived.Inc()
+	metrics.WebhooksInFlight.Add(1)
+	defer func() {
+		metrics.WebhooksInFlight.Add(-1)
+		w.latency.Record(time.Since(start))
+	}()
 
 	// Read the request body
 	body, err := io.ReadAll(req.Body)
@@ -47,14 +372,23 @@ func (w *WebhookHandler) HandleGitHubWebhook(rw http.ResponseWriter, req *http.R
 
 	// Get GitHub headers
 	signature := req.Header.Get("X-Hub-Signature-256")
-	eventType := req.Header.Get("X-GitHub-Event")
+	eventType := services.NormalizeEventType(req.Header.Get("X-GitHub-Event"))
 	deliveryID := req.Header.Get("X-GitHub-Delivery")
 
 	log.Printf("Received webhook: Event=%s, Delivery=%s", eventType, deliveryID)
 
 	// Verify the webhook signature (skip if testing without signature)
-	if signature != "" && !w.githubService.VerifyWebhookSignature(body, signature) {
-		log.Printf("Invalid webhook signature for delivery %s", deliveryID)
+	var verifyErr error
+	if signature != "" {
+		verifyErr = w.githubService.VerifyWebhookSignatureE(body, signature)
+	}
+	if verifyErr != nil {
+		log.Printf("Invalid webhook signature for delivery %s: %v", deliveryID, verifyErr)
+		if w.diagnoseSignatures {
+			d := w.githubService.DiagnoseSignature(body, signature, req.Header.Get("X-Hub-Signature"), req.ContentLength)
+			log.Printf("🔍 Signature diagnostics for delivery %s: algorithm=%s body_length=%d content_length=%d body_length_matches=%t sha1_matches=%t",
+				deliveryID, d.Algorithm, d.BodyLength, d.ContentLength, d.BodyLengthMatches, d.SHA1Matches)
+		}
 		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -63,38 +397,419 @@ func (w *WebhookHandler) HandleGitHubWebhook(rw http.ResponseWriter, req *http.R
 		log.Printf("Warning: No signature provided for delivery %s (testing mode)", deliveryID)
 	}
 
-	// Parse the webhook payload
-	var payload models.GitHubWebhookPayload
-	if err := json.Unmarshal(body, &payload); err != nil {
+	// Payloads are logged only once verified, so unauthenticated requests can't fill the logs
+	w.mu.RLock()
+	debugHTTP, redactPaths := w.debugHTTP, w.redactPaths
+	w.mu.RUnlock()
+	if debugHTTP {
+		log.Printf("🐛 Webhook %s headers: User-Agent=%q, Content-Type=%q, Hook-ID=%q, Enterprise-Host=%q",
+			deliveryID, req.UserAgent(), req.Header.Get("Content-Type"), req.Header.Get("X-GitHub-Hook-ID"),
+			req.Header.Get("X-GitHub-Enterprise-Host"))
+		log.Printf("🐛 Webhook %s payload: %s", deliveryID, services.RedactJSON(body, redactPaths))
+	}
+
+	// GitHub sends a delivery again when an attempt timed out, which may still
+	// be notifying; journaled deliveries are also recognized after a restart
+	if deliveryID != "" && (!w.seen.Claim(deliveryID) || (w.journal != nil && w.journal.Notified(deliveryID))) {
+		log.Printf("Ignoring repeated delivery %s", deliveryID)
+		rw.Header().Set("Content-Type", "application/json")
+		io.WriteString(rw, `{"status": "success", "message": "Delivery already processed"}`)
+		return
+	}
+
+	// Parse the webhook payload, tolerating older field names
+	payload, err := services.DecodePayload(body)
+	if err != nil {
 		log.Printf("Error parsing webhook payload: %v", err)
+		w.seen.Release(deliveryID)
 		http.Error(rw, "Bad request", http.StatusBadRequest)
 		return
 	}
 
+	w.mu.RLock()
+	replayTolerance, replayHeader := w.replayTolerance, w.replayHeader
+	w.mu.RUnlock()
+	if replayTolerance > 0 {
+		var headerValue string
+		if replayHeader != "" {
+			headerValue = req.Header.Get(replayHeader)
+		}
+		if created, ok := services.DeliveryTimestamp(payload, headerValue); ok && time.Since(created) > replayTolerance {
+			log.Printf("Rejecting stale delivery %s from %s", deliveryID, created.Format(time.RFC3339))
+			w.seen.Release(deliveryID)
+			http.Error(rw, "Stale delivery", http.StatusForbidden)
+			return
+		}
+	}
+
+	if w.journal != nil && deliveryID != "" {
+		if err := w.journal.Record(deliveryID, eventType, body); err != nil {
+			log.Printf("Error journaling delivery %s: %v", deliveryID, err)
+		}
+	}
+
 	// Process the webhook event
-	event := w.githubService.ProcessWebhookEvent(&payload, eventType)
+	event := w.githubService.ProcessWebhookEvent(req.Context(), payload, eventType)
+	event.DeliveryID = deliveryID
+	if req.Context().Err() != nil {
+		// Timed out before notifying anyone: let GitHub's redelivery do it
+		log.Printf("Abandoning delivery %s: %v", deliveryID, req.Context().Err())
+		w.seen.Release(deliveryID)
+		return
+	}
+	if event.HasMarkdownChanges && deliveryID != "" {
+		w.deliveries.Record(deliveryID, services.CollectMarkdownChanges(services.PushCommits(payload)))
+	}
 	
 	log.Printf("Processed event: Type=%s, Repo=%s, Action=%s, HasMarkdown=%t", 
 		event.EventType, event.RepositoryName, event.Action, event.HasMarkdownChanges)
 
 	// Check if we should notify the iOS app
-	if w.githubService.ShouldNotifyApp(event) && len(w.deviceTokens) > 0 {
-		log.Printf("Sending push notification for event: %s", event.EventType)
-		
-		if err := w.apnsService.SendBroadcast(w.deviceTokens, event); err != nil {
-			log.Printf("Error sending push notifications: %v", err)
-			// Don't return error to GitHub - we still processed the webhook successfully
+	deviceCount, countErr := w.deviceStore.Count()
+	if countErr != nil {
+		w.internalErrors.Inc()
+		log.Printf("Error counting registered devices for delivery %s: %v", deliveryID, countErr)
+		if w.retryOnError {
+			// Nothing was sent, so GitHub's redelivery must be processed
+			w.seen.Release(deliveryID)
+			http.Error(rw, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	queued, notified := false, false
+	shouldNotify := w.githubService.ShouldNotifyApp(event)
+	if shouldNotify && w.NotificationsEnabled() {
+		w.notifyOutbound(event)
+	}
+	if shouldNotify && !w.NotificationsEnabled() {
+		log.Printf("Skipping notification: notifications are disabled")
+	} else if shouldNotify && w.broker != nil {
+		// Every instance (including this one) notifies its own devices
+		if err := w.broker.Publish(req.Context(), event); err != nil {
+			log.Printf("Error publishing event to broker, notifying local devices only: %v", err)
+			queued = w.notify(req.Context(), event)
 		} else {
-			log.Printf("Successfully sent push notifications to %d devices", len(w.deviceTokens))
+			queued = true
+			w.completeDelivery(deliveryID)
 		}
+		notified = true
+	} else if shouldNotify && (deviceCount > 0 || countErr != nil) {
+		queued = w.notify(req.Context(), event)
+		notified = true
 	} else {
-		log.Printf("Skipping notification: ShouldNotify=%t, DeviceTokens=%d", 
-			w.githubService.ShouldNotifyApp(event), len(w.deviceTokens))
+		log.Printf("Skipping notification: ShouldNotify=%t, DeviceTokens=%d", shouldNotify, deviceCount)
+		w.completeDelivery(deliveryID)
+	}
+
+	// Respond to GitHub (shown in its delivery UI); 202 when notification work is
+	// still pending. Push failures never turn into an error status, so GitHub doesn't retry.
+	response := struct {
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+		Notified    bool   `json:"notified"`
+		DeviceCount int    `json:"device_count"`
+		EventType   string `json:"event_type"`
+	}{
+		Status:      "success",
+		Message:     "Webhook processed",
+		Notified:    notified,
+		DeviceCount: deviceCount,
+		EventType:   event.EventType,
+	}
+	status := http.StatusOK
+	if queued {
+		response.Status, response.Message = "accepted", "Webhook queued for notification"
+		status = http.StatusAccepted
 	}
 
-	// Respond to GitHub
-	rw.WriteHeader(http.StatusOK)
-	fmt.Fprintf(rw, `{"status": "success", "message": "Webhook processed"}`)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(response)
+}
+
+// notifyOutbound posts the event to the outbound destinations in the background.
+// It's called by the instance that received the delivery, whether or not any
+// device is registered, so brokered events aren't posted once per instance.
+func (w *WebhookHandler) notifyOutbound(event *models.WebhookEvent) {
+	w.mu.RLock()
+	outbound := w.outbound
+	w.mu.RUnlock()
+	if outbound != nil {
+		// Independent of the push services, and of the originating request
+		go outbound.Notify(context.Background(), event)
+	}
+}
+
+// notify delivers an event to this instance's devices, via the coalescer if enabled.
+// It returns true when the pushes were queued rather than sent before returning.
+func (w *WebhookHandler) notify(ctx context.Context, event *models.WebhookEvent) bool {
+	w.mu.RLock()
+	coalescer := w.coalescer
+	w.mu.RUnlock()
+
+	switch {
+	case coalescer != nil:
+		// Journaled deliveries are completed once the merged push is sent, so
+		// they're replayed if the server stops during the window
+		coalescer.Add(event)
+		return true
+	case w.asyncNotifications:
+		// The request context ends with the response, so send in the background
+		go func() {
+			w.broadcast(context.Background(), event)
+			w.completeDelivery(event.DeliveryID)
+		}()
+		return true
+	default:
+		w.broadcast(ctx, event)
+		w.completeDelivery(event.DeliveryID)
+		return false
+	}
+}
+
+// UseBroker publishes notifying events through broker instead of handling them
+// locally, and notifies this instance's devices for every event the broker delivers
+func (w *WebhookHandler) UseBroker(broker services.EventBroker) {
+	w.broker = broker
+	broker.Subscribe(func(event *models.WebhookEvent) {
+		if count, err := w.deviceStore.Count(); err == nil && count == 0 {
+			return
+		}
+		w.notify(context.Background(), event)
+	})
+}
+
+// EnableDeviceThrottle limits each device to one push per interval; events in
+// between are delivered as a single summary push
+func (w *WebhookHandler) EnableDeviceThrottle(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if interval <= 0 {
+		w.throttle = nil
+		return
+	}
+	if w.throttle != nil && w.throttle.Interval() == interval {
+		return
+	}
+	w.throttle = services.NewDeviceThrottle(interval, w.sendSummary)
+}
+
+// sendSummary pushes a summary of events that were held back for a device
+func (w *WebhookHandler) sendSummary(device models.Device, event *models.WebhookEvent) {
+	if !w.NotificationsEnabled() {
+		return
+	}
+	if err := w.sendToDevice(context.Background(), w.withBadge(device), event); err != nil {
+		log.Printf("Error sending summary push notification: %v", err)
+	}
+}
+
+// sendToDevice sends one notification through the device's platform service
+func (w *WebhookHandler) sendToDevice(ctx context.Context, device models.Device, event *models.WebhookEvent) error {
+	if device.Platform != services.PlatformAndroid {
+		return w.apnsService.SendNotification(ctx, device, event)
+	}
+	if w.fcmService == nil {
+		return fmt.Errorf("FCM is not configured")
+	}
+	return w.fcmService.SendNotification(ctx, device, event)
+}
+
+// broadcast sends a push notification for event to all registered devices
+func (w *WebhookHandler) broadcast(ctx context.Context, event *models.WebhookEvent) {
+	// Events already queued (coalesced, async or from the broker) are dropped too
+	if !w.NotificationsEnabled() {
+		log.Printf("Skipping notification: notifications are disabled")
+		return
+	}
+
+	devices, err := w.deviceStore.List()
+	if err != nil {
+		w.internalErrors.Inc()
+		log.Printf("Error loading registered devices: %v", err)
+		return
+	}
+
+	recipients := w.deliverableNow(services.FilterDevices(devices, event), event)
+	w.mu.RLock()
+	canaryDelay := w.canaryDelay
+	w.mu.RUnlock()
+	if len(recipients) == 0 {
+		log.Printf("Skipping notification: no devices to notify now for event %s", event.EventType)
+		return
+	}
+
+	for i := range recipients {
+		if !recipients[i].Silent {
+			recipients[i] = w.withBadge(recipients[i])
+		}
+	}
+
+	log.Printf("Sending push notification for event: %s", event.EventType)
+	if event.RepositoryName != "" {
+		w.repoStats.Record(event.RepositoryName, time.Now())
+	}
+
+	var canaries, others []models.Device
+	for _, device := range recipients {
+		if device.Canary {
+			canaries = append(canaries, device)
+		} else {
+			others = append(others, device)
+		}
+	}
+	if len(canaries) == 0 {
+		w.sendToPlatforms(ctx, others, event)
+		return
+	}
+
+	log.Printf("🐤 Notifying %d canary devices first", len(canaries))
+	w.sendToPlatforms(ctx, canaries, event)
+	if len(others) == 0 {
+		return
+	}
+	if canaryDelay <= 0 {
+		w.sendToPlatforms(ctx, others, event)
+		return
+	}
+	log.Printf("Notifying %d other devices in %s", len(others), canaryDelay)
+	time.AfterFunc(canaryDelay, func() {
+		// The originating request has completed by then
+		w.sendToPlatforms(context.Background(), others, event)
+	})
+}
+
+// deliverableNow applies the per-device delivery gates (business hours, delivery
+// schedules, quiet hours and the throttle) and returns the devices to notify now.
+// Devices held back are queued for a summary push where configured.
+func (w *WebhookHandler) deliverableNow(recipients []models.Device, event *models.WebhookEvent) []models.Device {
+	w.mu.RLock()
+	throttle := w.throttle
+	quietMode, quietQueue := w.quietMode, w.quietQueue
+	businessHours := w.businessHours
+	w.mu.RUnlock()
+
+	if businessHours != nil {
+		if open, closed := businessHours.NextOpen(time.Now()); closed {
+			for _, device := range recipients {
+				w.afterHours.Hold(device, event, open)
+			}
+			if len(recipients) > 0 {
+				log.Printf("Deferring notification for event %s to %d devices until business hours begin", event.EventType, len(recipients))
+			}
+			return nil
+		}
+	}
+	recipients = scheduledRecipients(w.scheduled, recipients, event)
+	recipients = quietRecipients(quietMode, quietQueue, recipients, event)
+	if throttle != nil {
+		recipients = throttleRecipients(throttle, recipients, event)
+	}
+	return recipients
+}
+
+// sendToPlatforms sends the event to iOS devices through APNs and Android
+// devices through FCM, in parallel
+func (w *WebhookHandler) sendToPlatforms(ctx context.Context, recipients []models.Device, event *models.WebhookEvent) {
+	var iosDevices, androidDevices []models.Device
+	for _, device := range recipients {
+		if device.Platform == services.PlatformAndroid {
+			androidDevices = append(androidDevices, device)
+		} else {
+			iosDevices = append(iosDevices, device)
+		}
+	}
+	if len(androidDevices) > 0 && w.fcmService == nil {
+		log.Printf("Skipping %d Android devices: FCM is not configured", len(androidDevices))
+		androidDevices = nil
+	}
+
+	// Send to both platforms in parallel
+	var wg sync.WaitGroup
+	send := func(platform string, devices []models.Device, sendBroadcast func(context.Context, []models.Device, *models.WebhookEvent) error) {
+		defer wg.Done()
+		if err := sendBroadcast(ctx, devices, event); err != nil {
+			log.Printf("Error sending %s push notifications: %v", platform, err)
+			if w.retries != nil {
+				w.retries.Add(devices, event, err)
+			}
+			// Don't return error to GitHub - we still processed the webhook successfully
+		} else {
+			log.Printf("Successfully sent %s push notifications to %d devices", platform, len(devices))
+		}
+	}
+	if len(iosDevices) > 0 {
+		wg.Add(1)
+		go send("APNs", iosDevices, w.apnsService.SendBroadcast)
+	}
+	if len(androidDevices) > 0 {
+		wg.Add(1)
+		go send("FCM", androidDevices, w.fcmService.SendBroadcast)
+	}
+	wg.Wait()
+}
+
+// withBadge increments the device's unread count and returns the device carrying the new badge
+func (w *WebhookHandler) withBadge(device models.Device) models.Device {
+	badge, err := w.deviceStore.IncrementBadge(device.Token)
+	if err != nil {
+		log.Printf("Error updating badge for device %s: %v", services.MaskToken(device.Token), err)
+		return device
+	}
+	device.Badge = badge
+	return device
+}
+
+// scheduledRecipients holds the event for devices with a delivery schedule
+// until their next delivery time and returns the devices to notify now
+func scheduledRecipients(queue *services.HoldQueue, devices []models.Device, event *models.WebhookEvent) []models.Device {
+	now := time.Now()
+	var recipients []models.Device
+	for _, device := range devices {
+		if next, scheduled := services.NextDelivery(device.Schedule, now); scheduled {
+			queue.Hold(device, event, next)
+			continue
+		}
+		recipients = append(recipients, device)
+	}
+	return recipients
+}
+
+// quietRecipients applies each device's quiet hours: devices in quiet hours are
+// dropped or marked silent per mode, and their events queued for a summary when
+// a queue is configured
+func quietRecipients(mode string, queue *services.HoldQueue, devices []models.Device, event *models.WebhookEvent) []models.Device {
+	now := time.Now()
+	var recipients []models.Device
+	for _, device := range devices {
+		until, quiet := services.QuietUntil(device.QuietHours, now)
+		if !quiet {
+			recipients = append(recipients, device)
+			continue
+		}
+
+		if queue != nil {
+			queue.Hold(device, event, until)
+		}
+		if mode == services.QuietHoursSilent {
+			device.Silent = true
+			recipients = append(recipients, device)
+		}
+	}
+	return recipients
+}
+
+// throttleRecipients returns the devices that may be pushed now; the rest receive a summary later
+func throttleRecipients(throttle *services.DeviceThrottle, devices []models.Device, event *models.WebhookEvent) []models.Device {
+	var allowed []models.Device
+	for _, device := range devices {
+		if throttle.Allow(device, event) {
+			allowed = append(allowed, device)
+		}
+	}
+	return allowed
 }
 
 // RegisterDevice registers a device token for push notifications
@@ -105,7 +820,19 @@ func (w *WebhookHandler) RegisterDevice(rw http.ResponseWriter, req *http.Reques
 	}
 
 	var requestBody struct {
-		DeviceToken string `json:"device_token"`
+		DeviceToken    string                   `json:"device_token"`
+		TopicSuffix    string                   `json:"topic_suffix"`
+		Repositories   []string                 `json:"repositories"`
+		Organizations  []string                 `json:"organizations"`
+		IncludeAuthors []string                 `json:"include_authors"`
+		ExcludeAuthors []string                 `json:"exclude_authors"`
+		Paths          []string                 `json:"paths"`
+		QuietHours     *models.QuietHours       `json:"quiet_hours"`
+		Schedule       *models.DeliverySchedule `json:"schedule"`
+		Canary         bool                     `json:"canary"`
+		PayloadVersion int                      `json:"payload_version"`
+		Platform       string                   `json:"platform"`
+		AppAttest      *services.AppAttestProof `json:"app_attest"`
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
@@ -114,28 +841,104 @@ func (w *WebhookHandler) RegisterDevice(rw http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	deviceToken := strings.TrimSpace(requestBody.DeviceToken)
-	if deviceToken == "" {
-		http.Error(rw, "Device token required", http.StatusBadRequest)
+	newDevice := models.Device{
+		Token:          requestBody.DeviceToken,
+		TopicSuffix:    requestBody.TopicSuffix,
+		Repositories:   requestBody.Repositories,
+		Organizations:  requestBody.Organizations,
+		IncludeAuthors: requestBody.IncludeAuthors,
+		ExcludeAuthors: requestBody.ExcludeAuthors,
+		Paths:          requestBody.Paths,
+		QuietHours:     requestBody.QuietHours,
+		Schedule:       requestBody.Schedule,
+		Canary:         requestBody.Canary,
+		PayloadVersion: requestBody.PayloadVersion,
+		Platform:       requestBody.Platform,
+		RegisteredAt:   time.Now().UTC(),
+	}
+	if err := validateDevice(&newDevice); err != nil {
+		http.Error(rw, fmt.Sprintf("Invalid registration: %v", err), http.StatusBadRequest)
 		return
 	}
+	deviceToken := newDevice.Token
 
-	// Check if device token already exists
-	for _, token := range w.deviceTokens {
-		if token == deviceToken {
-			log.Printf("Device token already registered: %s", maskToken(deviceToken))
-			rw.WriteHeader(http.StatusOK)
-			fmt.Fprintf(rw, `{"status": "already_registered"}`)
+	if w.attestation != nil {
+		if err := w.attestation.VerifyRegistration(deviceToken, requestBody.AppAttest); err != nil {
+			log.Printf("Rejecting registration of %s: %v", services.MaskToken(deviceToken), err)
+			http.Error(rw, "App Attest verification failed", http.StatusForbidden)
 			return
 		}
 	}
 
-	// Add the device token
-	w.deviceTokens = append(w.deviceTokens, deviceToken)
-	log.Printf("Registered new device token: %s", maskToken(deviceToken))
+	// Add or update the device; an existing token counts as success
+	created, err := w.deviceStore.Upsert(newDevice)
+	if err != nil {
+		log.Printf("Error registering device token %s: %v", services.MaskToken(deviceToken), err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	rw.WriteHeader(http.StatusOK)
-	fmt.Fprintf(rw, `{"status": "registered", "total_devices": %d}`, len(w.deviceTokens))
+	if !created {
+		log.Printf("Device token already registered: %s", services.MaskToken(deviceToken))
+		w.writeSignedResponse(rw, http.StatusOK, `{"status": "already_registered"}`)
+		return
+	}
+
+	totalDevices, _ := w.deviceStore.Count()
+	log.Printf("Registered new device token: %s", services.MaskToken(deviceToken))
+
+	w.mu.RLock()
+	welcomePush := w.welcomePush
+	w.mu.RUnlock()
+	if welcomePush {
+		// Don't hold up the registration response on APNs
+		go w.sendWelcome(newDevice)
+	}
+
+	w.writeSignedResponse(rw, http.StatusOK, fmt.Sprintf(`{"status": "registered", "total_devices": %d}`, totalDevices))
+}
+
+// validateDevice normalizes a device's token, platform and topic suffix and checks
+// its settings, so registrations and imports accept the same devices
+func validateDevice(device *models.Device) error {
+	device.Token = strings.TrimSpace(device.Token)
+	if device.Token == "" {
+		return errors.New("device token required")
+	}
+	if strings.ContainsAny(device.Token, " \t\r\n") || strings.Contains(device.Token, "...") || device.Token == "***" {
+		return errors.New("malformed device token")
+	}
+
+	device.Platform = strings.ToLower(strings.TrimSpace(device.Platform))
+	if device.Platform == "" {
+		device.Platform = services.PlatformIOS
+	}
+	if device.Platform != services.PlatformIOS && device.Platform != services.PlatformAndroid {
+		return fmt.Errorf("unsupported platform %q", device.Platform)
+	}
+
+	device.TopicSuffix = strings.TrimSpace(device.TopicSuffix)
+	if !services.IsValidTopicSuffix(device.TopicSuffix) {
+		return fmt.Errorf("unsupported topic suffix %q", device.TopicSuffix)
+	}
+
+	if err := services.ValidatePathPatterns(device.Paths); err != nil {
+		return fmt.Errorf("paths: %w", err)
+	}
+	if device.QuietHours != nil {
+		if err := services.ValidateQuietHours(device.QuietHours); err != nil {
+			return fmt.Errorf("quiet hours: %w", err)
+		}
+	}
+	if device.Schedule != nil {
+		if err := services.ValidateSchedule(device.Schedule); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+	}
+	if device.PayloadVersion < 0 || device.PayloadVersion > services.PayloadVersionEnriched {
+		return fmt.Errorf("unsupported payload version %d", device.PayloadVersion)
+	}
+	return nil
 }
 
 // UnregisterDevice removes a device token from push notifications
@@ -161,46 +964,178 @@ func (w *WebhookHandler) UnregisterDevice(rw http.ResponseWriter, req *http.Requ
 	}
 
 	// Remove the device token
-	for i, token := range w.deviceTokens {
-		if token == deviceToken {
-			w.deviceTokens = append(w.deviceTokens[:i], w.deviceTokens[i+1:]...)
-			log.Printf("Unregistered device token: %s", maskToken(deviceToken))
-			rw.WriteHeader(http.StatusOK)
-			fmt.Fprintf(rw, `{"status": "unregistered", "total_devices": %d}`, len(w.deviceTokens))
-			return
-		}
+	removed, err := w.deviceStore.Remove(deviceToken)
+	if err != nil {
+		log.Printf("Error unregistering device token %s: %v", services.MaskToken(deviceToken), err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	log.Printf("Device token not found for unregistration: %s", maskToken(deviceToken))
-	rw.WriteHeader(http.StatusOK)
-	fmt.Fprintf(rw, `{"status": "not_found"}`)
+	if removed {
+		totalDevices, _ := w.deviceStore.Count()
+		log.Printf("Unregistered device token: %s", services.MaskToken(deviceToken))
+		w.writeSignedResponse(rw, http.StatusOK, fmt.Sprintf(`{"status": "unregistered", "total_devices": %d}`, totalDevices))
+		return
+	}
+
+	log.Printf("Device token not found for unregistration: %s", services.MaskToken(deviceToken))
+	w.writeSignedResponse(rw, http.StatusOK, `{"status": "not_found"}`)
 }
 
-// GetStatus returns the current status of the webhook handler
-func (w *WebhookHandler) GetStatus(rw http.ResponseWriter, req *http.Request) {
+// ClearBadge resets a device's unread count once the app has shown its notifications
+func (w *WebhookHandler) ClearBadge(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestBody struct {
+		DeviceToken string `json:"device_token"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	deviceToken := strings.TrimSpace(requestBody.DeviceToken)
+	if deviceToken == "" {
+		http.Error(rw, "Device token required", http.StatusBadRequest)
+		return
+	}
+
+	cleared, err := w.deviceStore.ClearBadge(deviceToken)
+	if err != nil {
+		log.Printf("Error clearing badge for device %s: %v", services.MaskToken(deviceToken), err)
+		http.Error(rw, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !cleared {
+		w.writeSignedResponse(rw, http.StatusOK, `{"status": "not_found"}`)
+		return
+	}
+	w.writeSignedResponse(rw, http.StatusOK, `{"status": "cleared", "badge": 0}`)
+}
+
+// GetChanges returns the markdown files added, modified and removed by a delivery
+// (GET /webhook/changes?delivery_id=...). Only registered devices may ask, by
+// sending their token in the X-Device-Token header.
+func (w *WebhookHandler) GetChanges(rw http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	status := struct {
-		Status           string   `json:"status"`
-		RegisteredDevices int     `json:"registered_devices"`
-		SupportedEvents   []string `json:"supported_events"`
+	if !w.isRegistered(req.Header.Get("X-Device-Token")) {
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	deliveryID := req.URL.Query().Get("delivery_id")
+	if deliveryID == "" {
+		http.Error(rw, "delivery_id required", http.StatusBadRequest)
+		return
+	}
+
+	changes, ok := w.deliveries.Changes(deliveryID)
+	if !ok {
+		http.Error(rw, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	response := struct {
+		DeliveryID string `json:"delivery_id"`
+		services.MarkdownChanges
 	}{
-		Status:           "healthy",
-		RegisteredDevices: len(w.deviceTokens),
-		SupportedEvents:   w.githubService.GetWebhookEvents(),
+		DeliveryID:      deliveryID,
+		MarkdownChanges: changes,
 	}
 
 	rw.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(rw).Encode(status)
+	json.NewEncoder(rw).Encode(response)
 }
 
-// maskToken masks a device token for logging
-func maskToken(token string) string {
-	if len(token) < 8 {
-		return "***"
+// isRegistered reports whether token belongs to a registered device
+func (w *WebhookHandler) isRegistered(token string) bool {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return false
+	}
+
+	devices, err := w.deviceStore.List()
+	if err != nil {
+		log.Printf("Error loading registered devices: %v", err)
+		return false
+	}
+	for _, device := range devices {
+		if device.Token == token {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRules returns each event type with the actions and conditions that make it notify
+func (w *WebhookHandler) GetRules(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rules := struct {
+		Rules []services.NotificationRule `json:"rules"`
+	}{
+		Rules: w.githubService.NotificationRules(),
 	}
-	return token[:4] + "..." + token[len(token)-4:]
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(rules)
+}
+
+// GetStatus returns the current status of the webhook handler
+func (w *WebhookHandler) GetStatus(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceCount, err := w.deviceStore.Count()
+	if err != nil {
+		log.Printf("Error counting registered devices: %v", err)
+	}
+
+	// The ETag covers the handler's state only; the counters change with every
+	// delivery and would make If-None-Match useless
+	type handlerState struct {
+		Status            string                `json:"status"`
+		RegisteredDevices int                   `json:"registered_devices"`
+		SupportedEvents   []string              `json:"supported_events"`
+		APNsCircuit       services.CircuitState `json:"apns_circuit"`
+		APNsThrottle      services.CircuitState `json:"apns_throttle"`
+		Notifications     bool                  `json:"notifications_enabled"`
+		DeviceStore       string                `json:"device_store"`
+	}
+	status := struct {
+		handlerState
+		InternalErrors int64            `json:"internal_errors"` // acknowledged deliveries that failed internally
+		Metrics        metrics.Snapshot `json:"metrics"`
+	}{
+		handlerState: handlerState{
+			Status:            "healthy",
+			RegisteredDevices: deviceCount,
+			SupportedEvents:   w.githubService.GetWebhookEvents(),
+			APNsCircuit:       w.apnsService.CircuitState(),
+			APNsThrottle:      w.apnsService.ThrottleState(),
+			Notifications:     w.NotificationsEnabled(),
+			DeviceStore:       "ok",
+		},
+		InternalErrors: w.internalErrors.Value(),
+		Metrics:        metrics.Read(),
+	}
+	if store, ok := w.deviceStore.(interface{ Degraded() bool }); ok && store.Degraded() {
+		status.DeviceStore = "degraded"
+	}
+
+	writeJSONWithETagOf(rw, req, status, status.handlerState)
 }
\ No newline at end of file
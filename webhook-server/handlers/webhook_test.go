@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"mdtalkman-webhook/services"
+)
+
+// flakyCountStore is an in-memory device store whose Count fails the first failures times
+type flakyCountStore struct {
+	*services.MemoryDeviceStore
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakyCountStore) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		return 0, errors.New("device store unavailable")
+	}
+	return s.MemoryDeviceStore.Count()
+}
+
+func TestRedeliveryAfterInternalErrorIsProcessed(t *testing.T) {
+	store := &flakyCountStore{MemoryDeviceStore: services.NewMemoryDeviceStore(), failures: 1}
+	w, pusher := newTestPipeline(t, store)
+	w.SetRetryOnInternalError(true)
+	body := pushPayload(t, "README.md")
+
+	if rec := deliver(w, "push", "delivery-1", body); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first attempt status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if got := pusher.count(); got != 0 {
+		t.Fatalf("pushes after the failed attempt = %d, want 0", got)
+	}
+
+	rec := deliver(w, "push", "delivery-1", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("redelivery status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := pusher.count(); got != 1 {
+		t.Errorf("pushes after the redelivery = %d, want 1", got)
+	}
+
+	// Once notified, further redeliveries are ignored
+	deliver(w, "push", "delivery-1", body)
+	if got := pusher.count(); got != 1 {
+		t.Errorf("pushes after a repeated redelivery = %d, want 1", got)
+	}
+}
+
+func TestRedeliveryAfterParseErrorIsProcessed(t *testing.T) {
+	w, pusher := newTestPipeline(t, services.NewMemoryDeviceStore())
+
+	if rec := deliver(w, "push", "delivery-1", []byte("{not json")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed delivery status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := deliver(w, "push", "delivery-1", pushPayload(t, "README.md")); rec.Code != http.StatusOK {
+		t.Fatalf("redelivery status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := pusher.count(); got != 1 {
+		t.Errorf("pushes = %d, want 1", got)
+	}
+}
+
+// fakeAttestation is an AttestationVerifier accepting the proofs of one key ID
+type fakeAttestation struct {
+	keyID string
+}
+
+func (f *fakeAttestation) VerifyRegistration(deviceToken string, proof *services.AppAttestProof) error {
+	if proof == nil || proof.KeyID != f.keyID {
+		return errors.New("invalid App Attest proof")
+	}
+	return nil
+}
+
+// register posts a registration body to the handler and returns the response
+func register(w *WebhookHandler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/register", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	w.RegisterDevice(rec, req)
+	return rec
+}
+
+func TestRegisterDeviceRequiresAttestation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "valid proof", body: `{"device_token": "fedcba9876543210", "app_attest": {"key_id": "trusted", "assertion": "AA=="}}`, wantStatus: http.StatusOK},
+		{name: "invalid proof", body: `{"device_token": "fedcba9876543210", "app_attest": {"key_id": "forged", "assertion": "AA=="}}`, wantStatus: http.StatusForbidden},
+		{name: "missing proof", body: `{"device_token": "fedcba9876543210"}`, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := services.NewMemoryDeviceStore()
+			w := NewWebhookHandler(services.NewGitHubService(testWebhookSecret), services.NewAPNsServiceWithPusher(&recordingPusher{}, "com.example.mdtalkman", true), store)
+			w.SetAttestationVerifier(&fakeAttestation{keyID: "trusted"})
+
+			if rec := register(w, tt.body); rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			wantDevices := 0
+			if tt.wantStatus == http.StatusOK {
+				wantDevices = 1
+			}
+			if count, _ := store.Count(); count != wantDevices {
+				t.Errorf("registered devices = %d, want %d", count, wantDevices)
+			}
+		})
+	}
+}
+
+func TestDebugLoggingSkipsUnverifiedPayloads(t *testing.T) {
+	w, _ := newTestPipeline(t, services.NewMemoryDeviceStore())
+	w.SetDebugLogging(true, nil)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	body := pushPayload(t, "README.md")
+	if rec := deliverSigned(w, "wrong-secret", "push", "forged-delivery", body); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("forged delivery status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if strings.Contains(logs.String(), "octocat/docs") {
+		t.Errorf("payload of an unverified delivery was logged:\n%s", logs.String())
+	}
+
+	if rec := deliver(w, "push", "signed-delivery", body); rec.Code != http.StatusOK {
+		t.Fatalf("signed delivery status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(logs.String(), "octocat/docs") {
+		t.Errorf("payload of a verified delivery was not logged:\n%s", logs.String())
+	}
+}
+
+// getStatus requests the status with If-None-Match set to etag, if any
+func getStatus(w *WebhookHandler, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/webhook/status", nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	w.GetStatus(rec, req)
+	return rec
+}
+
+func TestGetStatusETag(t *testing.T) {
+	w, _ := newTestPipeline(t, services.NewMemoryDeviceStore())
+
+	first := getStatus(w, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d with ETag %q, want %d with an ETag", first.Code, etag, http.StatusOK)
+	}
+
+	// Deliveries move the metrics but leave the device count alone
+	if rec := deliver(w, "push", "status-delivery", pushPayload(t, "README.md")); rec.Code != http.StatusOK {
+		t.Fatalf("delivery status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := getStatus(w, etag); rec.Code != http.StatusNotModified {
+		t.Errorf("status after a delivery = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	if rec := register(w, `{"device_token": "fedcba9876543210fedcba9876543210"}`); rec.Code != http.StatusOK {
+		t.Fatalf("registration status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec := getStatus(w, etag)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status after a registration = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), `"registered_devices":2`) {
+		t.Errorf("status body = %s, want 2 registered devices", rec.Body)
+	}
+}
+
+func TestEventTypeNormalization(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+	}{
+		{name: "canonical", eventType: "push"},
+		{name: "padded", eventType: " Push "},
+		{name: "upper case", eventType: "PUSH"},
+		{name: "mixed case with tab", eventType: "\tpUsH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, pusher := newTestPipeline(t, services.NewMemoryDeviceStore())
+			// Configured event types are normalized the same way as the header
+			w.apnsService.SetEventTopics(map[string]string{" PUSH ": "com.example.docs"})
+
+			if rec := deliver(w, tt.eventType, "normalize-"+tt.name, pushPayload(t, "README.md")); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := pusher.count(); got != 1 {
+				t.Fatalf("pushes = %d, want 1: %q wasn't treated as push", got, tt.eventType)
+			}
+			if topic := pusher.pushes[0].Topic; topic != "com.example.docs" {
+				t.Errorf("topic = %q, want the configured push topic com.example.docs", topic)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"mdtalkman-webhook/handlers"
 	"mdtalkman-webhook/services"
@@ -15,92 +21,155 @@ import (
 func main() {
 	log.Println("🚀 Starting MD TalkMan Webhook Server...")
 
-	// Load configuration from environment variables
-	config := loadConfig()
+	// Load configuration from environment variables (and ENV_FILE and CONFIG_FILE, if set)
+	loadEnvFileIfSet()
+	if err := loadConfigFiles(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("❌ Invalid configuration:\n%v", err)
+	}
+	if config.ValidateOnly {
+		if err := validateCredentials(config); err != nil {
+			log.Fatalf("❌ Invalid credentials:\n%v", err)
+		}
+		log.Println("✅ Configuration and credentials are valid")
+		os.Exit(0)
+	}
 	
 	// Initialize services
 	githubService := services.NewGitHubService(config.WebhookSecret)
-	
-	// Initialize APNs service (gracefully handle missing credentials)
-	var apnsService *services.APNsService
-	var err error
-	
-	if config.APNsKeyPath != "" && config.APNsKeyID != "" && config.APNsTeamID != "" {
-		// Token-based authentication (recommended)
-		log.Println("🔑 Initializing APNs with token-based authentication...")
-		apnsService, err = services.NewAPNsServiceWithToken(
-			config.APNsKeyPath,
-			config.APNsKeyID,
-			config.APNsTeamID,
-			config.BundleID,
-			config.IsDevelopment,
-		)
-	} else if config.APNsCertPath != "" {
-		// Certificate-based authentication (legacy)
-		log.Println("🔑 Initializing APNs with certificate-based authentication...")
-		apnsService, err = services.NewAPNsService(
-			config.APNsCertPath,
-			config.BundleID,
-			config.IsDevelopment,
-		)
-	} else {
-		// No APNs credentials provided - use simplified mode
-		log.Println("⚠️  No APNs credentials provided - running in simplified mode")
-		log.Println("📱 Push notifications will be logged instead of sent")
-		apnsService, err = services.NewAPNsService(
-			"", // No cert path
-			config.BundleID,
-			config.IsDevelopment,
-		)
+	githubService.SetWebhookSecrets(config.WebhookSecrets)
+	if config.SecretsDir != "" {
+		secrets, err := services.LoadSecretsDir(config.SecretsDir)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		githubService.SetDirectorySecrets(secrets)
+		stopWatching := services.WatchSecretsDir(config.SecretsDir, secretsDirInterval, secrets, githubService.SetDirectorySecrets)
+		defer stopWatching()
+		log.Printf("🔑 Loaded %d webhook secrets from %s", len(secrets), config.SecretsDir)
+	}
+	if config.GitHubAppID != "" {
+		apiClient, err := services.NewGitHubAPIClient(config.GitHubAppID, config.GitHubAppKeyPath, config.GitHubAPIBaseURL)
+		if err != nil {
+			log.Fatalf("❌ Failed to initialize GitHub API client: %v", err)
+		}
+		githubService.UseAPIClient(apiClient, config.TopicCacheTTL)
+		log.Printf("🐙 Looking up repository topics as GitHub App %s at %s", config.GitHubAppID, config.GitHubAPIBaseURL)
 	}
 	
+	// Initialize APNs service (gracefully handle missing credentials)
+	apnsService, err := newAPNsService(config, config.BundleID)
 	if err != nil {
 		log.Fatalf("❌ Failed to initialize APNs service: %v", err)
 	}
-	
-	log.Printf("✅ APNs service initialized (development: %t)", config.IsDevelopment)
+
+	var fcmService *services.FCMService
+	if config.FCMCredentialsPath != "" {
+		fcmService, err = services.NewFCMService(config.FCMCredentialsPath)
+		if err != nil {
+			log.Fatalf("❌ Failed to initialize FCM service: %v", err)
+		}
+	}
 
 	// Initialize handlers
-	webhookHandler := handlers.NewWebhookHandler(githubService, apnsService)
-	healthHandler := handlers.NewHealthHandler()
+	deviceStore, closeDeviceStore := newDeviceStore(config)
+	defer closeDeviceStore()
+	webhookHandler := newWebhookHandler(config, githubService, apnsService, deviceStore, fcmService)
+	if err := useAppAttest(config, webhookHandler, config.BundleID, ""); err != nil {
+		log.Fatalf("❌ Failed to initialize App Attest: %v", err)
+	}
+	applyReloadableConfig(config, githubService, apnsService, webhookHandler)
+
+	// Deliveries pass the same checks whether they're for the default app or one
+	// hosted under /app/{id}/
+	webhookMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return handlers.RequireHTTPS(config.RequireHTTPS, config.TrustProxy,
+			handlers.RequireHeaders(config.RequiredHeaders,
+				handlers.RequireHookTarget(config.HookTargetType, config.HookTargetIDs, next)))
+	}
+
+	// Registrations share one rate limit whichever app they're for
+	registerLimiter := handlers.NewRateLimiter(config.RegisterRateLimit, config.RegisterRateBurst)
+	registrationMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return handlers.RateLimit(registerLimiter, config.TrustProxy, next)
+	}
+
+	// Logical apps hosted under /app/{id}/, each with its own secret, device
+	// store and (when its bundle ID differs) APNs service
+	appRouter := handlers.NewAppRouter(webhookMiddleware, registrationMiddleware)
+	var apps []hostedApp
+	for id, secret := range config.AppSecrets {
+		app := hostedApp{githubService: services.NewGitHubService(secret), apnsService: apnsService}
+		if bundleID := config.AppBundleIDs[id]; bundleID != "" && bundleID != config.BundleID {
+			if app.apnsService, err = newAPNsService(config, bundleID); err != nil {
+				log.Fatalf("❌ Failed to initialize APNs service for app %s: %v", id, err)
+			}
+		}
+		appStore, closeAppStore := newDeviceStore(config)
+		defer closeAppStore()
+		app.webhookHandler = newWebhookHandler(config, app.githubService, app.apnsService, appStore, fcmService)
+		bundleID := config.AppBundleIDs[id]
+		if bundleID == "" {
+			bundleID = config.BundleID
+		}
+		if err := useAppAttest(config, app.webhookHandler, bundleID, id); err != nil {
+			log.Fatalf("❌ Failed to initialize App Attest for app %s: %v", id, err)
+		}
+		applyReloadableConfig(config, app.githubService, app.apnsService, app.webhookHandler)
+		closeAppDeliveryServices := useDeliveryServices(config, app.webhookHandler, app.apnsService, appStore, id)
+		defer closeAppDeliveryServices()
+		appRouter.Add(id, app.webhookHandler)
+		apps = append(apps, app)
+		log.Printf("🧩 Hosting app %s at /app/%s/webhook/github", id, id)
+	}
+
+	closeDeliveryServices := useDeliveryServices(config, webhookHandler, apnsService, deviceStore, "")
+	defer closeDeliveryServices()
+	healthHandler := handlers.NewHealthHandler(apnsService, deviceStore)
+	adminHandler := handlers.NewAdminHandler(githubService, apnsService, webhookHandler, deviceStore, config.IsDevelopment)
 
 	// Set up HTTP routes
 	mux := http.NewServeMux()
 
 	// Webhook endpoints
-	mux.HandleFunc("/webhook/github", webhookHandler.HandleGitHubWebhook)
-	mux.HandleFunc("/webhook/register", webhookHandler.RegisterDevice)
-	mux.HandleFunc("/webhook/unregister", webhookHandler.UnregisterDevice)
+	mux.HandleFunc("/webhook/github", webhookMiddleware(webhookHandler.HandleGitHubWebhook))
+	mux.HandleFunc("/webhook/register", registrationMiddleware(webhookHandler.RegisterDevice))
+	mux.HandleFunc("/webhook/unregister", registrationMiddleware(webhookHandler.UnregisterDevice))
+	mux.HandleFunc("/webhook/badge/clear", webhookHandler.ClearBadge)
 	mux.HandleFunc("/webhook/status", webhookHandler.GetStatus)
+	mux.HandleFunc("/webhook/rules", webhookHandler.GetRules)
+	mux.HandleFunc("/webhook/changes", webhookHandler.GetChanges)
+	mux.HandleFunc("/app/", handlers.RequireHTTPS(config.RequireHTTPS, config.TrustProxy, appRouter.ServeHTTP))
+
+	// Admin endpoints (require ADMIN_TOKEN)
+	mux.HandleFunc("/admin/verify-signature", handlers.RequireAdminToken(config.AdminToken, adminHandler.VerifySignature))
+	mux.HandleFunc("/admin/preview", handlers.RequireAdminToken(config.AdminToken, adminHandler.PreviewNotification))
+	mux.HandleFunc("/admin/devices", handlers.RequireAdminToken(config.AdminToken, adminHandler.ListDevices))
+	mux.HandleFunc("/admin/devices/unsubscribe", handlers.RequireAdminToken(config.AdminToken, adminHandler.UnsubscribeRepository))
+	mux.HandleFunc("/admin/export", handlers.RequireAdminToken(config.AdminToken, adminHandler.ExportDevices))
+	mux.HandleFunc("/admin/import", handlers.RequireAdminToken(config.AdminToken, adminHandler.ImportDevices))
+	mux.HandleFunc("/admin/stats", handlers.RequireAdminToken(config.AdminToken, adminHandler.Stats))
+	mux.HandleFunc("/admin/repos/stats", handlers.RequireAdminToken(config.AdminToken, adminHandler.RepoStats))
+	mux.HandleFunc("/admin/notifications", handlers.RequireAdminToken(config.AdminToken, adminHandler.SetNotifications))
 
 	// Health check endpoints
-	mux.HandleFunc("/health", healthHandler.HealthCheck)
-	mux.HandleFunc("/ready", healthHandler.ReadinessCheck)
+	registerHealthRoutes(mux, healthHandler)
 
 	// Root endpoint
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-		fmt.Fprintf(w, `{
-	"service": "MD TalkMan Webhook Server",
-	"version": "1.0.0",
-	"endpoints": {
-		"webhook": "/webhook/github",
-		"register": "/webhook/register", 
-		"unregister": "/webhook/unregister",
-		"status": "/webhook/status",
-		"health": "/health",
-		"ready": "/ready"
-	}
-}`)
-	})
+	mux.HandleFunc("/", rootHandler(config.DiscloseEndpoints))
 
 	// Create HTTP server
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", config.Port),
-		Handler: mux,
+		Handler: handlers.WithTimeout(mux, config.HandlerTimeout),
 	}
 
 	// Start server in a goroutine
@@ -117,6 +186,24 @@ func main() {
 	log.Println("✅ MD TalkMan Webhook Server is running!")
 	log.Println("📝 Supported webhook events:", githubService.GetWebhookEvents())
 
+	// Reload configuration on SIGHUP without restarting the listener
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadOnSignal(hup, config, os.Args[1:], func(newConfig *Config) {
+		applyReloadableConfig(newConfig, githubService, apnsService, webhookHandler)
+		for _, app := range apps {
+			applyReloadableConfig(newConfig, app.githubService, app.apnsService, app.webhookHandler)
+		}
+		if newConfig.APNsKeyPath != "" {
+			// Pick up a rotated key; a failed reload keeps the current key
+			for _, service := range apnsServices(apnsService, apps) {
+				if err := service.ReloadAuthKey(newConfig.APNsKeyPath, newConfig.APNsKeyID, newConfig.APNsTeamID); err != nil {
+					log.Printf("❌ Failed to reload APNs key, keeping the current one: %v", err)
+				}
+			}
+		}
+	})
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -130,35 +217,665 @@ func main() {
 	log.Println("✅ Server stopped")
 }
 
-// Config holds all configuration for the webhook server
+// registerHealthRoutes serves the health and readiness checks, along with
+// the aliases Kubernetes and other tools probe by default
+func registerHealthRoutes(mux *http.ServeMux, healthHandler *handlers.HealthHandler) {
+	mux.HandleFunc("/health", healthHandler.HealthCheck)
+	mux.HandleFunc("/ready", healthHandler.ReadinessCheck)
+	mux.HandleFunc("/healthz", healthHandler.HealthCheck)
+	mux.HandleFunc("/readyz", healthHandler.ReadinessCheck)
+}
+
+// rootHandler answers the root endpoint, listing the service's version and
+// endpoints only when discloseEndpoints is set
+func rootHandler(discloseEndpoints bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if !discloseEndpoints {
+			// Don't help fingerprinting the service
+			fmt.Fprint(w, `{"status": "ok"}`)
+			return
+		}
+		fmt.Fprintf(w, `{
+	"service": "MD TalkMan Webhook Server",
+	"version": "1.0.0",
+	"endpoints": {
+		"webhook": "/webhook/github",
+		"register": "/webhook/register", 
+		"unregister": "/webhook/unregister",
+		"status": "/webhook/status",
+		"rules": "/webhook/rules",
+		"health": "/health",
+		"ready": "/ready"
+	}
+}`)
+	}
+}
+
+// reloadOnSignal reloads the configuration (with command-line flags args) each
+// time a signal arrives on hup and passes every valid one to apply. Invalid
+// configurations are logged and the current settings kept.
+func reloadOnSignal(hup <-chan os.Signal, config *Config, args []string, apply func(*Config)) {
+	for range hup {
+		log.Println("🔄 SIGHUP received - reloading configuration...")
+		loadEnvFileIfSet()
+		if err := loadConfigFiles(); err != nil {
+			log.Printf("❌ Failed to reload configuration: %v", err)
+			continue
+		}
+		newConfig, err := loadConfig(args)
+		if err != nil {
+			log.Printf("❌ Failed to reload configuration: %v", err)
+			continue
+		}
+		if err := newConfig.Validate(); err != nil {
+			log.Printf("❌ Invalid configuration, keeping current settings:\n%v", err)
+			continue
+		}
+		warnRestartRequired(config, newConfig)
+		apply(newConfig)
+		// Later reloads compare against what's now applied
+		config = newConfig
+		log.Println("✅ Configuration reloaded")
+	}
+}
+
+// hostedApp is a logical app served under /app/{id}/
+type hostedApp struct {
+	githubService  *services.GitHubService
+	apnsService    *services.APNsService
+	webhookHandler *handlers.WebhookHandler
+}
+
+// apnsServices returns the default APNs service and those of hosted apps with their own bundle ID
+func apnsServices(defaultService *services.APNsService, apps []hostedApp) []*services.APNsService {
+	result := []*services.APNsService{defaultService}
+	seen := map[*services.APNsService]bool{defaultService: true}
+	for _, app := range apps {
+		if !seen[app.apnsService] {
+			seen[app.apnsService] = true
+			result = append(result, app.apnsService)
+		}
+	}
+	return result
+}
+
+// newAPNsService creates the APNs service for bundleID from the configured
+// credentials, falling back to simplified mode (pushes are only logged) without them
+func newAPNsService(config *Config, bundleID string) (*services.APNsService, error) {
+	var apnsService *services.APNsService
+	var err error
+	if config.APNsKeyPath != "" && config.APNsKeyID != "" && config.APNsTeamID != "" && config.APNsLazyInit {
+		// Token-based authentication, with the client built once the key can be loaded
+		log.Println("🔑 Initializing APNs lazily with token-based authentication...")
+		apnsService = services.NewLazyAPNsServiceWithToken(
+			config.APNsKeyPath,
+			config.APNsKeyID,
+			config.APNsTeamID,
+			bundleID,
+			config.IsDevelopment,
+		)
+	} else if config.APNsKeyPath != "" && config.APNsKeyID != "" && config.APNsTeamID != "" {
+		// Token-based authentication (recommended)
+		log.Println("🔑 Initializing APNs with token-based authentication...")
+		apnsService, err = services.NewAPNsServiceWithToken(
+			config.APNsKeyPath,
+			config.APNsKeyID,
+			config.APNsTeamID,
+			bundleID,
+			config.IsDevelopment,
+		)
+	} else if config.APNsCertPath != "" {
+		// Certificate-based authentication (legacy)
+		log.Println("🔑 Initializing APNs with certificate-based authentication...")
+		apnsService, err = services.NewAPNsService(
+			config.APNsCertPath,
+			bundleID,
+			config.IsDevelopment,
+		)
+	} else {
+		// No APNs credentials provided - use simplified mode
+		log.Println("⚠️  No APNs credentials provided - running in simplified mode")
+		log.Println("📱 Push notifications will be logged instead of sent")
+		apnsService, err = services.NewAPNsService(
+			"", // No cert path
+			bundleID,
+			config.IsDevelopment,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("✅ APNs service initialized for %s (development: %t)", bundleID, config.IsDevelopment)
+	if !config.EnvironmentFallback {
+		apnsService.DisableEnvironmentFallback()
+	}
+	apnsService.SetCircuitBreaker(config.APNsBreakerThreshold, config.APNsBreakerCooldown)
+	apnsService.SetPoolSize(config.APNsPoolSize)
+	apnsService.RetryInitialization(config.APNsInitRetry)
+
+	return apnsService, nil
+}
+
+// newDeviceStore creates the configured device store and a function releasing it
+func newDeviceStore(config *Config) (services.DeviceStore, func()) {
+	var deviceStore services.DeviceStore
+	closeStore := func() {}
+	if config.DeviceStore == "memory-ttl" {
+		ttlStore := services.NewTTLMemoryStore(config.DeviceTTL)
+		closeStore = ttlStore.Close
+		deviceStore = ttlStore
+		log.Printf("🗂️  Devices expire %s after their last registration", config.DeviceTTL)
+	} else {
+		deviceStore = services.NewMemoryDeviceStore()
+	}
+	if config.DeviceCacheMaxAge > 0 {
+		// Keep notifying from the last known device list if the store briefly fails
+		deviceStore = services.NewCachingDeviceStore(deviceStore, config.DeviceCacheMaxAge)
+	}
+	return deviceStore, closeStore
+}
+
+// useAppAttest makes the handler require App Attest proofs from the app with
+// bundleID when REQUIRE_APP_ATTEST is set. A hosted app (appID set) keeps its
+// attested keys in its own file.
+func useAppAttest(config *Config, webhookHandler *handlers.WebhookHandler, bundleID, appID string) error {
+	if !config.RequireAppAttest {
+		return nil
+	}
+	verifier, err := services.NewAppAttestVerifier(config.APNsTeamID+"."+bundleID, config.AppAttestRootCA, config.IsDevelopment)
+	if err != nil {
+		return err
+	}
+	if config.AppAttestKeysPath != "" {
+		if err := verifier.PersistKeys(appFilePath(config.AppAttestKeysPath, appID)); err != nil {
+			return err
+		}
+	}
+	webhookHandler.SetAttestationVerifier(verifier)
+	log.Printf("🛡️  Requiring App Attest for registrations from %s", bundleID)
+	return nil
+}
+
+// validateCredentials loads every configured credential the way startup would,
+// for -validate-config, and reports all problems at once
+func validateCredentials(config *Config) error {
+	var errs []error
+	if config.APNsKeyPath != "" {
+		if err := services.ValidateAuthKey(config.APNsKeyPath, config.APNsKeyID, config.APNsTeamID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if config.APNsCertPath != "" && config.APNsKeyPath == "" {
+		errs = append(errs, errors.New("APNS_CERT_PATH is set, but certificate-based APNs is not supported yet; use APNS_KEY_PATH"))
+	}
+	if config.FCMCredentialsPath != "" {
+		if _, err := services.NewFCMService(config.FCMCredentialsPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if config.RequireAppAttest {
+		if _, err := services.NewAppAttestVerifier(config.APNsTeamID+"."+config.BundleID, config.AppAttestRootCA, config.IsDevelopment); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// journalCapacity is how many recent deliveries the delivery journal keeps
+const journalCapacity = 1000
+
+// secretsDirInterval is how often WEBHOOK_SECRETS_DIR is checked for changes
+const secretsDirInterval = 30 * time.Second
+
+// useDeliveryServices wires the event broker, token reconciler, retry queue and
+// delivery journal into webhookHandler as configured, replaying pending
+// deliveries. A hosted app (appID set) gets its own broker channel, retry queue
+// and journal file, so it never replays or retries another app's deliveries. The returned function releases them.
+func useDeliveryServices(config *Config, webhookHandler *handlers.WebhookHandler, apnsService *services.APNsService, deviceStore services.DeviceStore, appID string) func() {
+	var closers []func()
+	label := ""
+	if appID != "" {
+		label = fmt.Sprintf(" for app %s", appID)
+	}
+
+	// Fan events out to all instances when running more than one
+	if config.EventBrokerURL != "" {
+		channel := config.EventBrokerChannel
+		if appID != "" {
+			channel += ":" + appID
+		}
+		broker, err := services.NewRedisBroker(config.EventBrokerURL, channel)
+		if err != nil {
+			log.Fatalf("❌ Failed to connect to event broker%s: %v", label, err)
+		}
+		closers = append(closers, func() { broker.Close() })
+		webhookHandler.UseBroker(broker)
+		log.Printf("📡 Publishing events%s via Redis channel %s", label, channel)
+	}
+	if config.ReconcileInterval > 0 {
+		reconciler := services.NewTokenReconciler(apnsService, deviceStore, config.ReconcileInterval, config.ReconcileRate)
+		reconciler.Start()
+		closers = append(closers, reconciler.Stop)
+		log.Printf("🧹 Validating device tokens%s every %s", label, config.ReconcileInterval)
+	}
+	// Before replaying the journal, so replayed pushes that fail are retried too
+	if config.RetryMaxAttempts > 1 {
+		retries, err := services.OpenRetryQueue(appFilePath(config.RetryQueuePath, appID), config.RetryMaxAttempts, config.RetryBackoff)
+		if err != nil {
+			log.Fatalf("❌ Failed to open retry queue%s: %v", label, err)
+		}
+		webhookHandler.UseRetryQueue(retries)
+		log.Printf("🔁 Retrying failed pushes%s up to %d times", label, config.RetryMaxAttempts)
+	}
+	if config.JournalPath != "" {
+		journal, err := services.OpenDeliveryJournal(appFilePath(config.JournalPath, appID), journalCapacity)
+		if err != nil {
+			log.Fatalf("❌ Failed to open delivery journal%s: %v", label, err)
+		}
+		closers = append(closers, func() { journal.Close() })
+		webhookHandler.UseDeliveryJournal(journal)
+		if config.StartupReplayWindow > 0 {
+			replayed := webhookHandler.ReplayPending(config.StartupReplayWindow)
+			log.Printf("🔁 Replayed %d unnotified deliveries%s from the last %s", replayed, label, config.StartupReplayWindow)
+		}
+	}
+
+	return func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+}
+
+// appFilePath returns a hosted app's variant of a data file path, e.g.
+// journal-docs.jsonl for journal.jsonl and app docs; path itself for the
+// default app or when unset
+func appFilePath(path, appID string) string {
+	if path == "" || appID == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + appID + ext
+}
+
+// newWebhookHandler creates a webhook handler with the settings that require a restart
+func newWebhookHandler(config *Config, githubService *services.GitHubService, apnsService *services.APNsService, deviceStore services.DeviceStore, fcmService *services.FCMService) *handlers.WebhookHandler {
+	webhookHandler := handlers.NewWebhookHandler(githubService, apnsService, deviceStore)
+	webhookHandler.SetResponseSigningKey(config.ResponseSigningKey)
+	webhookHandler.SetSignatureDiagnostics(config.IsDevelopment)
+	if fcmService != nil {
+		webhookHandler.UseFCM(fcmService)
+	}
+	webhookHandler.SetAsyncNotifications(config.AsyncNotifications)
+	webhookHandler.SetRetryOnInternalError(config.RetryOnInternalError)
+	return webhookHandler
+}
+
+// Config holds all configuration for the webhook server.
+// Fields applied by applyReloadableConfig can change on SIGHUP; all others
+// require a restart.
 type Config struct {
-	Port           string
-	WebhookSecret  string
-	BundleID       string
-	IsDevelopment  bool
-	APNsKeyPath    string
-	APNsKeyID      string
-	APNsTeamID     string
-	APNsCertPath   string
-}
-
-// loadConfig loads configuration from environment variables
-func loadConfig() *Config {
+	Port                  string
+	WebhookSecret         string
+	BundleID              string
+	IsDevelopment         bool
+	APNsKeyPath           string
+	APNsKeyID             string
+	APNsTeamID            string
+	APNsCertPath          string
+	CoalesceWindow        time.Duration
+	HandlerTimeout        time.Duration
+	InterruptionLevels    map[string]string
+	Categories            map[string]string
+	Profiles              string
+	AdminToken            string
+	EnvironmentFallback   bool
+	DeploymentEnvironment string
+	DeviceMinInterval     time.Duration
+	IncludeSender         bool
+	EventBrokerURL        string
+	EventBrokerChannel    string
+	ResponseSigningKey    string
+	SenderAllowlist       []string
+	SenderBlocklist       []string
+	AsyncNotifications    bool
+	RequiredHeaders       map[string]string
+	WebhookSecrets        map[string]string
+	SecretsDir            string
+	APNsBreakerThreshold  int
+	APNsBreakerCooldown   time.Duration
+	NotificationsEnabled  bool
+	DeviceStore           string
+	DeviceTTL             time.Duration
+	DebugHTTP             bool
+	LogRedactPaths        []string
+	CompressPayload       bool
+	PackageEvents         bool
+	SecretAlerts          bool
+	CoalesceKey           string
+	DeviceCacheMaxAge     time.Duration
+	QuietHoursMode        string
+	QuietHoursSummary     bool
+	BusinessHours         string
+	OutboundWebhooks      string
+	RetryMaxAttempts      int
+	RetryBackoff          time.Duration
+	RetryQueuePath        string
+	RequireTopic          []string
+	HookTargetType        string
+	HookTargetIDs         []string
+	MutableContent        bool
+	NotificationImageURL  string
+	APNsPoolSize          int
+	FCMCredentialsPath    string
+	CanaryDelay           time.Duration
+	RetryOnInternalError  bool
+	GitHubAppID           string
+	GitHubAppKeyPath      string
+	TopicCacheTTL         time.Duration
+	MaxScanCommits        int
+	MaxScanFiles          int
+	AppSecrets            map[string]string
+	AppBundleIDs          map[string]string
+	ReplayTolerance       time.Duration
+	ReplayTimestampHeader string
+	BotAuthors            []string
+	IgnoreAuthors         []string
+	BotDocsMode           string
+	DiscloseEndpoints     bool
+	ReconcileInterval     time.Duration
+	ReconcileRate         int
+	JournalPath           string
+	StartupReplayWindow   time.Duration
+	RequireAppAttest      bool
+	WelcomePush           bool
+	SubmodulePaths        []string
+	DraftPaths            []string
+	EventTopics           map[string]string
+	AppAttestRootCA       string
+	AppAttestKeysPath     string
+	GitHubAPIBaseURL      string
+	RegisterRateLimit     int
+	RegisterRateBurst     int
+	RequireHTTPS          bool
+	APNsLazyInit          bool
+	APNsInitRetry         time.Duration
+	TrustProxy            bool
+	ValidateOnly          bool // -validate-config: check the configuration and credentials, then exit
+}
+
+// applyReloadableConfig applies the settings that may change while the server runs
+func applyReloadableConfig(config *Config, githubService *services.GitHubService, apnsService *services.APNsService, webhookHandler *handlers.WebhookHandler) {
+	githubService.SetDeploymentEnvironment(config.DeploymentEnvironment)
+	githubService.SetSenderFilters(config.SenderAllowlist, config.SenderBlocklist)
+	githubService.SetBotAuthors(config.BotAuthors, config.BotDocsMode)
+	githubService.SetIgnoredAuthors(config.IgnoreAuthors)
+	githubService.SetPackageEvents(config.PackageEvents)
+	githubService.SetSecretScanningAlerts(config.SecretAlerts)
+	githubService.SetScanLimits(config.MaxScanCommits, config.MaxScanFiles)
+	githubService.SetRequiredTopics(config.RequireTopic)
+	githubService.SetSubmodulePaths(config.SubmodulePaths)
+	githubService.SetDraftPaths(config.DraftPaths)
+	apnsService.SetNotificationProfiles(notificationProfiles(config))
+	apnsService.SetEventTopics(config.EventTopics)
+	apnsService.SetIncludeSender(config.IncludeSender)
+	apnsService.SetCompressPayload(config.CompressPayload)
+	apnsService.SetMutableContent(config.MutableContent, config.NotificationImageURL)
+
+	webhookHandler.SetNotificationsEnabled(config.NotificationsEnabled)
+	if !config.NotificationsEnabled {
+		log.Printf("🔕 Notifications disabled - webhooks are acknowledged but no pushes are sent")
+	}
+	webhookHandler.SetQuietHours(config.QuietHoursMode, config.QuietHoursSummary)
+	businessHours, _ := services.ParseBusinessHours(config.BusinessHours) // validated on load
+	webhookHandler.SetBusinessHours(businessHours)
+	webhookHandler.SetOutboundNotifier(outboundNotifier(config))
+	webhookHandler.SetDebugLogging(config.DebugHTTP, config.LogRedactPaths)
+	webhookHandler.EnableCoalescing(config.CoalesceWindow, config.CoalesceKey)
+	if config.CoalesceWindow > 0 {
+		log.Printf("🔗 Coalescing notifications within %s by %s", config.CoalesceWindow, config.CoalesceKey)
+	}
+	webhookHandler.SetCanaryDelay(config.CanaryDelay)
+	webhookHandler.SetWelcomePush(config.WelcomePush)
+	webhookHandler.SetReplayTolerance(config.ReplayTolerance, config.ReplayTimestampHeader)
+	webhookHandler.EnableDeviceThrottle(config.DeviceMinInterval)
+	if config.DeviceMinInterval > 0 {
+		log.Printf("⏳ Limiting each device to one push per %s", config.DeviceMinInterval)
+	}
+}
+
+// notificationProfiles combines NOTIFICATION_PROFILES with the INTERRUPTION_LEVELS
+// and NOTIFICATION_CATEGORIES shorthands, which fill in fields a profile leaves empty
+func notificationProfiles(config *Config) map[string]services.NotificationProfile {
+	parsed, _ := services.ParseNotificationProfiles(config.Profiles) // checked by Validate
+	profiles := make(map[string]services.NotificationProfile)
+	for eventType, profile := range parsed {
+		profiles[services.NormalizeEventType(eventType)] = profile
+	}
+
+	for eventType, level := range config.InterruptionLevels {
+		eventType = services.NormalizeEventType(eventType)
+		if profile := profiles[eventType]; profile.InterruptionLevel == "" {
+			profile.InterruptionLevel = level
+			profiles[eventType] = profile
+		}
+	}
+	for eventType, category := range config.Categories {
+		eventType = services.NormalizeEventType(eventType)
+		if category == "" {
+			category = "none"
+		}
+		if profile := profiles[eventType]; profile.Category == "" {
+			profile.Category = category
+			profiles[eventType] = profile
+		}
+	}
+	return profiles
+}
+
+// outboundNotifier creates the notifier for OUTBOUND_WEBHOOKS, or nil without destinations
+func outboundNotifier(config *Config) *services.OutboundNotifier {
+	destinations, _ := services.ParseOutboundDestinations(config.OutboundWebhooks) // validated on load
+	if len(destinations) == 0 {
+		return nil
+	}
+	return services.NewOutboundNotifier(destinations)
+}
+
+// warnRestartRequired logs settings that changed on reload but only take effect after a restart
+func warnRestartRequired(current, updated *Config) {
+	changed := map[string]bool{
+		"PORT":                      current.Port != updated.Port,
+		"GITHUB_WEBHOOK_SECRET":     current.WebhookSecret != updated.WebhookSecret,
+		"BUNDLE_ID":                 current.BundleID != updated.BundleID,
+		"APNS_DEVELOPMENT":          current.IsDevelopment != updated.IsDevelopment,
+		"APNS_CERT_PATH":            current.APNsCertPath != updated.APNsCertPath,
+		"APNS_ENVIRONMENT_FALLBACK": current.EnvironmentFallback != updated.EnvironmentFallback,
+		"HANDLER_TIMEOUT":           current.HandlerTimeout != updated.HandlerTimeout,
+		"ADMIN_TOKEN":               current.AdminToken != updated.AdminToken,
+		"EVENT_BROKER_URL":          current.EventBrokerURL != updated.EventBrokerURL,
+		"EVENT_BROKER_CHANNEL":      current.EventBrokerChannel != updated.EventBrokerChannel,
+		"RESPONSE_SIGNING_KEY":      current.ResponseSigningKey != updated.ResponseSigningKey,
+		"ASYNC_NOTIFICATIONS":       current.AsyncNotifications != updated.AsyncNotifications,
+		"RETRY_ON_INTERNAL_ERROR":   current.RetryOnInternalError != updated.RetryOnInternalError,
+		"REQUIRED_HEADERS":          fmt.Sprint(current.RequiredHeaders) != fmt.Sprint(updated.RequiredHeaders),
+		"WEBHOOK_SECRETS":           fmt.Sprint(current.WebhookSecrets) != fmt.Sprint(updated.WebhookSecrets),
+		"WEBHOOK_SECRETS_DIR":       current.SecretsDir != updated.SecretsDir,
+		"DISCLOSE_ENDPOINTS":        current.DiscloseEndpoints != updated.DiscloseEndpoints,
+		"TOKEN_RECONCILE_INTERVAL":  current.ReconcileInterval != updated.ReconcileInterval,
+		"TOKEN_RECONCILE_RATE":      current.ReconcileRate != updated.ReconcileRate,
+		"DELIVERY_JOURNAL_PATH":     current.JournalPath != updated.JournalPath,
+		"STARTUP_REPLAY_WINDOW":     current.StartupReplayWindow != updated.StartupReplayWindow,
+		"REQUIRE_APP_ATTEST":        current.RequireAppAttest != updated.RequireAppAttest,
+		"APP_ATTEST_ROOT_CA":        current.AppAttestRootCA != updated.AppAttestRootCA,
+		"APP_ATTEST_KEYS_PATH":      current.AppAttestKeysPath != updated.AppAttestKeysPath,
+		"APP_SECRETS":               fmt.Sprint(current.AppSecrets) != fmt.Sprint(updated.AppSecrets),
+		"APP_BUNDLE_IDS":            fmt.Sprint(current.AppBundleIDs) != fmt.Sprint(updated.AppBundleIDs),
+		"HOOK_TARGET_TYPE":          current.HookTargetType != updated.HookTargetType,
+		"HOOK_TARGET_IDS":           fmt.Sprint(current.HookTargetIDs) != fmt.Sprint(updated.HookTargetIDs),
+		"APNS_BREAKER_THRESHOLD":    current.APNsBreakerThreshold != updated.APNsBreakerThreshold,
+		"APNS_BREAKER_COOLDOWN":     current.APNsBreakerCooldown != updated.APNsBreakerCooldown,
+		"DEVICE_STORE":              current.DeviceStore != updated.DeviceStore,
+		"APNS_POOL_SIZE":            current.APNsPoolSize != updated.APNsPoolSize,
+		"FCM_CREDENTIALS_PATH":      current.FCMCredentialsPath != updated.FCMCredentialsPath,
+		"DEVICE_TTL":                current.DeviceTTL != updated.DeviceTTL,
+		"DEVICE_CACHE_MAX_AGE":      current.DeviceCacheMaxAge != updated.DeviceCacheMaxAge,
+		"REGISTER_RATE_LIMIT":       current.RegisterRateLimit != updated.RegisterRateLimit,
+		"REGISTER_RATE_BURST":       current.RegisterRateBurst != updated.RegisterRateBurst,
+		"REQUIRE_HTTPS":             current.RequireHTTPS != updated.RequireHTTPS,
+		"APNS_LAZY_INIT":            current.APNsLazyInit != updated.APNsLazyInit,
+		"RETRY_MAX_ATTEMPTS":        current.RetryMaxAttempts != updated.RetryMaxAttempts,
+		"RETRY_BACKOFF":             current.RetryBackoff != updated.RetryBackoff,
+		"RETRY_QUEUE_PATH":          current.RetryQueuePath != updated.RetryQueuePath,
+		"APNS_INIT_RETRY":           current.APNsInitRetry != updated.APNsInitRetry,
+		"TRUST_PROXY":               current.TrustProxy != updated.TrustProxy,
+		"GITHUB_APP_ID":             current.GitHubAppID != updated.GitHubAppID,
+		"GITHUB_APP_PRIVATE_KEY":    current.GitHubAppKeyPath != updated.GitHubAppKeyPath,
+		"TOPIC_CACHE_TTL":           current.TopicCacheTTL != updated.TopicCacheTTL,
+		"GITHUB_API_BASE_URL":       current.GitHubAPIBaseURL != updated.GitHubAPIBaseURL,
+	}
+	for key, isChanged := range changed {
+		if isChanged {
+			log.Printf("⚠️  %s changed but requires a restart to take effect", key)
+		}
+	}
+}
+
+// loadEnvFileIfSet loads KEY=VALUE lines from the file named by ENV_FILE into the
+// process environment, overriding existing values. This is what makes SIGHUP
+// reloads pick up new settings.
+func loadEnvFileIfSet() {
+	path := os.Getenv("ENV_FILE")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("⚠️  Failed to read ENV_FILE %s: %v", path, err)
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		os.Setenv(strings.TrimSpace(key), strings.Trim(strings.TrimSpace(value), `"'`))
+	}
+}
+
+// loadConfig loads configuration from environment variables, overridden by any
+// command-line flags in args
+func loadConfig(args []string) (*Config, error) {
 	config := &Config{
-		Port:          getEnv("PORT", "8080"),
-		WebhookSecret: getEnv("GITHUB_WEBHOOK_SECRET", ""),
-		BundleID:      getEnv("BUNDLE_ID", "ganglinwu.MD-TalkMan"),
-		IsDevelopment: getEnv("APNS_DEVELOPMENT", "true") == "true",
-		APNsKeyPath:   getEnv("APNS_KEY_PATH", ""),
-		APNsKeyID:     getEnv("APNS_KEY_ID", ""),
-		APNsTeamID:    getEnv("APNS_TEAM_ID", ""),
-		APNsCertPath:  getEnv("APNS_CERT_PATH", ""),
+		Port:                  getEnv("PORT", "8080"),
+		WebhookSecret:         getEnv("GITHUB_WEBHOOK_SECRET", ""),
+		BundleID:              getEnv("BUNDLE_ID", "ganglinwu.MD-TalkMan"),
+		IsDevelopment:         getEnv("APNS_DEVELOPMENT", "true") == "true",
+		APNsKeyPath:           getEnv("APNS_KEY_PATH", ""),
+		APNsKeyID:             getEnv("APNS_KEY_ID", ""),
+		APNsTeamID:            getEnv("APNS_TEAM_ID", ""),
+		APNsCertPath:          getEnv("APNS_CERT_PATH", ""),
+		CoalesceWindow:        getEnvDuration("COALESCE_WINDOW", 0),
+		HandlerTimeout:        getEnvDuration("HANDLER_TIMEOUT", 9*time.Second),
+		InterruptionLevels:    getEnvMap("INTERRUPTION_LEVELS"),
+		Categories:            getEnvMap("NOTIFICATION_CATEGORIES"),
+		Profiles:              getEnv("NOTIFICATION_PROFILES", ""),
+		AdminToken:            getEnv("ADMIN_TOKEN", ""),
+		EnvironmentFallback:   getEnv("APNS_ENVIRONMENT_FALLBACK", "true") == "true",
+		DeploymentEnvironment: getEnv("DEPLOYMENT_ENVIRONMENT", "github-pages"),
+		DeviceMinInterval:     getEnvDuration("DEVICE_MIN_INTERVAL", 0),
+		IncludeSender:         getEnv("INCLUDE_SENDER", "false") == "true",
+		EventBrokerURL:        getEnv("EVENT_BROKER_URL", ""),
+		EventBrokerChannel:    getEnv("EVENT_BROKER_CHANNEL", "mdtalkman:events"),
+		ResponseSigningKey:    getEnv("RESPONSE_SIGNING_KEY", ""),
+		SenderAllowlist:       getEnvList("SENDER_ALLOWLIST"),
+		SenderBlocklist:       getEnvList("SENDER_BLOCKLIST"),
+		AsyncNotifications:    getEnv("ASYNC_NOTIFICATIONS", "false") == "true",
+		RequiredHeaders:       getEnvMap("REQUIRED_HEADERS"),
+		WebhookSecrets:        getEnvMap("WEBHOOK_SECRETS"),
+		SecretsDir:            getEnv("WEBHOOK_SECRETS_DIR", ""),
+		APNsBreakerThreshold:  getEnvInt("APNS_BREAKER_THRESHOLD", 5),
+		APNsBreakerCooldown:   getEnvDuration("APNS_BREAKER_COOLDOWN", 30*time.Second),
+		NotificationsEnabled:  getEnv("NOTIFICATIONS_ENABLED", "true") == "true",
+		DeviceStore:           getEnv("DEVICE_STORE", "memory"),
+		DeviceTTL:             getEnvDuration("DEVICE_TTL", 30*24*time.Hour),
+		DebugHTTP:             getEnv("DEBUG_HTTP", "false") == "true",
+		LogRedactPaths:        getEnvList("LOG_REDACT_PATHS"),
+		CompressPayload:       getEnv("COMPRESS_PAYLOAD", "false") == "true",
+		PackageEvents:         getEnv("PACKAGE_EVENTS", "false") == "true",
+		SecretAlerts:          getEnv("SECRET_SCANNING_ALERTS", "false") == "true",
+		CoalesceKey:           getEnv("COALESCE_KEY", services.DefaultCoalesceKey),
+		DeviceCacheMaxAge:     getEnvDuration("DEVICE_CACHE_MAX_AGE", 5*time.Minute),
+		QuietHoursMode:        getEnv("QUIET_HOURS_MODE", services.QuietHoursSuppress),
+		QuietHoursSummary:     getEnv("QUIET_HOURS_SUMMARY", "false") == "true",
+		BusinessHours:         getEnv("BUSINESS_HOURS", ""),
+		OutboundWebhooks:      getEnv("OUTBOUND_WEBHOOKS", ""),
+		RetryMaxAttempts:      getEnvInt("RETRY_MAX_ATTEMPTS", 0),
+		RetryBackoff:          getEnvDuration("RETRY_BACKOFF", 30*time.Second),
+		RetryQueuePath:        getEnv("RETRY_QUEUE_PATH", ""),
+		RequireTopic:          getEnvList("REQUIRE_TOPIC"),
+		HookTargetType:        getEnv("HOOK_TARGET_TYPE", ""),
+		HookTargetIDs:         getEnvList("HOOK_TARGET_IDS"),
+		MutableContent:        getEnv("MUTABLE_CONTENT", "false") == "true",
+		NotificationImageURL:  getEnv("NOTIFICATION_IMAGE_URL", ""),
+		APNsPoolSize:          getEnvInt("APNS_POOL_SIZE", 1),
+		FCMCredentialsPath:    getEnv("FCM_CREDENTIALS_PATH", ""),
+		CanaryDelay:           getEnvDuration("CANARY_DELAY", 0),
+		RetryOnInternalError:  getEnv("RETRY_ON_INTERNAL_ERROR", "false") == "true",
+		GitHubAppID:           getEnv("GITHUB_APP_ID", ""),
+		GitHubAppKeyPath:      getEnv("GITHUB_APP_PRIVATE_KEY", ""),
+		TopicCacheTTL:         getEnvDuration("TOPIC_CACHE_TTL", time.Hour),
+		MaxScanCommits:        getEnvInt("MAX_SCAN_COMMITS", 0),
+		MaxScanFiles:          getEnvInt("MAX_SCAN_FILES", 0),
+		AppSecrets:            getEnvMap("APP_SECRETS"),
+		AppBundleIDs:          getEnvMap("APP_BUNDLE_IDS"),
+		ReplayTolerance:       getEnvDuration("REPLAY_TOLERANCE", 0),
+		ReplayTimestampHeader: getEnv("REPLAY_TIMESTAMP_HEADER", ""),
+		BotAuthors:            getEnvList("BOT_AUTHORS"),
+		IgnoreAuthors:         getEnvList("IGNORE_AUTHORS"),
+		BotDocsMode:           getEnv("BOT_DOCS_MODE", services.BotDocsNotify),
+		ReconcileInterval:     getEnvDuration("TOKEN_RECONCILE_INTERVAL", 0),
+		ReconcileRate:         getEnvInt("TOKEN_RECONCILE_RATE", 10),
+		JournalPath:           getEnv("DELIVERY_JOURNAL_PATH", ""),
+		StartupReplayWindow:   getEnvDuration("STARTUP_REPLAY_WINDOW", 0),
+		RequireAppAttest:      getEnv("REQUIRE_APP_ATTEST", "false") == "true",
+		WelcomePush:           getEnv("WELCOME_PUSH", "false") == "true",
+		SubmodulePaths:        getEnvList("SUBMODULE_PATHS"),
+		DraftPaths:            getEnvList("DRAFT_PATHS"),
+		EventTopics:           getEnvMap("EVENT_TOPICS"),
+		AppAttestRootCA:       getEnv("APP_ATTEST_ROOT_CA", ""),
+		AppAttestKeysPath:     getEnv("APP_ATTEST_KEYS_PATH", ""),
+		GitHubAPIBaseURL:      getEnv("GITHUB_API_BASE_URL", services.DefaultGitHubAPIBaseURL),
+		RegisterRateLimit:     getEnvInt("REGISTER_RATE_LIMIT", 0),
+		RegisterRateBurst:     getEnvInt("REGISTER_RATE_BURST", 5),
+		RequireHTTPS:          getEnv("REQUIRE_HTTPS", "false") == "true",
+		APNsLazyInit:          getEnv("APNS_LAZY_INIT", "false") == "true",
+		APNsInitRetry:         getEnvDuration("APNS_INIT_RETRY", 30*time.Second),
+		TrustProxy:            getEnv("TRUST_PROXY", "false") == "true",
 	}
 
-	// Validate required configuration
-	if config.WebhookSecret == "" {
-		log.Fatal("❌ GITHUB_WEBHOOK_SECRET environment variable is required")
+	set, err := applyFlags(config, args)
+	if err != nil {
+		return nil, err
+	}
+	// The root endpoint lists the version and endpoints only when development mode was
+	// asked for: APNS_DEVELOPMENT defaults to true, so an unset deployment must not disclose
+	explicitDev := lookupSetting("APNS_DEVELOPMENT") == "true"
+	if set["dev"] {
+		explicitDev = config.IsDevelopment
 	}
+	config.DiscloseEndpoints = getEnv("DISCLOSE_ENDPOINTS", strconv.FormatBool(explicitDev)) == "true"
 
 	// APNs configuration is optional - warn if incomplete but don't fail
 	if config.APNsKeyPath != "" && (config.APNsKeyID == "" || config.APNsTeamID == "") {
@@ -167,13 +884,216 @@ func loadConfig() *Config {
 		config.APNsKeyPath = "" // Clear to use simplified mode
 	}
 
-	return config
+	return config, nil
+}
+
+// applyFlags overrides config with the command-line flags present in args.
+// Each flag defaults to the value already loaded from its environment variable.
+// It returns the names of the flags given explicitly
+func applyFlags(config *Config, args []string) (map[string]bool, error) {
+	flags := newFlagSet(config)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set, nil
+}
+
+// newFlagSet returns the command-line flags, bound to config's fields
+func newFlagSet(config *Config) *flag.FlagSet {
+	flags := flag.NewFlagSet("webhook-server", flag.ContinueOnError)
+	flags.StringVar(&config.Port, "port", config.Port, "HTTP listen port (PORT)")
+	flags.BoolVar(&config.IsDevelopment, "dev", config.IsDevelopment, "use the APNs sandbox (APNS_DEVELOPMENT)")
+	flags.StringVar(&config.BundleID, "bundle-id", config.BundleID, "iOS app bundle identifier (BUNDLE_ID)")
+	flags.StringVar(&config.APNsKeyPath, "apns-key-path", config.APNsKeyPath, "path to the APNs .p8 key (APNS_KEY_PATH)")
+	flags.StringVar(&config.APNsKeyID, "apns-key-id", config.APNsKeyID, "APNs key ID (APNS_KEY_ID)")
+	flags.StringVar(&config.APNsTeamID, "apns-team-id", config.APNsTeamID, "Apple Team ID (APNS_TEAM_ID)")
+	flags.StringVar(&config.APNsCertPath, "apns-cert-path", config.APNsCertPath, "path to the APNs .p12 certificate (APNS_CERT_PATH)")
+	flags.DurationVar(&config.HandlerTimeout, "handler-timeout", config.HandlerTimeout, "per-request deadline (HANDLER_TIMEOUT)")
+	flags.DurationVar(&config.CoalesceWindow, "coalesce-window", config.CoalesceWindow, "merge deliveries within this window (COALESCE_WINDOW)")
+	flags.BoolVar(&config.NotificationsEnabled, "notifications", config.NotificationsEnabled, "send push notifications (NOTIFICATIONS_ENABLED)")
+	flags.BoolVar(&config.DebugHTTP, "debug-http", config.DebugHTTP, "log webhook payloads (DEBUG_HTTP)")
+	flags.BoolVar(&config.ValidateOnly, "validate-config", false, "check the configuration and credentials, then exit")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of webhook-server:\n\n"+
+			"Each flag overrides the environment variable in parentheses. All other\n"+
+			"settings are read from environment variables or CONFIG_FILE only; see the\n"+
+			"README for the full list.\n\n")
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Validate checks the configuration and reports every problem at once, so
+// operators can fix them all before restarting
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.WebhookSecret == "" && len(c.WebhookSecrets) == 0 && c.SecretsDir == "" {
+		errs = append(errs, errors.New("GITHUB_WEBHOOK_SECRET (or WEBHOOK_SECRETS or WEBHOOK_SECRETS_DIR) is required"))
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a number between 1 and 65535, got %q", c.Port))
+	}
+	if c.APNsKeyPath != "" && !c.APNsLazyInit {
+		if _, err := services.LoadAuthKey(c.APNsKeyPath); err != nil {
+			errs = append(errs, fmt.Errorf("APNS_KEY_PATH: %w", err))
+		}
+	}
+
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"COALESCE_WINDOW", c.CoalesceWindow},
+		{"HANDLER_TIMEOUT", c.HandlerTimeout},
+		{"DEVICE_MIN_INTERVAL", c.DeviceMinInterval},
+		{"APNS_BREAKER_COOLDOWN", c.APNsBreakerCooldown},
+		{"DEVICE_CACHE_MAX_AGE", c.DeviceCacheMaxAge},
+		{"CANARY_DELAY", c.CanaryDelay},
+		{"REPLAY_TOLERANCE", c.ReplayTolerance},
+		{"TOKEN_RECONCILE_INTERVAL", c.ReconcileInterval},
+		{"STARTUP_REPLAY_WINDOW", c.StartupReplayWindow},
+		{"TOPIC_CACHE_TTL", c.TopicCacheTTL},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", duration.key, duration.value))
+		}
+	}
+	if c.DeviceStore != "memory" && c.DeviceStore != "memory-ttl" {
+		errs = append(errs, fmt.Errorf("DEVICE_STORE must be memory or memory-ttl, got %q", c.DeviceStore))
+	}
+	if c.DeviceStore == "memory-ttl" && c.DeviceTTL <= 0 {
+		errs = append(errs, fmt.Errorf("DEVICE_TTL must be positive, got %s", c.DeviceTTL))
+	}
+	if _, err := services.ParseNotificationProfiles(c.Profiles); err != nil {
+		errs = append(errs, fmt.Errorf("NOTIFICATION_PROFILES: %w", err))
+	}
+	if _, err := services.ParseCoalesceKey(c.CoalesceKey); err != nil {
+		errs = append(errs, fmt.Errorf("COALESCE_KEY is not a valid template: %w", err))
+	}
+	switch c.BotDocsMode {
+	case services.BotDocsNotify, services.BotDocsTag, services.BotDocsSuppress:
+	default:
+		errs = append(errs, fmt.Errorf("BOT_DOCS_MODE must be notify, tag or suppress, got %q", c.BotDocsMode))
+	}
+	if c.QuietHoursMode != services.QuietHoursSuppress && c.QuietHoursMode != services.QuietHoursSilent {
+		errs = append(errs, fmt.Errorf("QUIET_HOURS_MODE must be suppress or silent, got %q", c.QuietHoursMode))
+	}
+	if _, err := services.ParseOutboundDestinations(c.OutboundWebhooks); err != nil {
+		errs = append(errs, fmt.Errorf("OUTBOUND_WEBHOOKS: %w", err))
+	}
+	if _, err := services.ParseBusinessHours(c.BusinessHours); err != nil {
+		errs = append(errs, fmt.Errorf("BUSINESS_HOURS: %w", err))
+	}
+	if c.APNsPoolSize < 1 || c.APNsPoolSize > 64 {
+		errs = append(errs, fmt.Errorf("APNS_POOL_SIZE must be between 1 and 64, got %d", c.APNsPoolSize))
+	}
+	if c.APNsBreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("APNS_BREAKER_THRESHOLD must not be negative, got %d", c.APNsBreakerThreshold))
+	}
+	for id, secret := range c.AppSecrets {
+		if strings.Contains(id, "/") || secret == "" {
+			errs = append(errs, fmt.Errorf("APP_SECRETS entry %q needs an ID without slashes and a secret", id))
+		}
+	}
+	if c.NotificationImageURL != "" {
+		if err := services.ValidateImageURL(c.NotificationImageURL); err != nil {
+			errs = append(errs, fmt.Errorf("NOTIFICATION_IMAGE_URL: %w", err))
+		}
+	}
+	if err := services.ValidatePathPatterns(c.SubmodulePaths); err != nil {
+		errs = append(errs, fmt.Errorf("SUBMODULE_PATHS: %w", err))
+	}
+	if err := services.ValidatePathPatterns(c.DraftPaths); err != nil {
+		errs = append(errs, fmt.Errorf("DRAFT_PATHS: %w", err))
+	}
+	if err := services.ValidateAPIBaseURL(c.GitHubAPIBaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("GITHUB_API_BASE_URL: %w", err))
+	}
+	if c.RequireAppAttest && (c.AppAttestRootCA == "" || c.APNsTeamID == "") {
+		errs = append(errs, errors.New("REQUIRE_APP_ATTEST needs APP_ATTEST_ROOT_CA and APNS_TEAM_ID"))
+	}
+	if c.RetryMaxAttempts < 0 || (c.RetryMaxAttempts > 0 && c.RetryBackoff <= 0) {
+		errs = append(errs, fmt.Errorf("RETRY_MAX_ATTEMPTS must not be negative and RETRY_BACKOFF must be positive, got %d and %s", c.RetryMaxAttempts, c.RetryBackoff))
+	}
+	if c.APNsLazyInit && c.APNsInitRetry <= 0 {
+		errs = append(errs, fmt.Errorf("APNS_INIT_RETRY must be positive, got %s", c.APNsInitRetry))
+	}
+	if c.RegisterRateLimit < 0 || c.RegisterRateBurst < 1 {
+		errs = append(errs, fmt.Errorf("REGISTER_RATE_LIMIT must not be negative and REGISTER_RATE_BURST must be positive, got %d and %d", c.RegisterRateLimit, c.RegisterRateBurst))
+	}
+	if c.MaxScanCommits < 0 || c.MaxScanFiles < 0 {
+		errs = append(errs, fmt.Errorf("MAX_SCAN_COMMITS and MAX_SCAN_FILES must not be negative, got %d and %d", c.MaxScanCommits, c.MaxScanFiles))
+	}
+	if (c.GitHubAppID == "") != (c.GitHubAppKeyPath == "") {
+		errs = append(errs, errors.New("GITHUB_APP_ID and GITHUB_APP_PRIVATE_KEY must be set together"))
+	}
+
+	return errors.Join(errs...)
 }
 
 // getEnv gets an environment variable with a default value
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupSetting(key); value != "" {
 		return value
 	}
 	return defaultValue
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "2s") with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := lookupSetting(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s value %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := lookupSetting(key)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s value %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+// getEnvList parses a comma-separated list, dropping empty entries
+func getEnvList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(lookupSetting(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap parses a comma-separated list of key=value pairs (e.g. "push=passive,installation=active")
+func getEnvMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(lookupSetting(key), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || name == "" {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return result
 }
\ No newline at end of file
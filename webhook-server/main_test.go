@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRootHandler(t *testing.T) {
+	tests := []struct {
+		name              string
+		discloseEndpoints bool
+		wantVersion       bool
+	}{
+		{name: "disclosed", discloseEndpoints: true, wantVersion: true},
+		{name: "hidden", discloseEndpoints: false, wantVersion: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rootHandler(tt.discloseEndpoints)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			body := rec.Body.String()
+			for _, leak := range []string{`"version"`, "/webhook/register"} {
+				if got := strings.Contains(body, leak); got != tt.wantVersion {
+					t.Errorf("body contains %s = %t, want %t: %s", leak, got, tt.wantVersion, body)
+				}
+			}
+		})
+	}
+}
+
+// reloadOnce runs reloadOnSignal for a single SIGHUP and returns the
+// configuration it applied, or nil when it kept the current one
+func reloadOnce(t *testing.T, current *Config) *Config {
+	t.Helper()
+
+	hup := make(chan os.Signal, 1)
+	hup <- syscall.SIGHUP
+	close(hup)
+
+	var applied *Config
+	reloadOnSignal(hup, current, nil, func(config *Config) { applied = config })
+	return applied
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	t.Setenv("ENV_FILE", "")
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "reload-test-secret")
+	t.Setenv("NOTIFICATIONS_ENABLED", "true")
+	current, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	t.Run("applies a valid configuration", func(t *testing.T) {
+		t.Setenv("NOTIFICATIONS_ENABLED", "false")
+
+		applied := reloadOnce(t, current)
+		if applied == nil {
+			t.Fatal("valid configuration was not applied")
+		}
+		if applied.NotificationsEnabled {
+			t.Error("reloaded configuration still has notifications enabled")
+		}
+	})
+
+	t.Run("keeps the current configuration when invalid", func(t *testing.T) {
+		t.Setenv("PORT", "0")
+
+		if applied := reloadOnce(t, current); applied != nil {
+			t.Errorf("invalid configuration was applied: %+v", applied)
+		}
+	})
+}
+
+func TestDiscloseEndpointsDefault(t *testing.T) {
+	tests := []struct {
+		name        string
+		development string
+		disclose    string
+		args        []string
+		want        bool
+	}{
+		{name: "development unset", want: false},
+		{name: "development explicit", development: "true", want: true},
+		{name: "production", development: "false", want: false},
+		{name: "dev flag", args: []string{"-dev"}, want: true},
+		{name: "dev flag off", development: "true", args: []string{"-dev=false"}, want: false},
+		{name: "configured", disclose: "true", want: true},
+		{name: "configured off in development", development: "true", disclose: "false", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV_FILE", "")
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("GITHUB_WEBHOOK_SECRET", "disclose-test-secret")
+			t.Setenv("APNS_DEVELOPMENT", tt.development)
+			t.Setenv("DISCLOSE_ENDPOINTS", tt.disclose)
+
+			config, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if config.DiscloseEndpoints != tt.want {
+				t.Errorf("DiscloseEndpoints = %t, want %t", config.DiscloseEndpoints, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagsOverrideEnvironment(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(config *Config) bool
+	}{
+		{
+			name: "env var applies without its flag",
+			env:  map[string]string{"PORT": "9000", "HANDLER_TIMEOUT": "3s"},
+			want: func(c *Config) bool { return c.Port == "9000" && c.HandlerTimeout == 3*time.Second },
+		},
+		{
+			name: "flag overrides its env var",
+			env:  map[string]string{"PORT": "9000", "HANDLER_TIMEOUT": "3s"},
+			args: []string{"-port", "9090", "-handler-timeout=5s"},
+			want: func(c *Config) bool { return c.Port == "9090" && c.HandlerTimeout == 5*time.Second },
+		},
+		{
+			name: "boolean flag overrides its env var",
+			env:  map[string]string{"NOTIFICATIONS_ENABLED": "true", "DEBUG_HTTP": "false"},
+			args: []string{"-notifications=false", "-debug-http"},
+			want: func(c *Config) bool { return !c.NotificationsEnabled && c.DebugHTTP },
+		},
+		{
+			name: "flags leave other settings alone",
+			env:  map[string]string{"BUNDLE_ID": "com.example.env", "COALESCE_WINDOW": "2s"},
+			args: []string{"-port", "9090"},
+			want: func(c *Config) bool { return c.BundleID == "com.example.env" && c.CoalesceWindow == 2*time.Second },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV_FILE", "")
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("GITHUB_WEBHOOK_SECRET", "flags-test-secret")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			config, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if !tt.want(config) {
+				t.Errorf("unexpected configuration: %+v", config)
+			}
+		})
+	}
+}
+
+func TestFlagUsageNamesEnvironmentVariables(t *testing.T) {
+	var usage bytes.Buffer
+	flags := newFlagSet(&Config{})
+	flags.SetOutput(&usage)
+	flags.Usage()
+
+	for _, want := range []string{"-port", "(PORT)", "-dev", "(APNS_DEVELOPMENT)", "-debug-http", "(DEBUG_HTTP)", "environment variables or CONFIG_FILE only"} {
+		if !strings.Contains(usage.String(), want) {
+			t.Errorf("usage doesn't mention %s:\n%s", want, usage.String())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package metrics provides race-free counters and gauges for the server's
+// operational statistics, shown in /webhook/status
+package metrics
+
+import "sync/atomic"
+
+// Counter is a monotonically increasing count, safe for concurrent use
+type Counter struct {
+	value atomic.Int64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add adds n to the counter; negative n is ignored
+func (c *Counter) Add(n int64) {
+	if n > 0 {
+		c.value.Add(n)
+	}
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+// Gauge is a value that goes up and down, safe for concurrent use
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Set replaces the gauge's value
+func (g *Gauge) Set(n int64) {
+	g.value.Store(n)
+}
+
+// Add changes the gauge by n, which may be negative
+func (g *Gauge) Add(n int64) {
+	g.value.Add(n)
+}
+
+// Value returns the current value
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// Process-wide statistics, across all hosted apps
+var (
+	WebhooksReceived Counter // verified or not, every POST to a webhook endpoint
+	WebhooksInFlight Gauge   // webhooks being processed right now
+	PushesSent       Counter // notifications APNs or FCM accepted
+	PushesFailed     Counter // notifications APNs or FCM refused or couldn't be sent
+)
+
+// Snapshot is a point-in-time copy of the process-wide statistics
+type Snapshot struct {
+	WebhooksReceived int64 `json:"webhooks_received"`
+	WebhooksInFlight int64 `json:"webhooks_in_flight"`
+	PushesSent       int64 `json:"pushes_sent"`
+	PushesFailed     int64 `json:"pushes_failed"`
+}
+
+// Read returns the current process-wide statistics
+func Read() Snapshot {
+	return Snapshot{
+		WebhooksReceived: WebhooksReceived.Value(),
+		WebhooksInFlight: WebhooksInFlight.Value(),
+		PushesSent:       PushesSent.Value(),
+		PushesFailed:     PushesFailed.Value(),
+	}
+}
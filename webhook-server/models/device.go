@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Device represents an iOS device registered for push notifications
+type Device struct {
+	Token          string            `json:"device_token"`
+	Platform       string            `json:"platform,omitempty"` // "ios" (default) or "android"
+	TopicSuffix    string            `json:"topic_suffix,omitempty"`
+	Repositories   []string          `json:"repositories,omitempty"`    // Only notify for these repositories...
+	Organizations  []string          `json:"organizations,omitempty"`   // ...or any repository of these organizations; both empty means all
+	IncludeAuthors []string          `json:"include_authors,omitempty"` // Only notify for commits by these usernames
+	ExcludeAuthors []string          `json:"exclude_authors,omitempty"` // Skip pushes made entirely by these usernames
+	Paths          []string          `json:"paths,omitempty"`           // Only notify when a changed markdown file matches one of these globs
+	Badge          int               `json:"badge,omitempty"`           // Notifications since the app last cleared its badge
+	QuietHours     *QuietHours       `json:"quiet_hours,omitempty"`     // Window in which pushes are held or sent silently
+	Schedule       *DeliverySchedule `json:"schedule,omitempty"`        // Batch pushes into summaries delivered at set times
+	Canary         bool              `json:"canary,omitempty"`          // Notified before other devices, with "canary": true in the payload
+	PayloadVersion int               `json:"payload_version,omitempty"` // Payload shape the app understands; 0 means the legacy shape
+	RegisteredAt   time.Time         `json:"registered_at"`             // When the device last registered
+	Silent         bool              `json:"-"`                         // Send this push without alert, sound or badge
+}
+
+// DeliverySchedule batches a device's pushes into one summary at each of the
+// given times of day
+type DeliverySchedule struct {
+	Times    []string `json:"times"`    // e.g. ["09:00", "17:00"]
+	TimeZone string   `json:"timezone"` // IANA name, e.g. "Europe/Berlin"; empty means UTC
+}
+
+// QuietHours is a daily window, in the device's timezone, without audible pushes
+type QuietHours struct {
+	Start    string `json:"start"`    // e.g. "22:00"
+	End      string `json:"end"`      // e.g. "07:00"
+	TimeZone string `json:"timezone"` // IANA name, e.g. "Europe/Berlin"; empty means UTC
+}
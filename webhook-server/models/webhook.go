@@ -5,34 +5,52 @@ import "time"
 // GitHubWebhookPayload represents the structure of GitHub webhook payloads
 // Reference: https://docs.github.com/en/developers/webhooks-and-events/webhooks/webhook-events-and-payloads#push
 type GitHubWebhookPayload struct {
-	Action       string       `json:"action,omitempty"`
-	Repository   Repository   `json:"repository"`
-	Installation Installation `json:"installation"`
-	Pusher       User         `json:"pusher,omitempty"`
-	Sender       User         `json:"sender"`
-	Ref          string       `json:"ref,omitempty"`
-	Commits      []Commit     `json:"commits,omitempty"`
+	Action       string        `json:"action,omitempty"`
+	Repository   Repository    `json:"repository"`
+	Installation Installation  `json:"installation"` // Zero for repository and organization webhooks, which aren't sent by a GitHub App
+	Organization *Organization `json:"organization,omitempty"`
+	Pusher       User          `json:"pusher,omitempty"`
+	Sender       User          `json:"sender"`
+	Ref          string        `json:"ref,omitempty"`
+	Created      bool          `json:"created,omitempty"` // The push created Ref
+	Compare      string        `json:"compare,omitempty"` // URL of the diff between the push's before and after commits
+	Commits      []Commit      `json:"commits,omitempty"`
+	HeadCommit   *Commit       `json:"head_commit,omitempty"`
+	Member       *User         `json:"member,omitempty"`
+	Team         *Team         `json:"team,omitempty"`
+
+	DeploymentStatus *DeploymentStatus `json:"deployment_status,omitempty"`
+	RegistryPackage  *RegistryPackage  `json:"registry_package,omitempty"`
+	Alert            *SecretAlert      `json:"alert,omitempty"`
 }
 
 // Repository represents a GitHub repository from webhook payload
 // The webhook includes the full repository object as documented in the REST API
 // Reference: https://docs.github.com/en/rest/repos/repos#get-a-repository
 type Repository struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	FullName string `json:"full_name"`
-	Private  bool   `json:"private"`
-	HTMLURL  string `json:"html_url"`
-	CloneURL string `json:"clone_url"`
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	FullName string   `json:"full_name"`
+	Private  bool     `json:"private"`
+	HTMLURL  string   `json:"html_url"`
+	CloneURL string   `json:"clone_url"`
+	Topics   []string `json:"topics,omitempty"`
 }
 
 // Installation represents a GitHub App installation
 // Reference: https://docs.github.com/en/rest/apps/installations#get-an-installation-for-the-authenticated-app
 type Installation struct {
-	ID      int `json:"id"`
+	ID      int  `json:"id"`
 	Account User `json:"account"`
 }
 
+// Organization represents the organization owning the repository, sent for
+// repositories owned by an organization
+type Organization struct {
+	ID    int    `json:"id"`
+	Login string `json:"login"`
+}
+
 // User represents a GitHub user or organization
 // Reference: https://docs.github.com/en/rest/users/users#get-a-user
 type User struct {
@@ -43,16 +61,71 @@ type User struct {
 	AvatarURL string `json:"avatar_url"`
 }
 
+// Team represents a GitHub organization team
+// Reference: https://docs.github.com/en/webhooks/webhook-events-and-payloads#team
+type Team struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	Permission string `json:"permission"`
+}
+
+// DeploymentStatus represents the status of a deployment (e.g. a GitHub Pages build)
+// Reference: https://docs.github.com/en/webhooks/webhook-events-and-payloads#deployment_status
+type DeploymentStatus struct {
+	ID             int    `json:"id"`
+	State          string `json:"state"`
+	Environment    string `json:"environment"`
+	EnvironmentURL string `json:"environment_url,omitempty"`
+	TargetURL      string `json:"target_url,omitempty"`
+}
+
+// RegistryPackage represents a package published to GitHub Packages
+// Reference: https://docs.github.com/en/webhooks/webhook-events-and-payloads#registry_package
+type RegistryPackage struct {
+	ID             int            `json:"id"`
+	Name           string         `json:"name"`
+	PackageType    string         `json:"package_type"`
+	PackageVersion PackageVersion `json:"package_version"`
+}
+
+// SecretAlert represents a secret scanning alert; the payload doesn't say where
+// the secret was found
+// Reference: https://docs.github.com/en/webhooks/webhook-events-and-payloads#secret_scanning_alert
+type SecretAlert struct {
+	Number                int    `json:"number"`
+	SecretType            string `json:"secret_type"`
+	SecretTypeDisplayName string `json:"secret_type_display_name,omitempty"`
+	State                 string `json:"state"`
+	Resolution            string `json:"resolution,omitempty"` // e.g. revoked, false_positive, used_in_tests
+	HTMLURL               string `json:"html_url"`
+}
+
+// PackageVersion represents one published version of a package
+type PackageVersion struct {
+	ID      int    `json:"id"`
+	Version string `json:"version"`
+	HTMLURL string `json:"html_url"`
+}
+
 // Commit represents a Git commit
 // Reference: https://docs.github.com/en/developers/webhooks-and-events/webhooks/webhook-events-and-payloads#push
 type Commit struct {
-	ID        string    `json:"id"`
-	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        string       `json:"id"`
+	Message   string       `json:"message"`
+	Timestamp time.Time    `json:"timestamp"`
 	Author    CommitAuthor `json:"author"`
-	Added     []string  `json:"added"`
-	Modified  []string  `json:"modified"`
-	Removed   []string  `json:"removed"`
+	Added     []string     `json:"added"`
+	Modified  []string     `json:"modified"`
+	Removed   []string     `json:"removed"`
+	Files     []CommitFile `json:"files,omitempty"` // Per-file stats; only in enriched (e.g. some GitHub Enterprise) payloads
+}
+
+// CommitFile holds the line stats of one file changed by a commit
+type CommitFile struct {
+	Filename  string `json:"filename"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
 }
 
 // CommitAuthor represents the author of a commit
@@ -63,12 +136,49 @@ type CommitAuthor struct {
 	Username string `json:"username,omitempty"`
 }
 
+// FileRename is a file moved within a push, detected from a removal and addition with the same file name
+type FileRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
 // WebhookEvent represents the processed webhook event for iOS app
 type WebhookEvent struct {
-	EventType      string `json:"event_type"`
-	RepositoryName string `json:"repository_name"`
-	InstallationID int    `json:"installation_id"`
-	Action         string `json:"action"`
-	HasMarkdownChanges bool `json:"has_markdown_changes"`
-	ChangedFiles   []string `json:"changed_files,omitempty"`
+	EventType            string       `json:"event_type"`
+	DeliveryID           string       `json:"delivery_id,omitempty"` // X-GitHub-Delivery of the originating webhook
+	RepositoryName       string       `json:"repository_name"`
+	RepositoryFullName   string       `json:"repository_full_name,omitempty"` // owner/name
+	Organization         string       `json:"organization,omitempty"`         // Login of the owning organization
+	Branch               string       `json:"branch,omitempty"`               // Pushed branch, without refs/heads/
+	RefCreated           bool         `json:"ref_created,omitempty"`          // The push created the branch or tag
+	RepositoryTopics     []string     `json:"repository_topics,omitempty"`
+	InstallationID       int          `json:"installation_id"` // 0 when not sent by a GitHub App
+	Action               string       `json:"action"`
+	HasMarkdownChanges   bool         `json:"has_markdown_changes"`
+	ChangedFiles         []string     `json:"changed_files,omitempty"` // Renamed files appear once, under their new path
+	RenamedFiles         []FileRename `json:"renamed_files,omitempty"`
+	Authors              []string     `json:"authors,omitempty"`
+	Member               string       `json:"member,omitempty"`
+	Team                 string       `json:"team,omitempty"`
+	SenderLogin          string       `json:"sender_login,omitempty"`
+	SenderAvatarURL      string       `json:"sender_avatar_url,omitempty"`
+	CommitAuthor         string       `json:"commit_author,omitempty"`          // Author of the push's head commit
+	CommitMessage        string       `json:"commit_message,omitempty"`         // First line of the head commit message
+	AutoGenerated        bool         `json:"auto_generated,omitempty"`         // Markdown pushed entirely by bots (BOT_DOCS_MODE=tag)
+	MarkdownLinesChanged int          `json:"markdown_lines_changed,omitempty"` // Only when the payload has per-file stats
+	CompareURL           string       `json:"compare_url,omitempty"`            // Diff of the push on GitHub
+
+	DeploymentState       string `json:"deployment_state,omitempty"`
+	DeploymentEnvironment string `json:"deployment_environment,omitempty"`
+	DeploymentURL         string `json:"deployment_url,omitempty"`
+
+	PackageName    string `json:"package_name,omitempty"`
+	PackageVersion string `json:"package_version,omitempty"`
+
+	AlertNumber     int    `json:"alert_number,omitempty"`
+	SecretType      string `json:"secret_type,omitempty"` // Display name when GitHub sends one
+	AlertResolution string `json:"alert_resolution,omitempty"`
+	AlertURL        string `json:"alert_url,omitempty"`
+
+	SummaryCount int `json:"summary_count,omitempty"` // Number of events merged into a summary notification
 }
\ No newline at end of file
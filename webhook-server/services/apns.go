@@ -1,20 +1,216 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sideshow/apns2"
 	"github.com/sideshow/apns2/token"
 	"mdtalkman-webhook/models"
 )
 
+// Pusher sends a single notification to APNs. *apns2.Client satisfies it.
+type Pusher interface {
+	PushWithContext(ctx apns2.Context, n *apns2.Notification) (*apns2.Response, error)
+}
+
+// reasonBadEnvironmentKeyInToken is returned when a token-auth key is used against the wrong environment
+const reasonBadEnvironmentKeyInToken = "BadEnvironmentKeyInToken"
+
+// Throttling (HTTP 429) handling. apns2 doesn't expose response headers, so
+// there is no Retry-After hint to honor; back off exponentially with full jitter.
+const (
+	maxThrottleRetries   = 3
+	throttleBreakerLimit = 5 // consecutive throttled pushes before failing fast
+	throttleCooldown     = 30 * time.Second
+)
+
+// throttleBaseBackoff bounds the first retry's backoff; tests shorten it
+var throttleBaseBackoff = 500 * time.Millisecond
+// Defaults for the availability breaker that fast-fails pushes while APNs is down
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
 // APNsService handles Apple Push Notifications
 type APNsService struct {
-	client        *apns2.Client
+	client        Pusher
+	fallback      Pusher // client for the opposite environment, retried on environment mismatches
 	bundleID      string
 	isDevelopment bool
 	token         *token.Token
+	lazy          *lazyInit       // builds the clients on first use; nil when built up front
+	throttle      *CircuitBreaker // opens while APNs is throttling us globally
+	breaker       *CircuitBreaker // opens while APNs is unreachable or failing
+
+	// Reloadable payload settings, guarded by settingsMu
+	settingsMu      sync.RWMutex
+	profiles        map[string]NotificationProfile // event type -> presentation, over the defaults
+	eventTopics     map[string]string              // event type -> bundle ID its pushes are sent to
+	includeSender   bool                           // add sender_login/sender_avatar_url to the custom payload
+	compressPayload bool                           // gzip+base64 the custom keys when that saves space
+	mutableContent  bool                           // let the notification service extension modify pushes
+	imageURL        string                         // image for the extension to attach; templated by BuildImageURL
+
+	pushMu             sync.Mutex
+	lastSuccessfulPush time.Time
+}
+
+// validInterruptionLevels are the aps interruption-level values supported by iOS 15+
+var validInterruptionLevels = map[string]bool{
+	"passive":        true,
+	"active":         true,
+	"time-sensitive": true,
+	"critical":       true,
+}
+
+// Payload versions a device can register for, so the payload can evolve
+// without breaking older app versions
+const (
+	PayloadVersionLegacy   = 1 // every key the payload had before versions existed
+	PayloadVersionEnriched = 2 // adds payload_version, branch, authors, changed_files and markdown_lines_changed
+)
+
+// maxPayloadChangedFiles caps the changed files listed in an enriched payload,
+// which must stay under the APNs size limit; /webhook/changes has all of them
+const maxPayloadChangedFiles = 10
+
+// defaultCategories are the aps categories the iOS app registers action buttons
+// for (e.g. "Open", "Mark Read"), by event type
+var defaultCategories = map[string]string{
+	"push":                  "MARKDOWN_UPDATE",
+	"deployment_status":     "DEPLOYMENT_UPDATE",
+	"registry_package":      "PACKAGE_UPDATE",
+	"secret_scanning_alert": "SECURITY_ALERT",
+	SummaryEventType:        "MARKDOWN_UPDATE",
+}
+
+// DisableEnvironmentFallback stops retrying pushes against the other APNs
+// environment when the configured one reports an environment mismatch
+func (a *APNsService) DisableEnvironmentFallback() {
+	if a.deferSetting(func(lazy *lazyInit) { lazy.noFallback = true }) {
+		return
+	}
+	a.fallback = nil
+}
+
+// SetPoolSize sends pushes round-robin over size APNs connections instead of
+// one. It only applies to token authentication; a size of 1 or less keeps a
+// single connection.
+func (a *APNsService) SetPoolSize(size int) {
+	if a.deferSetting(func(lazy *lazyInit) { lazy.poolSize = size }) {
+		return
+	}
+	if a.token == nil || size <= 1 {
+		return
+	}
+	a.client = newClientPool(a.token, a.isDevelopment, size)
+	log.Printf("📱 Using a pool of %d APNs connections", size)
+}
+
+// SetCircuitBreaker configures how many consecutive failed pushes (transport
+// errors or 5xx responses) open the APNs breaker and how long it stays open.
+// A threshold of 0 disables the breaker.
+func (a *APNsService) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		a.breaker = nil
+		return
+	}
+	a.breaker = NewCircuitBreaker("APNs", threshold, cooldown)
+}
+
+// Environment returns the APNs environment pushes target: "development",
+// "production", "simplified" when pushes are only logged, or "initializing"
+// while a lazily initialized service has no client yet
+func (a *APNsService) Environment() string {
+	if !a.Initialized() {
+		return "initializing"
+	}
+	if a.client == nil {
+		return "simplified"
+	}
+	return environmentName(a.isDevelopment)
+}
+
+// LastSuccessfulPush returns when APNs last accepted a push (zero if never)
+func (a *APNsService) LastSuccessfulPush() time.Time {
+	a.pushMu.Lock()
+	defer a.pushMu.Unlock()
+
+	return a.lastSuccessfulPush
+}
+
+// CircuitState returns the state of the APNs availability breaker
+func (a *APNsService) CircuitState() CircuitState {
+	if a.breaker == nil {
+		return CircuitClosed
+	}
+	return a.breaker.State()
+}
+
+// ThrottleState returns the state of the APNs throttling breaker
+func (a *APNsService) ThrottleState() CircuitState {
+	if a.throttle == nil {
+		return CircuitClosed
+	}
+	return a.throttle.State()
+}
+
+// SetIncludeSender controls whether notifications carry the sender's login and
+// avatar URL, e.g. for a notification service extension that shows the avatar
+func (a *APNsService) SetIncludeSender(include bool) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	a.includeSender = include
+}
+
+// SetMutableContent adds aps mutable-content so the app's notification service
+// extension can modify pushes, and an image_url for it to attach (e.g. a rendered
+// rendered preview of the changed markdown). imageURL is a template filled in by
+// BuildImageURL.
+func (a *APNsService) SetMutableContent(enabled bool, imageURL string) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	a.mutableContent = enabled
+	a.imageURL = imageURL
+}
+
+// SetCompressPayload gzips and base64-encodes the custom (non-aps) payload keys
+// whenever that makes the payload smaller and keeps it under the APNs limit
+func (a *APNsService) SetCompressPayload(compress bool) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	a.compressPayload = compress
+}
+
+// SetNotificationProfiles configures the priority, sound, interruption level,
+// category and push type of each event type's pushes. Invalid profiles are
+// logged and ignored.
+func (a *APNsService) SetNotificationProfiles(profiles map[string]NotificationProfile) {
+	validated := make(map[string]NotificationProfile)
+	for eventType, profile := range profiles {
+		if err := profile.Validate(); err != nil {
+			log.Printf("⚠️  Ignoring notification profile for event %s: %v", eventType, err)
+			continue
+		}
+		validated[NormalizeEventType(eventType)] = profile
+	}
+
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	a.profiles = validated
 }
 
 // NewAPNsService creates a new APNs service instance with certificate authentication
@@ -27,6 +223,8 @@ func NewAPNsService(certPath, bundleID string, isDevelopment bool) (*APNsService
 		return &APNsService{
 			bundleID:      bundleID,
 			isDevelopment: isDevelopment,
+			throttle:      NewCircuitBreaker("APNs throttle", throttleBreakerLimit, throttleCooldown),
+			breaker:       NewCircuitBreaker("APNs", defaultBreakerThreshold, defaultBreakerCooldown),
 		}, nil
 	}
 	
@@ -44,9 +242,9 @@ func NewAPNsServiceWithToken(keyPath, keyID, teamID, bundleID string, isDevelopm
 		maskPath(keyPath), keyID, teamID, bundleID, isDevelopment)
 	
 	// Load the private key from file
-	privateKey, err := token.AuthKeyFromFile(keyPath)
+	privateKey, err := LoadAuthKey(keyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load APNs private key: %w", err)
+		return nil, err
 	}
 	
 	// Create token
@@ -56,130 +254,501 @@ func NewAPNsServiceWithToken(keyPath, keyID, teamID, bundleID string, isDevelopm
 		TeamID:  teamID,
 	}
 	
-	// Create APNs client
-	var client *apns2.Client
+	// Create APNs client, keeping one for the other environment in case APNS_DEVELOPMENT is wrong
+	var client, fallback *apns2.Client
 	if isDevelopment {
 		client = apns2.NewTokenClient(token).Development()
+		fallback = apns2.NewTokenClient(token).Production()
 		log.Println("📱 Using APNs development environment")
 	} else {
 		client = apns2.NewTokenClient(token).Production()
+		fallback = apns2.NewTokenClient(token).Development()
 		log.Println("📱 Using APNs production environment")
 	}
 	
 	return &APNsService{
 		client:        client,
+		fallback:      fallback,
 		bundleID:      bundleID,
 		isDevelopment: isDevelopment,
 		token:         token,
+		throttle:      NewCircuitBreaker("APNs throttle", throttleBreakerLimit, throttleCooldown),
+		breaker:       NewCircuitBreaker("APNs", defaultBreakerThreshold, defaultBreakerCooldown),
 	}, nil
 }
 
-// SendNotification sends a push notification to the iOS app
-func (a *APNsService) SendNotification(deviceToken string, event *models.WebhookEvent) error {
+// NewAPNsServiceWithPusher creates an APNs service that sends through client,
+// e.g. a fake recording pushes in tests
+func NewAPNsServiceWithPusher(client Pusher, bundleID string, isDevelopment bool) *APNsService {
+	return &APNsService{
+		client:        client,
+		bundleID:      bundleID,
+		isDevelopment: isDevelopment,
+		throttle:      NewCircuitBreaker("APNs throttle", throttleBreakerLimit, throttleCooldown),
+		breaker:       NewCircuitBreaker("APNs", defaultBreakerThreshold, defaultBreakerCooldown),
+	}
+}
+
+// ReloadAuthKey switches token authentication to a new .p8 key, e.g. after
+// rotating it. The key is validated by signing a token with it before it
+// replaces the current one; all connections pick it up with their next push.
+func (a *APNsService) ReloadAuthKey(keyPath, keyID, teamID string) error {
+	if a.deferSetting(func(lazy *lazyInit) { lazy.keyPath, lazy.keyID, lazy.teamID = keyPath, keyID, teamID }) {
+		// Not initialized yet: try again right away with the new key
+		return a.initialize(true)
+	}
+	if a.token == nil {
+		return fmt.Errorf("APNs is not using token-based authentication")
+	}
+
+	privateKey, err := LoadAuthKey(keyPath)
+	if err != nil {
+		return err
+	}
+	replacement := &token.Token{AuthKey: privateKey, KeyID: keyID, TeamID: teamID}
+	if _, err := replacement.Generate(); err != nil {
+		return fmt.Errorf("failed to sign APNs token with the new key: %w", err)
+	}
+
+	a.token.Lock()
+	defer a.token.Unlock()
+
+	a.token.AuthKey = replacement.AuthKey
+	a.token.KeyID = replacement.KeyID
+	a.token.TeamID = replacement.TeamID
+	a.token.IssuedAt = replacement.IssuedAt
+	a.token.Bearer = replacement.Bearer
+	log.Printf("🔑 APNs auth key reloaded (KeyID: %s)", keyID)
+	return nil
+}
+
+// topicPushTypes maps the allowed APNs topic suffixes to the push type APNs expects for them
+var topicPushTypes = map[string]apns2.EPushType{
+	".voip":                 apns2.PushTypeVOIP,
+	".complication":         apns2.PushTypeComplication,
+	".pushkit.fileprovider": apns2.PushTypeFileProvider,
+}
+
+// IsValidTopicSuffix reports whether a device may register with the given topic suffix
+func IsValidTopicSuffix(suffix string) bool {
+	if suffix == "" {
+		return true
+	}
+	_, ok := topicPushTypes[suffix]
+	return ok
+}
+
+// Topic returns the APNs topic for a device: the bundle ID (or the event type's
+// override, see SetEventTopics) plus any registered suffix
+func (a *APNsService) Topic(device models.Device, eventType string) string {
+	a.settingsMu.RLock()
+	bundleID, ok := a.eventTopics[NormalizeEventType(eventType)]
+	a.settingsMu.RUnlock()
+	if !ok {
+		bundleID = a.bundleID
+	}
+	return bundleID + device.TopicSuffix
+}
+
+// SetEventTopics routes pushes for some event types to another bundle ID, e.g.
+// security alerts to a dedicated app; token authentication covers every app of
+// the team. Devices receiving them must have registered from that app.
+func (a *APNsService) SetEventTopics(topics map[string]string) {
+	normalized := make(map[string]string)
+	for eventType, bundleID := range topics {
+		if bundleID != "" {
+			normalized[NormalizeEventType(eventType)] = bundleID
+		}
+	}
+
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	a.eventTopics = normalized
+}
+
+// SendNotification sends a push notification to the iOS app. Failures are a
+// *TransportError when APNs couldn't be reached and a *PushError when it
+// refused the push (see push_errors.go).
+func (a *APNsService) SendNotification(ctx context.Context, device models.Device, event *models.WebhookEvent) error {
+	deviceToken := device.Token
+	if err := a.initialize(false); err != nil {
+		countPush(err)
+		return &TransportError{Service: "APNs", Err: err}
+	}
 	if a.client == nil {
 		// Simplified mode - just log
-		log.Printf("📱 [SIMPLIFIED] Would send push notification to device %s", maskDeviceToken(deviceToken))
+		log.Printf("📱 [SIMPLIFIED] Would send push notification to device %s", MaskToken(deviceToken))
 		log.Printf("📱 Event: %s, Repo: %s, Action: %s", event.EventType, event.RepositoryName, event.Action)
 		return nil
 	}
 	
 	// Create notification payload
-	payload := createNotificationPayload(event)
+	payload := a.createNotificationPayload(event, device)
+	a.settingsMu.RLock()
+	profile := a.profileFor(event.EventType)
+	a.settingsMu.RUnlock()
 	
 	// Create notification
 	notification := &apns2.Notification{
 		DeviceToken: deviceToken,
-		Topic:       a.bundleID,
+		Topic:       a.Topic(device, event.EventType),
 		Payload:     payload,
-		Priority:    apns2.PriorityHigh,
+		Priority:    profile.Priority,
+		PushType:    topicPushTypes[device.TopicSuffix],
+	}
+	if device.TopicSuffix == "" {
+		notification.PushType = apns2.EPushType(profile.PushType)
+	}
+	if (device.Silent || profile.PushType == string(apns2.PushTypeBackground)) && device.TopicSuffix == "" {
+		// Background pushes must be sent with low priority
+		notification.Priority = apns2.PriorityLow
+		notification.PushType = apns2.PushTypeBackground
 	}
 	
 	// Send notification
-	log.Printf("📱 Sending push notification to device %s", maskDeviceToken(deviceToken))
+	log.Printf("📱 Sending push notification to device %s", MaskToken(deviceToken))
 	log.Printf("📱 Event: %s, Repo: %s, HasMarkdown: %t", event.EventType, event.RepositoryName, event.HasMarkdownChanges)
 	
-	response, err := a.client.Push(notification)
+	err := a.send(ctx, notification)
+	countPush(err)
+	return err
+}
+
+// SendValidation sends a content-less background push to check that APNs still
+// accepts the device's token; a *PushError with status 410 or reason
+// BadDeviceToken means it doesn't
+func (a *APNsService) SendValidation(ctx context.Context, device models.Device) error {
+	if err := a.initialize(false); err != nil {
+		return &TransportError{Service: "APNs", Err: err}
+	}
+	if a.client == nil {
+		return nil
+	}
+
+	return a.send(ctx, &apns2.Notification{
+		DeviceToken: device.Token,
+		Topic:       a.bundleID,
+		Payload:     []byte(`{"aps":{"content-available":1}}`),
+		Priority:    apns2.PriorityLow,
+		PushType:    apns2.PushTypeBackground,
+	})
+}
+
+// send pushes a notification, retrying in the other environment on an environment mismatch
+func (a *APNsService) send(ctx context.Context, notification *apns2.Notification) error {
+	deviceToken := notification.DeviceToken
+	response, err := a.pushWithBackoff(ctx, notification)
 	if err != nil {
-		return fmt.Errorf("failed to send APNs notification: %w", err)
+		return err
 	}
 	
+	if response.StatusCode != 200 && a.fallback != nil && isEnvironmentMismatch(response) {
+		log.Printf("⚠️ APNs rejected device %s in the %s environment (%s); retrying in %s",
+			MaskToken(deviceToken), environmentName(a.isDevelopment), response.Reason, environmentName(!a.isDevelopment))
+
+		fallbackResponse, err := a.fallback.PushWithContext(ctx, notification)
+		if err != nil {
+			return &TransportError{Service: "APNs", Err: err}
+		}
+		if fallbackResponse.StatusCode == 200 {
+			log.Printf("⚠️ Push only succeeded in the %s environment - consider setting APNS_DEVELOPMENT=%t",
+				environmentName(!a.isDevelopment), !a.isDevelopment)
+			response = fallbackResponse
+		}
+		// Otherwise the configured environment's rejection is reported
+	}
+
 	if response.StatusCode != 200 {
 		log.Printf("⚠️ APNs response: %d - %s (ID: %s)", response.StatusCode, response.Reason, response.ApnsID)
-		return fmt.Errorf("APNs returned non-200 status: %d - %s", response.StatusCode, response.Reason)
+		return &PushError{Service: "APNs", StatusCode: response.StatusCode, Reason: response.Reason}
 	}
 	
 	log.Printf("✅ Push notification sent successfully (ID: %s)", response.ApnsID)
+	a.pushMu.Lock()
+	a.lastSuccessfulPush = time.Now()
+	a.pushMu.Unlock()
 	return nil
 }
 
-// SendBroadcast sends a notification to multiple device tokens
-func (a *APNsService) SendBroadcast(deviceTokens []string, event *models.WebhookEvent) error {
-	if len(deviceTokens) == 0 {
+// SendBroadcast sends a notification to multiple device tokens. When any device
+// fails, the error is a *BroadcastError with every device's outcome.
+func (a *APNsService) SendBroadcast(ctx context.Context, devices []models.Device, event *models.WebhookEvent) error {
+	if len(devices) == 0 {
 		return fmt.Errorf("no device tokens provided")
 	}
 
-	log.Printf("📱 Sending push notification to %d devices", len(deviceTokens))
+	log.Printf("📱 Sending push notification to %d devices", len(devices))
 	log.Printf("📱 Event: %s, Repo: %s, Action: %s, HasMarkdown: %t", 
 		event.EventType, event.RepositoryName, event.Action, event.HasMarkdownChanges)
 	
-	var errors []error
+	broadcastErr := &BroadcastError{}
 	successCount := 0
 	
-	for _, deviceToken := range deviceTokens {
-		err := a.SendNotification(deviceToken, event)
+	for i, device := range devices {
+		// Stop early if the caller's deadline has passed
+		if ctx.Err() != nil {
+			broadcastErr.Aborted = ctx.Err()
+			break
+		}
+
+		err := a.SendNotification(ctx, device, event)
+		if errors.Is(err, ErrCircuitOpen) {
+			// APNs is down or throttling every push; the remaining devices would fail too
+			log.Printf("🔌 %v, skipping the remaining %d devices", err, len(devices)-i)
+			broadcastErr.Aborted = err
+			break
+		}
 		if err != nil {
-			log.Printf("❌ Failed to send to device %s: %v", maskDeviceToken(deviceToken), err)
-			errors = append(errors, fmt.Errorf("device %s: %w", maskDeviceToken(deviceToken), err))
+			log.Printf("❌ Failed to send to device %s: %v", MaskToken(device.Token), err)
 		} else {
 			successCount++
 		}
+		broadcastErr.Results = append(broadcastErr.Results, newDeviceResult(device, err))
 	}
 	
-	log.Printf("📱 Broadcast complete: %d/%d devices successful", successCount, len(deviceTokens))
+	log.Printf("📱 Broadcast complete: %d/%d devices successful", successCount, len(devices))
 	
-	if len(errors) > 0 {
-		return fmt.Errorf("failed to send to %d devices: %v", len(errors), errors)
+	if successCount < len(devices) {
+		return broadcastErr
 	}
 	
 	return nil
 }
 
-// createNotificationPayload creates the APNs notification payload
-func createNotificationPayload(event *models.WebhookEvent) []byte {
-	// Create notification title and body based on event
-	title := "Repository Updated"
-	body := fmt.Sprintf("%s repository has been updated", event.RepositoryName)
-	
-	if event.HasMarkdownChanges {
-		title = "Markdown Files Updated"
-		body = fmt.Sprintf("New markdown content available in %s", event.RepositoryName)
+// pushWithBackoff sends a notification, retrying with jittered exponential
+// backoff while APNs responds 429 Too Many Requests. While either breaker is
+// open the push fails fast with ErrCircuitOpen.
+func (a *APNsService) pushWithBackoff(ctx context.Context, notification *apns2.Notification) (*apns2.Response, error) {
+	if a.breaker != nil && !a.breaker.Allow() {
+		return nil, fmt.Errorf("APNs is unavailable: %w", ErrCircuitOpen)
 	}
-	
+	if a.throttle != nil && !a.throttle.Allow() {
+		return nil, fmt.Errorf("APNs is throttling pushes: %w", ErrCircuitOpen)
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := a.client.PushWithContext(ctx, notification)
+		if a.breaker != nil {
+			if err != nil || response.StatusCode >= 500 {
+				a.breaker.RecordFailure()
+			} else {
+				a.breaker.RecordSuccess()
+			}
+		}
+		if err != nil {
+			return nil, &TransportError{Service: "APNs", Err: err}
+		}
+		if response.StatusCode != 429 {
+			if a.throttle != nil {
+				a.throttle.RecordSuccess()
+			}
+			return response, nil
+		}
+
+		if attempt >= maxThrottleRetries {
+			if a.throttle != nil {
+				a.throttle.RecordFailure()
+			}
+			return response, nil
+		}
+
+		// Full jitter: sleep a random duration up to base * 2^attempt
+		backoff := time.Duration(rand.Int63n(int64(throttleBaseBackoff << attempt)))
+		log.Printf("⏳ APNs throttled (%s), retrying in %s", response.Reason, backoff.Round(time.Millisecond))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, &TransportError{Service: "APNs", Err: ctx.Err()}
+		}
+	}
+}
+
+// isEnvironmentMismatch reports whether APNs rejected a push because the token
+// belongs to the other (sandbox vs production) environment. BadDeviceToken isn't
+// one: it's what APNs answers for invalid and expired tokens.
+func isEnvironmentMismatch(response *apns2.Response) bool {
+	switch response.Reason {
+	case reasonBadEnvironmentKeyInToken, apns2.ReasonBadCertificateEnvironment:
+		return true
+	default:
+		return false
+	}
+}
+
+// environmentName returns the APNs environment name for logging
+func environmentName(isDevelopment bool) string {
+	if isDevelopment {
+		return "development"
+	}
+	return "production"
+}
+
+// RenderPayload returns the APNs payload that would be sent for event to a
+// device registered with payloadVersion, without sending it
+func (a *APNsService) RenderPayload(event *models.WebhookEvent, payloadVersion int) []byte {
+	return a.createNotificationPayload(event, models.Device{Badge: 1, PayloadVersion: payloadVersion})
+}
+
+// createNotificationPayload creates the APNs notification payload with the device's
+// unread count as the badge, or a background payload for silent pushes
+func (a *APNsService) createNotificationPayload(event *models.WebhookEvent, device models.Device) []byte {
+	title, body := notificationText(event)
+	badge := device.Badge
+	if badge < 1 {
+		badge = 1
+	}
+
+	a.settingsMu.RLock()
+	defer a.settingsMu.RUnlock()
+	profile := a.profileFor(event.EventType)
+
 	// APNs payload format
-	payload := fmt.Sprintf(`{
-		"aps": {
-			"alert": {
-				"title": "%s",
-				"body": "%s"
-			},
-			"sound": "default",
-			"badge": 1,
-			"content-available": 1
+	aps := map[string]interface{}{
+		"alert": map[string]string{
+			"title": title,
+			"body":  body,
 		},
-		"repository": "%s",
-		"event_type": "%s",
-		"has_markdown": %t
-	}`, title, body, event.RepositoryName, event.EventType, event.HasMarkdownChanges)
+		"badge":             badge,
+		"content-available": 1,
+	}
+	if profile.Sound != noValue {
+		aps["sound"] = profile.Sound
+	}
+	if profile.InterruptionLevel != "" {
+		aps["interruption-level"] = profile.InterruptionLevel
+	}
+	if profile.Category != "" && profile.Category != noValue {
+		aps["category"] = profile.Category
+	}
+	if a.mutableContent {
+		aps["mutable-content"] = 1
+	}
+	if device.Silent || profile.PushType == string(apns2.PushTypeBackground) {
+		// Let the app refresh in the background without disturbing the user
+		aps = map[string]interface{}{"content-available": 1}
+	}
+
+	custom := map[string]interface{}{
+		"aps":          aps,
+		"repository":   event.RepositoryName,
+		"event_type":   event.EventType,
+		"has_markdown": event.HasMarkdownChanges,
+	}
+	if event.AutoGenerated {
+		custom["auto_generated"] = true
+	}
+	if event.CompareURL != "" {
+		// Lets the app link to the push's diff
+		custom["compare_url"] = event.CompareURL
+	}
+	if event.DeliveryID != "" && event.HasMarkdownChanges {
+		// Lets the app fetch the changed files from /webhook/changes
+		custom["delivery_id"] = event.DeliveryID
+	}
+	if a.mutableContent && a.imageURL != "" && !device.Silent {
+		if imageURL := BuildImageURL(a.imageURL, event); imageURL != "" {
+			custom["image_url"] = imageURL
+		}
+	}
+	if device.Canary {
+		// Lets canary builds of the app opt into new payload handling
+		custom["canary"] = true
+	}
+	if a.includeSender && event.SenderLogin != "" {
+		custom["sender_login"] = event.SenderLogin
+		custom["sender_avatar_url"] = event.SenderAvatarURL
+	}
+	if device.PayloadVersion >= PayloadVersionEnriched {
+		// Keys that app versions predating payload versions don't expect
+		addEnrichedKeys(custom, event)
+	}
+
+	payload, _ := json.Marshal(custom)
+	if a.compressPayload {
+		if compressed, ok := compressCustomPayload(aps, custom, len(payload)); ok {
+			return compressed
+		}
+	}
 	
-	return []byte(payload)
+	return payload
+}
+
+// addEnrichedKeys adds the keys of PayloadVersionEnriched to a payload's custom keys
+func addEnrichedKeys(custom map[string]interface{}, event *models.WebhookEvent) {
+	custom["payload_version"] = PayloadVersionEnriched
+	if event.Branch != "" {
+		custom["branch"] = event.Branch
+	}
+	if len(event.Authors) > 0 {
+		custom["authors"] = event.Authors
+	}
+	if markdown := filterMarkdown(event.ChangedFiles); len(markdown) > 0 {
+		if len(markdown) > maxPayloadChangedFiles {
+			markdown = markdown[:maxPayloadChangedFiles]
+		}
+		custom["changed_files"] = markdown
+	}
+	if event.MarkdownLinesChanged > 0 {
+		custom["markdown_lines_changed"] = event.MarkdownLinesChanged
+	}
+}
+
+// WelcomeEventType is the event type of the push confirming a new registration
+const WelcomeEventType = "welcome"
+
+// notificationText creates the notification title and body based on the event
+func notificationText(event *models.WebhookEvent) (string, string) {
+	switch event.EventType {
+	case "member":
+		if event.Action == "removed" {
+			return "Collaborator Access Removed", fmt.Sprintf("%s was removed as a collaborator on %s", event.Member, event.RepositoryName)
+		}
+		return "Collaborator Access Granted", fmt.Sprintf("%s was added as a collaborator on %s", event.Member, event.RepositoryName)
+	case "team":
+		if event.Action == "removed_from_repository" {
+			return "Team Access Removed", fmt.Sprintf("Team %s no longer has access to %s", event.Team, event.RepositoryName)
+		}
+		return "Team Access Granted", fmt.Sprintf("Team %s now has access to %s", event.Team, event.RepositoryName)
+	case "deployment_status":
+		if event.DeploymentState == "failure" {
+			return "Docs Deployment Failed", fmt.Sprintf("Deploying %s to %s failed", event.RepositoryName, event.DeploymentEnvironment)
+		}
+		return "Docs Deployed", fmt.Sprintf("%s was deployed to %s", event.RepositoryName, event.DeploymentEnvironment)
+	case "secret_scanning_alert":
+		if event.Action == "resolved" {
+			return "Secret Alert Resolved", fmt.Sprintf("Alert #%d (%s) in %s was resolved: %s",
+				event.AlertNumber, event.SecretType, event.RepositoryName, strings.ReplaceAll(event.AlertResolution, "_", " "))
+		}
+		return "⚠️ Secret Leaked", fmt.Sprintf("A %s was committed to %s (alert #%d). Revoke it now, then resolve the alert.",
+			event.SecretType, event.RepositoryName, event.AlertNumber)
+	case "registry_package":
+		return "Package Published", fmt.Sprintf("%s %s was published from %s", event.PackageName, event.PackageVersion, event.RepositoryName)
+	case SummaryEventType:
+		return fmt.Sprintf("%d Repository Updates", event.SummaryCount), fmt.Sprintf("New changes in %s", event.RepositoryName)
+	case WelcomeEventType:
+		return "Notifications Enabled", "You'll be notified here when markdown changes in your repositories"
+	}
+
+	if event.HasMarkdownChanges {
+		if event.AutoGenerated {
+			return "Auto-generated Docs Update", fmt.Sprintf("%s: %s", event.RepositoryName, commitSummary(event))
+		}
+		if event.CommitMessage != "" {
+			return "Markdown Files Updated", fmt.Sprintf("%s: %s", event.RepositoryName, commitSummary(event))
+		}
+		return "Markdown Files Updated", fmt.Sprintf("New markdown content available in %s", event.RepositoryName)
+	}
+	return "Repository Updated", fmt.Sprintf("%s repository has been updated", event.RepositoryName)
 }
 
-// maskDeviceToken masks a device token for logging (security)
-func maskDeviceToken(token string) string {
-	if len(token) < 8 {
-		return "***"
+// commitSummary describes the head commit of a push, e.g. "Fix typo (alice)"
+func commitSummary(event *models.WebhookEvent) string {
+	if event.CommitAuthor == "" {
+		return event.CommitMessage
 	}
-	return token[:4] + "..." + token[len(token)-4:]
+	return fmt.Sprintf("%s (%s)", event.CommitMessage, event.CommitAuthor)
 }
 
 // maskPath masks a file path for logging (security)
@@ -200,7 +769,9 @@ func maskPath(path string) string {
 
 // Close closes the APNs connection
 func (a *APNsService) Close() {
-	if a.client != nil {
+	if !a.Initialized() {
+		log.Println("📱 APNs service closed (never initialized)")
+	} else if a.client != nil {
 		log.Println("📱 APNs service closed")
 		// The apns2 client doesn't need explicit closing
 	} else {
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/sideshow/apns2/token"
+)
+
+// apnsKeyHint tells operators what APNS_KEY_PATH must hold
+const apnsKeyHint = "expected a PKCS#8 EC private key (.p8) as downloaded from Certificates, Identifiers & Profiles > Keys"
+
+// LoadAuthKey reads an APNs .p8 auth key, explaining what is wrong with the
+// file when it is missing, truncated or in another format
+func LoadAuthKey(keyPath string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("APNs key %s is not readable: %w", keyPath, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("APNs key %s is not PEM encoded (truncated or binary file?): %s", keyPath, apnsKeyHint)
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("APNs key %s holds a %q block: %s", keyPath, block.Type, apnsKeyHint)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("APNs key %s could not be parsed (%v): %s", keyPath, err, apnsKeyHint)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("APNs key %s holds a %T: %s", keyPath, parsed, apnsKeyHint)
+	}
+	return key, nil
+}
+
+// ValidateAuthKey checks that the .p8 key at keyPath loads and signs an APNs
+// provider token with keyID and teamID
+func ValidateAuthKey(keyPath, keyID, teamID string) error {
+	key, err := LoadAuthKey(keyPath)
+	if err != nil {
+		return err
+	}
+	if _, err := (&token.Token{AuthKey: key, KeyID: keyID, TeamID: teamID}).Generate(); err != nil {
+		return fmt.Errorf("APNs key %s cannot sign a provider token: %w", keyPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotInitialized is wrapped by errors from a lazily initialized APNs service
+// whose client couldn't be built yet
+var ErrNotInitialized = errors.New("APNs client is not initialized")
+
+// lazyAttemptInterval limits how often sending a push retries initialization
+const lazyAttemptInterval = 5 * time.Second
+
+// lazyInit holds what a lazily initialized APNs service needs to build its
+// clients, and the settings made before they existed
+type lazyInit struct {
+	keyPath, keyID, teamID string
+	done                   atomic.Bool // set once the clients are built; they don't change afterwards
+
+	mu          sync.Mutex
+	lastAttempt time.Time
+	lastErr     error
+	noFallback  bool // DisableEnvironmentFallback was called
+	poolSize    int  // SetPoolSize was called
+}
+
+// NewLazyAPNsServiceWithToken creates an APNs service for token authentication
+// that builds its clients on first use instead of failing when the key can't be
+// loaded yet (e.g. a secret mounted after startup). Until then pushes fail with
+// ErrNotInitialized and Initialized reports false; call RetryInitialization to
+// keep trying in the background.
+func NewLazyAPNsServiceWithToken(keyPath, keyID, teamID, bundleID string, isDevelopment bool) *APNsService {
+	a := &APNsService{
+		bundleID:      bundleID,
+		isDevelopment: isDevelopment,
+		lazy:          &lazyInit{keyPath: keyPath, keyID: keyID, teamID: teamID},
+		throttle:      NewCircuitBreaker("APNs throttle", throttleBreakerLimit, throttleCooldown),
+		breaker:       NewCircuitBreaker("APNs", defaultBreakerThreshold, defaultBreakerCooldown),
+	}
+	if err := a.initialize(true); err != nil {
+		log.Printf("⚠️  APNs not initialized yet, will retry: %v", err)
+	}
+	return a
+}
+
+// Initialized reports whether the APNs clients have been built; services that
+// aren't lazily initialized always are
+func (a *APNsService) Initialized() bool {
+	return a.lazy == nil || a.lazy.done.Load()
+}
+
+// RetryInitialization tries to build the clients every interval until it succeeds
+func (a *APNsService) RetryInitialization(interval time.Duration) {
+	if a.Initialized() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := a.initialize(true)
+			if err == nil {
+				return
+			}
+			log.Printf("⚠️  APNs still not initialized, retrying in %s: %v", interval, err)
+		}
+	}()
+}
+
+// initialize builds the clients of a lazily initialized service unless that
+// has happened already. Unless force is set, failed attempts are retried at
+// most every lazyAttemptInterval and return the last error in between.
+func (a *APNsService) initialize(force bool) error {
+	if a.Initialized() {
+		return nil
+	}
+
+	lazy := a.lazy
+	lazy.mu.Lock()
+	defer lazy.mu.Unlock()
+
+	if lazy.done.Load() {
+		return nil
+	}
+	if !force && time.Since(lazy.lastAttempt) < lazyAttemptInterval {
+		return fmt.Errorf("%w: %v", ErrNotInitialized, lazy.lastErr)
+	}
+	lazy.lastAttempt = time.Now()
+
+	built, err := NewAPNsServiceWithToken(lazy.keyPath, lazy.keyID, lazy.teamID, a.bundleID, a.isDevelopment)
+	if err != nil {
+		lazy.lastErr = err
+		return fmt.Errorf("%w: %v", ErrNotInitialized, err)
+	}
+
+	a.token = built.token
+	a.client = built.client
+	if !lazy.noFallback {
+		a.fallback = built.fallback
+	}
+	if lazy.poolSize > 1 {
+		a.client = newClientPool(a.token, a.isDevelopment, lazy.poolSize)
+		log.Printf("📱 Using a pool of %d APNs connections", lazy.poolSize)
+	}
+	lazy.done.Store(true)
+	log.Printf("✅ APNs client initialized for %s", a.bundleID)
+	return nil
+}
+
+// deferSetting records a client setting made before a lazily initialized
+// service has its clients, reporting whether it was deferred
+func (a *APNsService) deferSetting(apply func(lazy *lazyInit)) bool {
+	if a.Initialized() {
+		return false
+	}
+
+	a.lazy.mu.Lock()
+	defer a.lazy.mu.Unlock()
+
+	if a.lazy.done.Load() {
+		return false
+	}
+	apply(a.lazy)
+	return true
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"sync/atomic"
+
+	"github.com/sideshow/apns2"
+	"github.com/sideshow/apns2/token"
+)
+
+// clientPool spreads pushes round-robin over several apns2 clients. Each client
+// has its own HTTP/2 connection, so a pool avoids one connection's
+// concurrent-stream limit becoming the bottleneck under high push volume.
+type clientPool struct {
+	clients []Pusher
+	next    atomic.Uint64
+}
+
+// newClientPool creates size token-authenticated clients for one APNs environment
+func newClientPool(authToken *token.Token, isDevelopment bool, size int) *clientPool {
+	pool := &clientPool{clients: make([]Pusher, size)}
+	for i := range pool.clients {
+		client := apns2.NewTokenClient(authToken)
+		if isDevelopment {
+			client = client.Development()
+		} else {
+			client = client.Production()
+		}
+		pool.clients[i] = client
+	}
+	return pool
+}
+
+// PushWithContext sends the notification on the next client in turn
+func (p *clientPool) PushWithContext(ctx apns2.Context, n *apns2.Notification) (*apns2.Response, error) {
+	i := p.next.Add(1) - 1
+	return p.clients[i%uint64(len(p.clients))].PushWithContext(ctx, n)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sideshow/apns2"
+)
+
+// countingPusher counts the pushes it receives and answers each with 200
+type countingPusher struct {
+	pushes atomic.Int64
+}
+
+func (p *countingPusher) PushWithContext(ctx apns2.Context, n *apns2.Notification) (*apns2.Response, error) {
+	p.pushes.Add(1)
+	return &apns2.Response{StatusCode: 200}, nil
+}
+
+// newCountingPool returns a pool of size counting pushers
+func newCountingPool(size int) (*clientPool, []*countingPusher) {
+	pool := &clientPool{clients: make([]Pusher, size)}
+	pushers := make([]*countingPusher, size)
+	for i := range pushers {
+		pushers[i] = &countingPusher{}
+		pool.clients[i] = pushers[i]
+	}
+	return pool, pushers
+}
+
+func TestClientPoolSpreadsPushesEvenly(t *testing.T) {
+	for _, size := range []int{1, 3, 8} {
+		t.Run(fmt.Sprintf("%d clients", size), func(t *testing.T) {
+			pool, pushers := newCountingPool(size)
+			const perClient = 50
+
+			var wg sync.WaitGroup
+			for i := 0; i < size*perClient; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					pool.PushWithContext(context.Background(), &apns2.Notification{})
+				}()
+			}
+			wg.Wait()
+
+			for i, p := range pushers {
+				if got := p.pushes.Load(); got != perClient {
+					t.Errorf("client %d got %d pushes, want %d", i, got, perClient)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	for _, size := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("%d clients", size), func(b *testing.B) {
+			pool, _ := newCountingPool(size)
+			notification := &apns2.Notification{}
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					pool.PushWithContext(context.Background(), notification)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sideshow/apns2"
+	"mdtalkman-webhook/models"
+)
+
+// scriptedPusher answers pushes with the given status codes in order, then 200
+type scriptedPusher struct {
+	statuses []int
+	calls    int
+}
+
+func (p *scriptedPusher) PushWithContext(ctx apns2.Context, n *apns2.Notification) (*apns2.Response, error) {
+	status := http.StatusOK
+	if p.calls < len(p.statuses) {
+		status = p.statuses[p.calls]
+	}
+	p.calls++
+	if status == http.StatusTooManyRequests {
+		return &apns2.Response{StatusCode: status, Reason: apns2.ReasonTooManyRequests}, nil
+	}
+	return &apns2.Response{StatusCode: status}, nil
+}
+
+func TestSendNotificationRetriesThrottledPush(t *testing.T) {
+	defer func(base time.Duration) { throttleBaseBackoff = base }(throttleBaseBackoff)
+	throttleBaseBackoff = time.Millisecond
+
+	pusher := &scriptedPusher{statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests}}
+	a := NewAPNsServiceWithPusher(pusher, "com.example.mdtalkman", true)
+
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+	if err := a.SendNotification(context.Background(), device, &models.WebhookEvent{EventType: "push"}); err != nil {
+		t.Fatalf("SendNotification: %v", err)
+	}
+	if pusher.calls != 3 {
+		t.Errorf("pushes = %d, want 3", pusher.calls)
+	}
+}
+
+func TestSendNotificationGivesUpWhenThrottled(t *testing.T) {
+	defer func(base time.Duration) { throttleBaseBackoff = base }(throttleBaseBackoff)
+	throttleBaseBackoff = time.Millisecond
+
+	statuses := make([]int, maxThrottleRetries+1)
+	for i := range statuses {
+		statuses[i] = http.StatusTooManyRequests
+	}
+	pusher := &scriptedPusher{statuses: statuses}
+	a := NewAPNsServiceWithPusher(pusher, "com.example.mdtalkman", true)
+
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+	err := a.SendNotification(context.Background(), device, &models.WebhookEvent{EventType: "push"})
+	pushErr, ok := err.(*PushError)
+	if !ok || pushErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("SendNotification error = %v, want a 429 *PushError", err)
+	}
+	if pusher.calls != maxThrottleRetries+1 {
+		t.Errorf("pushes = %d, want %d", pusher.calls, maxThrottleRetries+1)
+	}
+}
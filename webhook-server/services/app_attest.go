@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// AppAttestProof is the App Attest evidence a device sends when registering:
+// an attestation the first time a key is used, an assertion afterwards. Both
+// are made over the SHA-256 of the device token as client data.
+type AppAttestProof struct {
+	KeyID       string `json:"key_id"`                // base64 key identifier from generateKey
+	Attestation string `json:"attestation,omitempty"` // base64 CBOR attestation object from attestKey
+	Assertion   string `json:"assertion,omitempty"`   // base64 CBOR assertion from generateAssertion
+}
+
+// AttestationVerifier checks a registration's App Attest proof before its token is stored
+type AttestationVerifier interface {
+	VerifyRegistration(deviceToken string, proof *AppAttestProof) error
+}
+
+// appAttestNonceOID is the credential certificate extension holding the attestation nonce
+var appAttestNonceOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+
+// App Attest AAGUIDs of the development and production environments
+var (
+	aaguidDevelopment = []byte("appattestdevelop")
+	aaguidProduction  = append([]byte("appattest"), make([]byte, 7)...)
+)
+
+// attestedKey is a key whose attestation verified, with the last assertion
+// counter seen. A key only vouches for the device token it was attested for.
+type attestedKey struct {
+	publicKey *ecdsa.PublicKey
+	tokenHash []byte // SHA-256 of the device token
+	counter   uint32
+}
+
+// savedKey is an attested key as persisted by PersistKeys
+type savedKey struct {
+	KeyID     string `json:"key_id"`
+	PublicKey []byte `json:"public_key"` // PKIX DER
+	TokenHash []byte `json:"token_hash"`
+	Counter   uint32 `json:"counter"`
+}
+
+// AppAttestVerifier verifies Apple App Attest attestations and assertions
+// against Apple's App Attest root CA. Attested keys are kept in memory unless
+// PersistKeys is called; without it, devices must attest a new key after a restart.
+type AppAttestVerifier struct {
+	appID         string // team ID + "." + bundle ID
+	roots         *x509.CertPool
+	isDevelopment bool
+
+	mu   sync.Mutex
+	keys map[string]*attestedKey // base64 key ID -> key
+	path string                  // file the keys are saved to; empty keeps them in memory
+}
+
+// NewAppAttestVerifier creates a verifier for appID ("TEAMID.bundle.id") trusting
+// the App Attest root CA certificate (PEM) at rootCAPath
+func NewAppAttestVerifier(appID, rootCAPath string, isDevelopment bool) (*AppAttestVerifier, error) {
+	data, err := os.ReadFile(rootCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read App Attest root CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("App Attest root CA %s holds no PEM certificate", rootCAPath)
+	}
+
+	return &AppAttestVerifier{
+		appID:         appID,
+		roots:         roots,
+		isDevelopment: isDevelopment,
+		keys:          make(map[string]*attestedKey),
+	}, nil
+}
+
+// PersistKeys loads the keys attested before a restart from path and saves
+// every key attested or used from now on there, so devices keep registering
+// with assertions. App Attest can only attest a key once.
+func (v *AppAttestVerifier) PersistKeys(path string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read App Attest keys: %w", err)
+	}
+	var saved []savedKey
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to read App Attest keys: %w", err)
+	}
+	for _, key := range saved {
+		parsed, err := x509.ParsePKIXPublicKey(key.PublicKey)
+		publicKey, ok := parsed.(*ecdsa.PublicKey)
+		if err != nil || !ok {
+			return fmt.Errorf("failed to read App Attest keys: key %s is not an EC public key", key.KeyID)
+		}
+		v.keys[key.KeyID] = &attestedKey{publicKey: publicKey, tokenHash: key.TokenHash, counter: key.Counter}
+	}
+	return nil
+}
+
+// save writes the attested keys to path; callers hold mu
+func (v *AppAttestVerifier) save() {
+	if v.path == "" {
+		return
+	}
+
+	saved := make([]savedKey, 0, len(v.keys))
+	for keyID, key := range v.keys {
+		der, err := x509.MarshalPKIXPublicKey(key.publicKey)
+		if err != nil {
+			log.Printf("Error saving App Attest key %s: %v", keyID, err)
+			continue
+		}
+		saved = append(saved, savedKey{KeyID: keyID, PublicKey: der, TokenHash: key.tokenHash, Counter: key.counter})
+	}
+	data, _ := json.Marshal(saved)
+	tmpPath := v.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		log.Printf("Error saving App Attest keys: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, v.path); err != nil {
+		log.Printf("Error saving App Attest keys: %v", err)
+	}
+}
+
+// VerifyRegistration verifies the proof's attestation (remembering the key for
+// deviceToken) or its assertion (with a key attested earlier for deviceToken)
+func (v *AppAttestVerifier) VerifyRegistration(deviceToken string, proof *AppAttestProof) error {
+	if proof == nil || proof.KeyID == "" {
+		return errors.New("missing App Attest proof")
+	}
+	clientDataHash := sha256.Sum256([]byte(deviceToken))
+
+	switch {
+	case proof.Attestation != "":
+		return v.verifyAttestation(proof.KeyID, proof.Attestation, clientDataHash[:])
+	case proof.Assertion != "":
+		return v.verifyAssertion(proof.KeyID, proof.Assertion, clientDataHash[:])
+	}
+	return errors.New("App Attest proof needs an attestation or an assertion")
+}
+
+// verifyAttestation follows Apple's steps for validating an attestation object
+func (v *AppAttestVerifier) verifyAttestation(keyID, attestation string, clientDataHash []byte) error {
+	keyIDBytes, err := base64.StdEncoding.DecodeString(keyID)
+	if err != nil {
+		return errors.New("key ID is not base64")
+	}
+	raw, err := base64.StdEncoding.DecodeString(attestation)
+	if err != nil {
+		return errors.New("attestation is not base64")
+	}
+	decoded, err := decodeCBOR(raw)
+	if err != nil {
+		return fmt.Errorf("invalid attestation: %w", err)
+	}
+
+	object, _ := decoded.(map[string]interface{})
+	format, _ := object["fmt"].(string)
+	authData, _ := object["authData"].([]byte)
+	statement, _ := object["attStmt"].(map[string]interface{})
+	chain, _ := statement["x5c"].([]interface{})
+	if format != "apple-appattest" || authData == nil || len(chain) == 0 {
+		return errors.New("attestation is not an apple-appattest object")
+	}
+
+	// The credential certificate must chain to the App Attest root
+	certs := make([]*x509.Certificate, len(chain))
+	for i, item := range chain {
+		der, _ := item.([]byte)
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return fmt.Errorf("invalid attestation certificate: %w", err)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("attestation certificate is not trusted: %w", err)
+	}
+
+	// The certificate's nonce binds it to this authenticator data and client data
+	nonce := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	certNonce, err := attestationNonce(certs[0])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(certNonce, nonce[:]) {
+		return errors.New("attestation nonce does not match")
+	}
+
+	publicKey, ok := certs[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("attested key is not an EC key")
+	}
+	point := elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y)
+	if keyHash := sha256.Sum256(point); !bytes.Equal(keyHash[:], keyIDBytes) {
+		return errors.New("attested key does not match the key ID")
+	}
+
+	// rpIdHash(32) flags(1) counter(4) aaguid(16) credentialIdLength(2) credentialId
+	if len(authData) < 55 {
+		return errors.New("attestation authenticator data is truncated")
+	}
+	if err := v.checkAppID(authData); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(authData[33:37]) != 0 {
+		return errors.New("attestation counter is not zero")
+	}
+	aaguid := aaguidProduction
+	if v.isDevelopment {
+		aaguid = aaguidDevelopment
+	}
+	if !bytes.Equal(authData[37:53], aaguid) {
+		return errors.New("attestation is for the wrong App Attest environment")
+	}
+	credentialLength := int(binary.BigEndian.Uint16(authData[53:55]))
+	if len(authData) < 55+credentialLength || !bytes.Equal(authData[55:55+credentialLength], keyIDBytes) {
+		return errors.New("attestation credential ID does not match the key ID")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, exists := v.keys[keyID]; exists {
+		return errors.New("key was already attested")
+	}
+	v.keys[keyID] = &attestedKey{publicKey: publicKey, tokenHash: clientDataHash}
+	v.save()
+	return nil
+}
+
+// verifyAssertion checks an assertion's signature with the attested key and
+// that its counter increased, which rejects replays
+func (v *AppAttestVerifier) verifyAssertion(keyID, assertion string, clientDataHash []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(assertion)
+	if err != nil {
+		return errors.New("assertion is not base64")
+	}
+	decoded, err := decodeCBOR(raw)
+	if err != nil {
+		return fmt.Errorf("invalid assertion: %w", err)
+	}
+	object, _ := decoded.(map[string]interface{})
+	signature, _ := object["signature"].([]byte)
+	authData, _ := object["authenticatorData"].([]byte)
+	if signature == nil || len(authData) < 37 {
+		return errors.New("assertion is missing its signature or authenticator data")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[keyID]
+	if !ok {
+		return errors.New("key has not been attested")
+	}
+	if !bytes.Equal(key.tokenHash, clientDataHash) {
+		// Otherwise one genuine install could register any device token
+		return errors.New("key was attested for another device token")
+	}
+	nonce := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	digest := sha256.Sum256(nonce[:])
+	if !ecdsa.VerifyASN1(key.publicKey, digest[:], signature) {
+		return errors.New("assertion signature is invalid")
+	}
+	if err := v.checkAppID(authData); err != nil {
+		return err
+	}
+	counter := binary.BigEndian.Uint32(authData[33:37])
+	if counter <= key.counter {
+		return errors.New("assertion counter did not increase")
+	}
+	key.counter = counter
+	v.save()
+	return nil
+}
+
+// checkAppID verifies the authenticator data's relying party ID hash is this app's
+func (v *AppAttestVerifier) checkAppID(authData []byte) error {
+	appIDHash := sha256.Sum256([]byte(v.appID))
+	if !bytes.Equal(authData[:32], appIDHash[:]) {
+		return errors.New("App Attest proof is for a different app")
+	}
+	return nil
+}
+
+// attestationNonce extracts the nonce from a credential certificate's App Attest
+// extension: SEQUENCE { [1] EXPLICIT OCTET STRING }
+func attestationNonce(cert *x509.Certificate) ([]byte, error) {
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(appAttestNonceOID) {
+			continue
+		}
+		var sequence, tagged asn1.RawValue
+		var nonce []byte
+		if _, err := asn1.Unmarshal(extension.Value, &sequence); err != nil {
+			break
+		}
+		if _, err := asn1.Unmarshal(sequence.Bytes, &tagged); err != nil {
+			break
+		}
+		if _, err := asn1.Unmarshal(tagged.Bytes, &nonce); err != nil {
+			break
+		}
+		return nonce, nil
+	}
+	return nil, errors.New("attestation certificate has no valid nonce extension")
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAppID = "TEAMID1234.com.example.mdtalkman"
+
+// encodeCBOR encodes the types decodeCBOR produces, for building App Attest objects in tests
+func encodeCBOR(value interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		case n <= 0xffffffff:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+
+	switch v := value.(type) {
+	case uint64:
+		return head(0, v)
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[string]interface{}:
+		out := head(5, uint64(len(v)))
+		for key, item := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// attestCA is a stand-in for Apple's App Attest root CA
+type attestCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newAttestCA(t *testing.T) *attestCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test App Attestation Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &attestCA{key: key, cert: cert}
+}
+
+// verifier creates a verifier for appID trusting the CA
+func (ca *attestCA) verifier(t *testing.T, appID string) *AppAttestVerifier {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "root.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600); err != nil {
+		t.Fatalf("writing root CA: %v", err)
+	}
+	v, err := NewAppAttestVerifier(appID, path, true)
+	if err != nil {
+		t.Fatalf("NewAppAttestVerifier: %v", err)
+	}
+	return v
+}
+
+// attestKey is a device's App Attest key
+type attestKey struct {
+	key *ecdsa.PrivateKey
+	id  []byte
+}
+
+func newAttestKey(t *testing.T) *attestKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating device key: %v", err)
+	}
+	id := sha256.Sum256(elliptic.Marshal(key.Curve, key.X, key.Y))
+	return &attestKey{key: key, id: id[:]}
+}
+
+func (k *attestKey) keyID() string {
+	return base64.StdEncoding.EncodeToString(k.id)
+}
+
+// authData builds authenticator data for appID with counter, and the
+// attested credential data when credentialID is set
+func authData(appID string, counter uint32, credentialID []byte) []byte {
+	appIDHash := sha256.Sum256([]byte(appID))
+	data := append(appIDHash[:], 0x40)
+	data = binary.BigEndian.AppendUint32(data, counter)
+	if credentialID != nil {
+		data = append(data, aaguidDevelopment...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(credentialID)))
+		data = append(data, credentialID...)
+	}
+	return data
+}
+
+// attestation builds a base64 attestation of the key for deviceToken and appID, signed by ca
+func (k *attestKey) attestation(t *testing.T, ca *attestCA, appID, deviceToken string) string {
+	t.Helper()
+
+	data := authData(appID, 0, k.id)
+	clientDataHash := sha256.Sum256([]byte(deviceToken))
+	nonce := sha256.Sum256(append(append([]byte{}, data...), clientDataHash[:]...))
+	octets, _ := asn1.Marshal(nonce[:])
+	extension, _ := asn1.Marshal(struct {
+		Nonce asn1.RawValue
+	}{asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: octets}})
+
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "credential"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: appAttestNonceOID, Value: extension}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &k.key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("creating credential certificate: %v", err)
+	}
+
+	object := map[string]interface{}{
+		"fmt":      "apple-appattest",
+		"attStmt":  map[string]interface{}{"x5c": []interface{}{der}, "receipt": []byte{}},
+		"authData": data,
+	}
+	return base64.StdEncoding.EncodeToString(encodeCBOR(object))
+}
+
+// assertion builds a base64 assertion for deviceToken and appID with counter
+func (k *attestKey) assertion(t *testing.T, appID, deviceToken string, counter uint32) string {
+	t.Helper()
+
+	data := authData(appID, counter, nil)
+	clientDataHash := sha256.Sum256([]byte(deviceToken))
+	nonce := sha256.Sum256(append(append([]byte{}, data...), clientDataHash[:]...))
+	digest := sha256.Sum256(nonce[:])
+	signature, err := ecdsa.SignASN1(rand.Reader, k.key, digest[:])
+	if err != nil {
+		t.Fatalf("signing assertion: %v", err)
+	}
+	object := map[string]interface{}{"signature": signature, "authenticatorData": data}
+	return base64.StdEncoding.EncodeToString(encodeCBOR(object))
+}
+
+const (
+	testDeviceToken  = "0123456789abcdef0123456789abcdef"
+	otherDeviceToken = "fedcba9876543210fedcba9876543210"
+)
+
+func TestAppAttestAttestation(t *testing.T) {
+	ca := newAttestCA(t)
+	key := newAttestKey(t)
+
+	tests := []struct {
+		name    string
+		proof   func() *AppAttestProof
+		wantErr string
+	}{
+		{
+			name: "valid",
+			proof: func() *AppAttestProof {
+				return &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, ca, testAppID, testDeviceToken)}
+			},
+		},
+		{
+			name: "made for another device token",
+			proof: func() *AppAttestProof {
+				return &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, ca, testAppID, otherDeviceToken)}
+			},
+			wantErr: "nonce does not match",
+		},
+		{
+			name: "another app",
+			proof: func() *AppAttestProof {
+				return &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, ca, "TEAMID1234.com.example.other", testDeviceToken)}
+			},
+			wantErr: "different app",
+		},
+		{
+			name: "untrusted root",
+			proof: func() *AppAttestProof {
+				return &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, newAttestCA(t), testAppID, testDeviceToken)}
+			},
+			wantErr: "not trusted",
+		},
+		{
+			name: "key ID of another key",
+			proof: func() *AppAttestProof {
+				return &AppAttestProof{KeyID: newAttestKey(t).keyID(), Attestation: key.attestation(t, ca, testAppID, testDeviceToken)}
+			},
+			wantErr: "does not match the key ID",
+		},
+		{
+			name:    "missing proof",
+			proof:   func() *AppAttestProof { return nil },
+			wantErr: "missing App Attest proof",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ca.verifier(t, testAppID).VerifyRegistration(testDeviceToken, tt.proof())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyRegistration: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyRegistration error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAppAttestKeyIsAttestedOnce(t *testing.T) {
+	ca := newAttestCA(t)
+	key := newAttestKey(t)
+	v := ca.verifier(t, testAppID)
+	proof := &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, ca, testAppID, testDeviceToken)}
+
+	if err := v.VerifyRegistration(testDeviceToken, proof); err != nil {
+		t.Fatalf("first attestation: %v", err)
+	}
+	if err := v.VerifyRegistration(testDeviceToken, proof); err == nil {
+		t.Error("repeated attestation was accepted")
+	}
+}
+
+func TestAppAttestAssertion(t *testing.T) {
+	ca := newAttestCA(t)
+	key := newAttestKey(t)
+
+	tests := []struct {
+		name        string
+		keyID       func() string
+		assertion   func() string
+		deviceToken string
+		wantErr     string
+	}{
+		{
+			name:      "valid",
+			assertion: func() string { return key.assertion(t, testAppID, testDeviceToken, 2) },
+		},
+		{
+			name:      "replayed counter",
+			assertion: func() string { return key.assertion(t, testAppID, testDeviceToken, 1) },
+			wantErr:   "counter did not increase",
+		},
+		{
+			name:      "signed by another key",
+			assertion: func() string { return newAttestKey(t).assertion(t, testAppID, testDeviceToken, 2) },
+			wantErr:   "signature is invalid",
+		},
+		{
+			name:      "another app",
+			assertion: func() string { return key.assertion(t, "TEAMID1234.com.example.other", testDeviceToken, 2) },
+			wantErr:   "different app",
+		},
+		{
+			name:        "another device token",
+			assertion:   func() string { return key.assertion(t, testAppID, otherDeviceToken, 2) },
+			deviceToken: otherDeviceToken,
+			wantErr:     "another device token",
+		},
+		{
+			name:      "unattested key",
+			keyID:     func() string { return newAttestKey(t).keyID() },
+			assertion: func() string { return key.assertion(t, testAppID, testDeviceToken, 2) },
+			wantErr:   "has not been attested",
+		},
+		{
+			name:      "malformed",
+			assertion: func() string { return base64.StdEncoding.EncodeToString([]byte{0xa1}) },
+			wantErr:   "invalid assertion",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := ca.verifier(t, testAppID)
+			if err := v.VerifyRegistration(testDeviceToken, &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, ca, testAppID, testDeviceToken)}); err != nil {
+				t.Fatalf("attestation: %v", err)
+			}
+			if err := v.VerifyRegistration(testDeviceToken, &AppAttestProof{KeyID: key.keyID(), Assertion: key.assertion(t, testAppID, testDeviceToken, 1)}); err != nil {
+				t.Fatalf("first assertion: %v", err)
+			}
+
+			keyID, deviceToken := key.keyID(), testDeviceToken
+			if tt.keyID != nil {
+				keyID = tt.keyID()
+			}
+			if tt.deviceToken != "" {
+				deviceToken = tt.deviceToken
+			}
+			err := v.VerifyRegistration(deviceToken, &AppAttestProof{KeyID: keyID, Assertion: tt.assertion()})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyRegistration: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyRegistration error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAppAttestPersistKeys(t *testing.T) {
+	ca := newAttestCA(t)
+	key := newAttestKey(t)
+	path := filepath.Join(t.TempDir(), "app-attest-keys.json")
+
+	before := ca.verifier(t, testAppID)
+	if err := before.PersistKeys(path); err != nil {
+		t.Fatalf("PersistKeys: %v", err)
+	}
+	if err := before.VerifyRegistration(testDeviceToken, &AppAttestProof{KeyID: key.keyID(), Attestation: key.attestation(t, ca, testAppID, testDeviceToken)}); err != nil {
+		t.Fatalf("attestation: %v", err)
+	}
+	if err := before.VerifyRegistration(testDeviceToken, &AppAttestProof{KeyID: key.keyID(), Assertion: key.assertion(t, testAppID, testDeviceToken, 1)}); err != nil {
+		t.Fatalf("assertion before restart: %v", err)
+	}
+
+	// A restarted server still knows the key, its device token and its counter
+	after := ca.verifier(t, testAppID)
+	if err := after.PersistKeys(path); err != nil {
+		t.Fatalf("PersistKeys after restart: %v", err)
+	}
+	if err := after.VerifyRegistration(testDeviceToken, &AppAttestProof{KeyID: key.keyID(), Assertion: key.assertion(t, testAppID, testDeviceToken, 1)}); err == nil {
+		t.Error("replayed assertion was accepted after restart")
+	}
+	if err := after.VerifyRegistration(otherDeviceToken, &AppAttestProof{KeyID: key.keyID(), Assertion: key.assertion(t, testAppID, otherDeviceToken, 2)}); err == nil {
+		t.Error("assertion for another device token was accepted after restart")
+	}
+	if err := after.VerifyRegistration(testDeviceToken, &AppAttestProof{KeyID: key.keyID(), Assertion: key.assertion(t, testAppID, testDeviceToken, 2)}); err != nil {
+		t.Errorf("assertion after restart: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading keys: %v", err)
+	}
+	if bytes.Contains(data, []byte(testDeviceToken)) {
+		t.Error("saved keys contain the device token")
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"strings"
+
+	"mdtalkman-webhook/models"
+)
+
+// Bot docs modes: what happens to a push made entirely by bots
+const (
+	BotDocsNotify   = "notify"   // notify like any other push
+	BotDocsTag      = "tag"      // notify as an auto-generated docs update
+	BotDocsSuppress = "suppress" // don't notify
+)
+
+// SetBotAuthors configures bot-authored pushes (e.g. a docs generator in CI):
+// authors ending in "[bot]" or listed in botAuthors are bots, and pushes made
+// entirely by bots are handled per mode
+func (g *GitHubService) SetBotAuthors(botAuthors []string, mode string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.botAuthors = botAuthors
+	g.botDocsMode = mode
+}
+
+// SetIgnoredAuthors configures commit authors (usernames or emails, e.g. a
+// release bot or formatter) whose markdown changes never notify on their own.
+// A push still notifies when another author's commit touches markdown.
+func (g *GitHubService) SetIgnoredAuthors(authors []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.ignoredAuthors = authors
+}
+
+// isIgnoredAuthor reports whether a commit author's username or email is in ignoredAuthors
+func isIgnoredAuthor(ignoredAuthors []string, author models.CommitAuthor) bool {
+	return (author.Username != "" && containsFold(ignoredAuthors, author.Username)) ||
+		(author.Email != "" && containsFold(ignoredAuthors, author.Email))
+}
+
+// isBotPush reports whether every author of a push (or its sender, when the
+// commits have no usernames) is a bot
+func (g *GitHubService) isBotPush(event *models.WebhookEvent) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	authors := event.Authors
+	if len(authors) == 0 && event.SenderLogin != "" {
+		authors = []string{event.SenderLogin}
+	}
+	if len(authors) == 0 {
+		return false
+	}
+	for _, author := range authors {
+		if !strings.HasSuffix(author, "[bot]") && !containsFold(g.botAuthors, author) {
+			return false
+		}
+	}
+	return true
+}
+
+// botDocsModeSetting returns how bot-authored pushes are handled
+func (g *GitHubService) botDocsModeSetting() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.botDocsMode
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"mdtalkman-webhook/models"
+)
+
+// DeviceResult is the outcome of a broadcast for one device
+type DeviceResult struct {
+	Token      string `json:"token"`       // masked
+	StatusCode int    `json:"status_code"` // 200 when sent; 0 when the push service never answered
+	Reason     string `json:"reason,omitempty"`
+
+	err error // why the push failed; nil when sent
+}
+
+// newDeviceResult describes the outcome of sending to device
+func newDeviceResult(device models.Device, err error) DeviceResult {
+	result := DeviceResult{Token: MaskToken(device.Token), StatusCode: 200, err: err}
+	var pushErr *PushError
+	switch {
+	case errors.As(err, &pushErr):
+		result.StatusCode, result.Reason = pushErr.StatusCode, pushErr.Reason
+	case err != nil:
+		result.StatusCode, result.Reason = 0, err.Error()
+	}
+	return result
+}
+
+// Retryable reports whether the push failed transiently (see IsTransientPushError)
+func (r DeviceResult) Retryable() bool {
+	return r.err != nil && IsTransientPushError(r.err)
+}
+
+// BroadcastError is returned by SendBroadcast when any device failed. Results
+// holds the outcome of every device attempted; devices after an abort (see
+// Aborted) were not attempted.
+type BroadcastError struct {
+	Results []DeviceResult
+	Aborted error // why the broadcast stopped early, if it did
+}
+
+// Failed returns the results of the devices the broadcast failed for
+func (e *BroadcastError) Failed() []DeviceResult {
+	var failed []DeviceResult
+	for _, result := range e.Results {
+		if result.StatusCode != 200 {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+func (e *BroadcastError) Error() string {
+	failed := e.Failed()
+	details := make([]string, len(failed))
+	for i, result := range failed {
+		details[i] = fmt.Sprintf("device %s: %d %s", result.Token, result.StatusCode, result.Reason)
+	}
+	message := fmt.Sprintf("failed to send to %d devices: [%s]", len(failed), strings.Join(details, "; "))
+	if e.Aborted != nil {
+		message += fmt.Sprintf(" (broadcast aborted: %v)", e.Aborted)
+	}
+	return message
+}
+
+// Unwrap lets errors.Is find the abort reason, e.g. ErrCircuitOpen
+func (e *BroadcastError) Unwrap() error {
+	return e.Aborted
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BusinessHours is a server-wide daily window in which notifications are sent,
+// optionally on some weekdays only. Events outside it wait for the next window.
+type BusinessHours struct {
+	start, end time.Time // clock times; only hour and minute are used
+	location   *time.Location
+	weekdays   [7]bool // indexed by time.Weekday
+}
+
+// weekdayNames maps the abbreviations accepted in business hours to weekdays
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseBusinessHours parses "[Mon-Fri] HH:MM-HH:MM [timezone]", e.g.
+// "Mon-Fri 09:00-17:30 Europe/Berlin". Without weekdays every day is a business
+// day; without a timezone the window is in UTC. An empty text returns nil.
+func ParseBusinessHours(text string) (*BusinessHours, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	hours := &BusinessHours{location: time.UTC}
+	if _, isDay := weekdayNames[strings.ToLower(strings.SplitN(fields[0], "-", 2)[0])]; isDay {
+		if err := hours.parseWeekdays(fields[0]); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	} else {
+		for day := range hours.weekdays {
+			hours.weekdays[day] = true
+		}
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid business hours %q, expected e.g. \"Mon-Fri 09:00-17:00 Europe/Berlin\"", text)
+	}
+
+	start, end, found := strings.Cut(fields[0], "-")
+	var errStart, errEnd error
+	hours.start, errStart = time.Parse(quietHoursLayout, start)
+	hours.end, errEnd = time.Parse(quietHoursLayout, end)
+	if !found || errStart != nil || errEnd != nil {
+		return nil, fmt.Errorf("invalid business hours window %q, expected HH:MM-HH:MM", fields[0])
+	}
+	if !hours.start.Before(hours.end) {
+		return nil, fmt.Errorf("business hours window %q must end after it starts on the same day", fields[0])
+	}
+
+	if len(fields) == 2 {
+		location, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", fields[1])
+		}
+		hours.location = location
+	}
+	return hours, nil
+}
+
+// parseWeekdays enables a single day ("Sat") or a range that may wrap ("Fri-Mon")
+func (b *BusinessHours) parseWeekdays(text string) error {
+	first, last, isRange := strings.Cut(strings.ToLower(text), "-")
+	if !isRange {
+		last = first
+	}
+	from, okFrom := weekdayNames[first]
+	to, okTo := weekdayNames[last]
+	if !okFrom || !okTo {
+		return fmt.Errorf("invalid business days %q, expected e.g. Mon-Fri", text)
+	}
+	for day := from; ; day = (day + 1) % 7 {
+		b.weekdays[day] = true
+		if day == to {
+			return nil
+		}
+	}
+}
+
+// NextOpen reports whether now falls outside business hours and, if so, when
+// they next begin
+func (b *BusinessHours) NextOpen(now time.Time) (time.Time, bool) {
+	local := now.In(b.location)
+	at := func(clock time.Time, dayOffset int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+dayOffset, clock.Hour(), clock.Minute(), 0, 0, b.location)
+	}
+
+	if b.weekdays[local.Weekday()] && !local.Before(at(b.start, 0)) && local.Before(at(b.end, 0)) {
+		return time.Time{}, false
+	}
+	for offset := 0; offset <= 7; offset++ {
+		open := at(b.start, offset)
+		if open.After(local) && b.weekdays[open.Weekday()] {
+			return open, true
+		}
+	}
+	return time.Time{}, false
+}
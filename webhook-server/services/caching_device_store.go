@@ -0,0 +1,79 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// CachingDeviceStore wraps a DeviceStore and remembers the last device list read
+// from it. When a read fails, the cached list is served instead (degraded mode)
+// as long as it is younger than maxAge, so a briefly unavailable store doesn't
+// silently drop notifications.
+type CachingDeviceStore struct {
+	DeviceStore
+	maxAge time.Duration
+	now    func() time.Time // the clock; replaced in tests
+
+	mu       sync.Mutex
+	devices  []models.Device
+	cachedAt time.Time
+	degraded bool
+}
+
+// NewCachingDeviceStore wraps store with a last-known device list fallback
+func NewCachingDeviceStore(store DeviceStore, maxAge time.Duration) *CachingDeviceStore {
+	return &CachingDeviceStore{
+		DeviceStore: store,
+		maxAge:      maxAge,
+		now:         time.Now,
+	}
+}
+
+// List returns the store's devices, or the cached list if the store fails
+func (s *CachingDeviceStore) List() ([]models.Device, error) {
+	devices, err := s.DeviceStore.List()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		if s.degraded {
+			log.Printf("✅ Device store recovered, leaving degraded mode")
+			s.degraded = false
+		}
+		s.devices = append([]models.Device(nil), devices...)
+		s.cachedAt = s.now()
+		return devices, nil
+	}
+
+	age := s.now().Sub(s.cachedAt)
+	if s.cachedAt.IsZero() || age > s.maxAge {
+		return nil, err
+	}
+	if !s.degraded {
+		log.Printf("⚠️  Device store unavailable (%v) - degraded mode, using %d cached devices from %s ago",
+			err, len(s.devices), age.Round(time.Second))
+		s.degraded = true
+	}
+	return append([]models.Device(nil), s.devices...), nil
+}
+
+// Count returns the number of devices, falling back to the cached list if the store fails
+func (s *CachingDeviceStore) Count() (int, error) {
+	if count, err := s.DeviceStore.Count(); err == nil {
+		return count, nil
+	}
+	devices, err := s.List()
+	return len(devices), err
+}
+
+// Degraded reports whether the last read was served from the cache
+func (s *CachingDeviceStore) Degraded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.degraded
+}
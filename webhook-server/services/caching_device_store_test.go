@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// failingStore is an in-memory device store whose reads fail while down is set
+type failingStore struct {
+	*MemoryDeviceStore
+	down bool
+}
+
+var errStoreDown = errors.New("device store unavailable")
+
+func (s *failingStore) List() ([]models.Device, error) {
+	if s.down {
+		return nil, errStoreDown
+	}
+	return s.MemoryDeviceStore.List()
+}
+
+func (s *failingStore) Count() (int, error) {
+	if s.down {
+		return 0, errStoreDown
+	}
+	return s.MemoryDeviceStore.Count()
+}
+
+// newTestCachingStore returns a caching store with a 5m max age over a store
+// holding one device, driven by the returned clock
+func newTestCachingStore(t *testing.T) (*CachingDeviceStore, *failingStore, *time.Time) {
+	t.Helper()
+
+	backing := &failingStore{MemoryDeviceStore: NewMemoryDeviceStore()}
+	if _, err := backing.Upsert(models.Device{Token: "0123456789abcdef0123456789abcdef"}); err != nil {
+		t.Fatalf("registering device: %v", err)
+	}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := NewCachingDeviceStore(backing, 5*time.Minute)
+	s.now = func() time.Time { return now }
+	return s, backing, &now
+}
+
+func TestCachingDeviceStoreFallsBackToCache(t *testing.T) {
+	s, backing, now := newTestCachingStore(t)
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	backing.down = true
+	*now = now.Add(4 * time.Minute)
+	devices, err := s.List()
+	if err != nil {
+		t.Fatalf("List with the store down = %v, want the cached devices", err)
+	}
+	if len(devices) != 1 || devices[0].Token != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("cached devices = %+v, want the registered one", devices)
+	}
+	if count, err := s.Count(); err != nil || count != 1 {
+		t.Errorf("Count with the store down = %d, %v, want 1 from the cache", count, err)
+	}
+	if !s.Degraded() {
+		t.Error("store serving the cache isn't degraded")
+	}
+
+	backing.down = false
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List after recovery: %v", err)
+	}
+	if s.Degraded() {
+		t.Error("store is still degraded after recovering")
+	}
+}
+
+func TestCachingDeviceStoreCacheExpires(t *testing.T) {
+	s, backing, now := newTestCachingStore(t)
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	backing.down = true
+	*now = now.Add(6 * time.Minute)
+	if devices, err := s.List(); !errors.Is(err, errStoreDown) {
+		t.Errorf("List with a cache older than the max age = %+v, %v, want %v", devices, err, errStoreDown)
+	}
+	if _, err := s.Count(); !errors.Is(err, errStoreDown) {
+		t.Errorf("Count with a cache older than the max age = %v, want %v", err, errStoreDown)
+	}
+}
+
+func TestCachingDeviceStoreWithoutCache(t *testing.T) {
+	s, backing, _ := newTestCachingStore(t)
+
+	backing.down = true
+	if _, err := s.List(); !errors.Is(err, errStoreDown) {
+		t.Errorf("List before any successful read = %v, want %v", err, errStoreDown)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errCBORTruncated is returned when CBOR input ends mid-item
+var errCBORTruncated = errors.New("truncated CBOR")
+
+// decodeCBOR decodes the subset of CBOR used by App Attest objects: unsigned
+// and negative integers, byte and text strings, arrays and maps with text keys.
+// Indefinite lengths, tags and floats are rejected.
+func decodeCBOR(data []byte) (interface{}, error) {
+	value, rest, err := decodeCBORItem(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after CBOR item", len(rest))
+	}
+	return value, nil
+}
+
+// decodeCBORItem decodes one item and returns the remaining input
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > 16 {
+		return nil, nil, errors.New("CBOR nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24 && len(data) >= 1:
+		arg, data = uint64(data[0]), data[1:]
+	case info == 25 && len(data) >= 2:
+		arg, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26 && len(data) >= 4:
+		arg, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27 && len(data) >= 8:
+		arg, data = binary.BigEndian.Uint64(data), data[8:]
+	case info > 27:
+		return nil, nil, fmt.Errorf("unsupported CBOR additional info %d", info)
+	default:
+		return nil, nil, errCBORTruncated
+	}
+
+	switch major {
+	case 0:
+		return arg, data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR negative integer out of range")
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if uint64(len(data)) < arg {
+			return nil, nil, errCBORTruncated
+		}
+		if major == 2 {
+			return data[:arg], data[arg:], nil
+		}
+		return string(data[:arg]), data[arg:], nil
+	case 4:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items, data = append(items, item), rest
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		entries := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, nil, errors.New("CBOR map key is not a string")
+			}
+			value, rest, err := decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[name], data = value, rest
+		}
+		return entries, data, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported CBOR major type %d", major)
+}
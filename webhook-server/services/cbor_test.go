@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  interface{}
+	}{
+		{name: "small unsigned", input: []byte{0x17}, want: uint64(23)},
+		{name: "one-byte unsigned", input: []byte{0x18, 0xff}, want: uint64(255)},
+		{name: "eight-byte unsigned", input: []byte{0x1b, 0, 0, 0, 1, 0, 0, 0, 0}, want: uint64(1 << 32)},
+		{name: "negative", input: []byte{0x29}, want: int64(-10)},
+		{name: "byte string", input: []byte{0x43, 1, 2, 3}, want: []byte{1, 2, 3}},
+		{name: "text string", input: []byte{0x63, 'f', 'm', 't'}, want: "fmt"},
+		{name: "array", input: []byte{0x82, 0x01, 0x61, 'a'}, want: []interface{}{uint64(1), "a"}},
+		{name: "map", input: []byte{0xa1, 0x61, 'k', 0x40}, want: map[string]interface{}{"k": []byte{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCBOR(tt.input)
+			if err != nil {
+				t.Fatalf("decodeCBOR: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "empty", input: nil},
+		{name: "truncated argument", input: []byte{0x19, 0x01}},
+		{name: "truncated eight-byte argument", input: []byte{0x1b, 0, 0, 0}},
+		{name: "byte string shorter than its length", input: []byte{0x45, 1, 2}},
+		{name: "huge byte string length", input: []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "huge text string length", input: []byte{0x7a, 0xff, 0xff, 0xff, 0xff, 'a'}},
+		{name: "huge array length", input: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "huge map length", input: []byte{0xba, 0xff, 0xff, 0xff, 0xff}},
+		{name: "array missing items", input: []byte{0x83, 0x01, 0x02}},
+		{name: "map missing its value", input: []byte{0xa1, 0x61, 'k'}},
+		{name: "map with an integer key", input: []byte{0xa1, 0x01, 0x02}},
+		{name: "negative integer out of range", input: []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "indefinite length", input: []byte{0x5f, 0x41, 0x01, 0xff}},
+		{name: "tag", input: []byte{0xc0, 0x01}},
+		{name: "float", input: []byte{0xf9, 0x3c, 0x00}},
+		{name: "trailing bytes", input: []byte{0x01, 0x02}},
+		{name: "nested too deeply", input: append(bytes.Repeat([]byte{0x81}, 32), 0x01)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeCBOR(tt.input); err == nil {
+				t.Errorf("decodeCBOR(%x) = %#v, want an error", tt.input, got)
+			}
+		})
+	}
+}
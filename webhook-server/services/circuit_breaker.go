@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// CircuitState describes whether a circuit breaker lets calls through
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // calls flow normally
+	CircuitOpen     CircuitState = "open"      // calls fail fast until the cooldown ends
+	CircuitHalfOpen CircuitState = "half-open" // a single call is let through to probe recovery
+)
+
+// ErrCircuitOpen is returned for calls rejected while the breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker fast-fails calls after a run of consecutive failures, then
+// lets a single probe call through once the cooldown has passed. Its result
+// decides whether it closes or reopens; other calls keep failing fast meanwhile.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool      // a half-open probe is in flight
+	probeFrom time.Time // when the probe was let through
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold consecutive failures
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     CircuitClosed,
+	}
+}
+
+// Allow reports whether a call may proceed
+func (c *CircuitBreaker) Allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		if time.Since(c.openedAt) < c.cooldown {
+			return false
+		}
+		c.state = CircuitHalfOpen
+		log.Printf("🔌 %s circuit half-open, probing recovery", c.name)
+	case CircuitHalfOpen:
+		// A probe whose result never arrived (e.g. its caller gave up) stops
+		// blocking others after another cooldown
+		if c.probing && time.Since(c.probeFrom) < c.cooldown {
+			return false
+		}
+	default:
+		return true
+	}
+	c.probing = true
+	c.probeFrom = time.Now()
+	return true
+}
+
+// RecordSuccess closes the breaker and resets the failure count
+func (c *CircuitBreaker) RecordSuccess() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != CircuitClosed {
+		log.Printf("🔌 %s circuit closed", c.name)
+	}
+	c.state = CircuitClosed
+	c.failures = 0
+	c.probing = false
+}
+
+// RecordFailure counts a failure, opening the breaker at the threshold or when a half-open probe fails
+func (c *CircuitBreaker) RecordFailure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= c.threshold {
+		if c.state != CircuitOpen {
+			log.Printf("🔌 %s circuit open for %s after %d consecutive failures", c.name, c.cooldown, c.failures)
+		}
+		c.state = CircuitOpen
+		c.openedAt = time.Now()
+		c.probing = false
+	}
+}
+
+// State returns the breaker's current state
+func (c *CircuitBreaker) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= c.cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
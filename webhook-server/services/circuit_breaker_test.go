@@ -0,0 +1,118 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testCooldown = 20 * time.Millisecond
+
+// openBreaker returns a breaker opened by threshold consecutive failures
+func openBreaker(t *testing.T) *CircuitBreaker {
+	t.Helper()
+
+	c := NewCircuitBreaker("test", 2, testCooldown)
+	c.RecordFailure()
+	if got := c.State(); got != CircuitClosed {
+		t.Fatalf("state after one failure = %s, want %s", got, CircuitClosed)
+	}
+	c.RecordFailure()
+	if got := c.State(); got != CircuitOpen {
+		t.Fatalf("state after threshold failures = %s, want %s", got, CircuitOpen)
+	}
+	return c
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	c := openBreaker(t)
+	if c.Allow() {
+		t.Error("open breaker allowed a call before the cooldown")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	c := NewCircuitBreaker("test", 2, testCooldown)
+	c.RecordFailure()
+	c.RecordSuccess()
+	c.RecordFailure()
+	if got := c.State(); got != CircuitClosed {
+		t.Errorf("state = %s, want %s: failures were not consecutive", got, CircuitClosed)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	c := openBreaker(t)
+	time.Sleep(testCooldown)
+
+	if got := c.State(); got != CircuitHalfOpen {
+		t.Fatalf("state after cooldown = %s, want %s", got, CircuitHalfOpen)
+	}
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c.Allow() {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 1 {
+		t.Errorf("half-open breaker allowed %d concurrent calls, want 1 probe", got)
+	}
+}
+
+func TestCircuitBreakerProbeResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    func(c *CircuitBreaker)
+		wantState CircuitState
+		wantAllow bool
+	}{
+		{name: "success closes", record: (*CircuitBreaker).RecordSuccess, wantState: CircuitClosed, wantAllow: true},
+		{name: "failure reopens", record: (*CircuitBreaker).RecordFailure, wantState: CircuitOpen, wantAllow: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := openBreaker(t)
+			time.Sleep(testCooldown)
+			if !c.Allow() {
+				t.Fatal("half-open breaker rejected the probe")
+			}
+
+			tt.record(c)
+			if got := c.State(); got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+			for i := 0; i < 3; i++ {
+				if got := c.Allow(); got != tt.wantAllow {
+					t.Errorf("call %d allowed = %t, want %t", i, got, tt.wantAllow)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerAbandonedProbe(t *testing.T) {
+	c := openBreaker(t)
+	time.Sleep(testCooldown)
+	if !c.Allow() {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+	if c.Allow() {
+		t.Fatal("half-open breaker allowed a second call while probing")
+	}
+
+	// The probe never reports back; another is let through after a cooldown
+	time.Sleep(testCooldown)
+	if !c.Allow() {
+		t.Error("abandoned probe blocked the breaker past the cooldown")
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// DefaultCoalesceKey groups events by type and repository (owner/name)
+const DefaultCoalesceKey = "{{.EventType}}/{{.RepositoryFullName}}"
+
+// ParseCoalesceKey parses a text/template over the WebhookEvent fields that
+// derives the coalescing key, e.g. "{{.RepositoryName}}/{{.Branch}}". Events
+// with the same key within the window are merged.
+func ParseCoalesceKey(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultCoalesceKey
+	}
+	tmpl, err := template.New("coalesce_key").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Catch references to fields that don't exist before the first webhook does
+	if err := tmpl.Execute(io.Discard, &models.WebhookEvent{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Coalescer batches notification events with the same key (by default, the same
+// repository) that arrive within a short window, so a multi-push results in a
+// single notification
+type Coalescer struct {
+	window     time.Duration
+	keyText    string
+	key        *template.Template
+	flush      func(event *models.WebhookEvent, deliveryIDs []string)
+	mu         sync.Mutex
+	pending    map[string]*models.WebhookEvent
+	deliveries map[string][]string // IDs of the deliveries merged into each pending event
+}
+
+// NewCoalescer creates a coalescer that calls flush once per window with the merged
+// event and the IDs of every delivery merged into it. An invalid keyTemplate is
+// logged and the default key used instead.
+func NewCoalescer(window time.Duration, keyTemplate string, flush func(event *models.WebhookEvent, deliveryIDs []string)) *Coalescer {
+	key, err := ParseCoalesceKey(keyTemplate)
+	if err != nil {
+		log.Printf("⚠️  Invalid coalescing key %q (%v), using %s", keyTemplate, err, DefaultCoalesceKey)
+		key, _ = ParseCoalesceKey(DefaultCoalesceKey)
+	}
+
+	return &Coalescer{
+		window:     window,
+		keyText:    keyTemplate,
+		key:        key,
+		flush:      flush,
+		pending:    make(map[string]*models.WebhookEvent),
+		deliveries: make(map[string][]string),
+	}
+}
+
+// Window returns how long notifications are held after the first delivery
+func (c *Coalescer) Window() time.Duration {
+	return c.window
+}
+
+// KeyTemplate returns the template the coalescing key is derived from
+func (c *Coalescer) KeyTemplate() string {
+	return c.keyText
+}
+
+// Key returns the coalescing key for event
+func (c *Coalescer) Key(event *models.WebhookEvent) string {
+	var sb strings.Builder
+	if err := c.key.Execute(&sb, event); err != nil {
+		return event.EventType + "/" + event.RepositoryFullName
+	}
+	return sb.String()
+}
+
+// Add queues an event for notification. It returns true if the event was
+// merged into one already waiting with the same key. An event from another
+// installation or branch than the waiting one (possible with a custom key)
+// isn't merged: the waiting event is flushed right away instead.
+func (c *Coalescer) Add(event *models.WebhookEvent) bool {
+	key := c.Key(event)
+
+	c.mu.Lock()
+	pending, ok := c.pending[key]
+	if ok && mergeable(pending, event) {
+		defer c.mu.Unlock()
+		if event.DeliveryID != "" {
+			c.deliveries[key] = append(c.deliveries[key], event.DeliveryID)
+		}
+		mergeEvents(pending, event)
+		log.Printf("🔗 Coalesced %s event for %s into pending notification", event.EventType, event.RepositoryName)
+		return true
+	}
+
+	deliveryIDs := c.deliveries[key]
+	delete(c.deliveries, key)
+	c.queue(key, event)
+	c.mu.Unlock()
+
+	if ok {
+		c.flush(pending, deliveryIDs)
+	}
+	return false
+}
+
+// queue holds a copy of event under key until the window ends; callers hold mu
+func (c *Coalescer) queue(key string, event *models.WebhookEvent) {
+	// Copy so later merges don't mutate the caller's event
+	queued := *event
+	queued.ChangedFiles = append([]string(nil), event.ChangedFiles...)
+	queued.Authors = append([]string(nil), event.Authors...)
+	queued.RenamedFiles = append([]models.FileRename(nil), event.RenamedFiles...)
+	c.pending[key] = &queued
+	if event.DeliveryID != "" {
+		c.deliveries[key] = []string{event.DeliveryID}
+	}
+
+	time.AfterFunc(c.window, func() { c.fire(key, &queued) })
+}
+
+// fire hands the pending event for key to the flush function, unless it was
+// already flushed early and replaced by another event
+func (c *Coalescer) fire(key string, event *models.WebhookEvent) {
+	c.mu.Lock()
+	if c.pending[key] != event {
+		c.mu.Unlock()
+		return
+	}
+	deliveryIDs := c.deliveries[key]
+	delete(c.pending, key)
+	delete(c.deliveries, key)
+	c.mu.Unlock()
+
+	c.flush(event, deliveryIDs)
+}
+
+// mergeable reports whether next can be folded into pending without the merged
+// notification misattributing next's changes
+func mergeable(pending, next *models.WebhookEvent) bool {
+	return pending.InstallationID == next.InstallationID &&
+		pending.Branch == next.Branch
+}
+
+// mergeEvents folds the changes from next into pending
+func mergeEvents(pending, next *models.WebhookEvent) {
+	pending.Action = next.Action
+	pending.HasMarkdownChanges = pending.HasMarkdownChanges || next.HasMarkdownChanges
+	pending.ChangedFiles = removeDuplicates(append(pending.ChangedFiles, next.ChangedFiles...))
+	pending.Authors = removeDuplicates(append(pending.Authors, next.Authors...))
+	pending.RenamedFiles = append(pending.RenamedFiles, next.RenamedFiles...)
+	if next.CommitMessage != "" {
+		// The latest push's head commit best describes the merged change
+		pending.CommitAuthor = next.CommitAuthor
+		pending.CommitMessage = next.CommitMessage
+	}
+	pending.CompareURL = mergeCompareURLs(pending.CompareURL, next.CompareURL)
+}
+
+// mergeCompareURLs spans two consecutive pushes' compare URLs
+// (".../compare/A...B" and ".../compare/B...C" become ".../compare/A...C");
+// the later URL is kept when they aren't of the same repository
+func mergeCompareURLs(first, next string) string {
+	firstPrefix, firstRange, ok1 := strings.Cut(first, "/compare/")
+	nextPrefix, nextRange, ok2 := strings.Cut(next, "/compare/")
+	if !ok1 || !ok2 || firstPrefix != nextPrefix {
+		if next == "" {
+			return first
+		}
+		return next
+	}
+	base, _, ok1 := strings.Cut(firstRange, "...")
+	_, head, ok2 := strings.Cut(nextRange, "...")
+	if !ok1 || !ok2 {
+		return next
+	}
+	return firstPrefix + "/compare/" + base + "..." + head
+}
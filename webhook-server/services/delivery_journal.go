@@ -0,0 +1,205 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a verified delivery as received from GitHub
+type JournalEntry struct {
+	DeliveryID string          `json:"delivery_id"`
+	EventType  string          `json:"event_type,omitempty"`
+	ReceivedAt time.Time       `json:"received_at,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Notified   bool            `json:"notified,omitempty"`
+}
+
+// DeliveryJournal persists recent deliveries and whether their notifications
+// went out, so deliveries interrupted by a crash or shutdown can be replayed on
+// startup. The file holds one JSON line per delivery received and one per
+// delivery completed; it is compacted to the newest capacity deliveries when
+// opened and whenever it grows past twice that.
+type DeliveryJournal struct {
+	path     string
+	capacity int
+
+	mu      sync.Mutex
+	file    *os.File
+	lines   int
+	entries map[string]*JournalEntry
+	order   []string
+}
+
+// OpenDeliveryJournal opens (creating if needed) the journal at path
+func OpenDeliveryJournal(path string, capacity int) (*DeliveryJournal, error) {
+	j := &DeliveryJournal{
+		path:     path,
+		capacity: capacity,
+		entries:  make(map[string]*JournalEntry),
+	}
+
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open delivery journal: %w", err)
+	}
+	if file != nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 32*1024*1024)
+		for scanner.Scan() {
+			var line JournalEntry
+			// A torn final line from a crash is skipped
+			if json.Unmarshal(scanner.Bytes(), &line) == nil && line.DeliveryID != "" {
+				j.apply(line)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read delivery journal: %w", err)
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Record journals a delivery before it is processed. A redelivery of a
+// journaled delivery keeps its notified state.
+func (j *DeliveryJournal) Record(deliveryID, eventType string, payload []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry, ok := j.entries[deliveryID]; ok && entry.Notified {
+		return nil
+	}
+	return j.append(JournalEntry{
+		DeliveryID: deliveryID,
+		EventType:  eventType,
+		ReceivedAt: time.Now(),
+		Payload:    json.RawMessage(payload),
+	})
+}
+
+// Notified reports whether a journaled delivery's notifications went out
+func (j *DeliveryJournal) Notified(deliveryID string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[deliveryID]
+	return ok && entry.Notified
+}
+
+// MarkNotified records that a delivery needs no further notification work
+func (j *DeliveryJournal) MarkNotified(deliveryID string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[deliveryID]
+	if !ok || entry.Notified {
+		return nil
+	}
+	return j.append(JournalEntry{DeliveryID: deliveryID, Notified: true})
+}
+
+// Pending returns the deliveries received within window that were never
+// marked notified, oldest first
+func (j *DeliveryJournal) Pending(window time.Duration) []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var pending []JournalEntry
+	for _, id := range j.order {
+		entry := j.entries[id]
+		if !entry.Notified && time.Since(entry.ReceivedAt) <= window {
+			pending = append(pending, *entry)
+		}
+	}
+	return pending
+}
+
+// Close closes the journal file
+func (j *DeliveryJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// append writes a line to the journal and applies it; callers hold mu
+func (j *DeliveryJournal) append(line JournalEntry) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write delivery journal: %w", err)
+	}
+	j.lines++
+	j.apply(line)
+
+	if j.lines > 2*j.capacity {
+		return j.compact()
+	}
+	return nil
+}
+
+// apply folds a journal line into the in-memory entries, dropping the oldest past capacity
+func (j *DeliveryJournal) apply(line JournalEntry) {
+	if line.Notified && line.Payload == nil {
+		if entry, ok := j.entries[line.DeliveryID]; ok {
+			entry.Notified = true
+		}
+		return
+	}
+
+	if _, exists := j.entries[line.DeliveryID]; !exists {
+		j.order = append(j.order, line.DeliveryID)
+	}
+	j.entries[line.DeliveryID] = &line
+
+	for len(j.order) > j.capacity {
+		delete(j.entries, j.order[0])
+		j.order = j.order[1:]
+	}
+}
+
+// compact rewrites the journal with one line per retained delivery and reopens
+// it for appending; callers hold mu
+func (j *DeliveryJournal) compact() error {
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compact delivery journal: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, id := range j.order {
+		data, _ := json.Marshal(j.entries[id])
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact delivery journal: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("failed to compact delivery journal: %w", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open delivery journal: %w", err)
+	}
+	j.lines = len(j.order)
+	return nil
+}
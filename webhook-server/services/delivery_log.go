@@ -0,0 +1,105 @@
+package services
+
+import (
+	"sync"
+
+	"mdtalkman-webhook/models"
+)
+
+// MarkdownChanges lists the markdown files a push added, modified, removed and renamed.
+// Renamed files are not also listed as added and removed.
+type MarkdownChanges struct {
+	Added    []string            `json:"added"`
+	Modified []string            `json:"modified"`
+	Removed  []string            `json:"removed"`
+	Renamed  []models.FileRename `json:"renamed"`
+}
+
+// CollectMarkdownChanges gathers the markdown files touched by a push's commits
+func CollectMarkdownChanges(commits []models.Commit) MarkdownChanges {
+	var added, modified, removed []string
+	for _, commit := range commits {
+		added = append(added, filterMarkdown(commit.Added)...)
+		modified = append(modified, filterMarkdown(commit.Modified)...)
+		removed = append(removed, filterMarkdown(commit.Removed)...)
+	}
+
+	renames := DetectRenames(added, removed)
+	targets := make([]string, 0, len(renames))
+	for _, rename := range renames {
+		targets = append(targets, rename.To)
+	}
+
+	return MarkdownChanges{
+		Added:    withoutFiles(removeDuplicates(added), targets),
+		Modified: removeDuplicates(modified),
+		Removed:  withoutRenameSources(removeDuplicates(removed), renames),
+		Renamed:  append([]models.FileRename{}, renames...),
+	}
+}
+
+// withoutFiles returns files minus the given paths
+func withoutFiles(files, drop []string) []string {
+	kept := []string{}
+	for _, file := range files {
+		if !contains(drop, file) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// filterMarkdown returns the markdown files in files
+func filterMarkdown(files []string) []string {
+	var markdown []string
+	for _, file := range files {
+		if isMarkdownFile(file) {
+			markdown = append(markdown, file)
+		}
+	}
+	return markdown
+}
+
+// DeliveryLog remembers the markdown changes of recent deliveries, so the app
+// can fetch exactly the files a notification was about. The oldest entries
+// are dropped once capacity is reached.
+type DeliveryLog struct {
+	capacity int
+
+	mu      sync.RWMutex
+	changes map[string]MarkdownChanges
+	order   []string
+}
+
+// NewDeliveryLog creates a log holding up to capacity deliveries
+func NewDeliveryLog(capacity int) *DeliveryLog {
+	return &DeliveryLog{
+		capacity: capacity,
+		changes:  make(map[string]MarkdownChanges),
+	}
+}
+
+// Record stores the markdown changes for a delivery
+func (l *DeliveryLog) Record(deliveryID string, changes MarkdownChanges) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, exists := l.changes[deliveryID]; !exists {
+		l.order = append(l.order, deliveryID)
+	}
+	l.changes[deliveryID] = changes
+
+	for len(l.order) > l.capacity {
+		delete(l.changes, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+// Changes returns the markdown changes recorded for a delivery
+func (l *DeliveryLog) Changes(deliveryID string) (MarkdownChanges, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	changes, ok := l.changes[deliveryID]
+	return changes, ok
+}
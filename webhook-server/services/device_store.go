@@ -0,0 +1,158 @@
+package services
+
+import (
+	"sync"
+
+	"mdtalkman-webhook/models"
+)
+
+// DeviceStore persists the devices registered for push notifications
+type DeviceStore interface {
+	// Upsert adds or replaces a device by token, reporting whether it was newly created
+	Upsert(device models.Device) (bool, error)
+	// Remove deletes a device by token, reporting whether it existed
+	Remove(token string) (bool, error)
+	// List returns all registered devices in registration order
+	List() ([]models.Device, error)
+	// ListPage returns up to limit devices starting at offset, in registration order, and the total count
+	ListPage(offset, limit int) ([]models.Device, int, error)
+	// Count returns the number of registered devices
+	Count() (int, error)
+	// IncrementBadge adds one to a device's unread count and returns the new count
+	IncrementBadge(token string) (int, error)
+	// ClearBadge resets a device's unread count, reporting whether the device exists
+	ClearBadge(token string) (bool, error)
+	// Update changes the device with token atomically, reporting whether it exists.
+	// update gets the current device to modify and returns true to remove it instead;
+	// it runs under the store's lock and must not call the store.
+	Update(token string, update func(device *models.Device) (remove bool)) (bool, error)
+}
+
+// MemoryDeviceStore keeps devices in process memory; they are lost on restart
+type MemoryDeviceStore struct {
+	mu      sync.RWMutex
+	devices []models.Device
+}
+
+// NewMemoryDeviceStore creates an empty in-memory device store
+func NewMemoryDeviceStore() *MemoryDeviceStore {
+	return &MemoryDeviceStore{
+		devices: make([]models.Device, 0),
+	}
+}
+
+// Upsert adds or replaces a device, keeping its unread count. The existence check
+// and insert happen under one lock, so concurrent registrations of the same token
+// yield a single record.
+func (s *MemoryDeviceStore) Upsert(device models.Device) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.devices {
+		if existing.Token == device.Token {
+			device.Badge = existing.Badge
+			s.devices[i] = device
+			return false, nil
+		}
+	}
+
+	s.devices = append(s.devices, device)
+	return true, nil
+}
+
+// Remove deletes a device by token
+func (s *MemoryDeviceStore) Remove(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.devices {
+		if existing.Token == token {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List returns a copy of all registered devices
+func (s *MemoryDeviceStore) List() ([]models.Device, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.Device(nil), s.devices...), nil
+}
+
+// ListPage returns a copy of up to limit devices starting at offset
+func (s *MemoryDeviceStore) ListPage(offset, limit int) ([]models.Device, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return pageOf(s.devices, offset, limit), len(s.devices), nil
+}
+
+// pageOf returns a copy of devices[offset:offset+limit], clamped to the slice
+func pageOf(devices []models.Device, offset, limit int) []models.Device {
+	if offset >= len(devices) {
+		return []models.Device{}
+	}
+	end := offset + limit
+	if end > len(devices) {
+		end = len(devices)
+	}
+	return append([]models.Device(nil), devices[offset:end]...)
+}
+
+// Count returns the number of registered devices
+func (s *MemoryDeviceStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.devices), nil
+}
+
+// IncrementBadge adds one to a device's unread count; unknown devices get a badge of 1
+func (s *MemoryDeviceStore) IncrementBadge(token string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.devices {
+		if s.devices[i].Token == token {
+			s.devices[i].Badge++
+			return s.devices[i].Badge, nil
+		}
+	}
+	return 1, nil
+}
+
+// ClearBadge resets a device's unread count
+func (s *MemoryDeviceStore) ClearBadge(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.devices {
+		if s.devices[i].Token == token {
+			s.devices[i].Badge = 0
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Update applies update to the device with token under the store's lock
+func (s *MemoryDeviceStore) Update(token string, update func(device *models.Device) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.devices {
+		if s.devices[i].Token == token {
+			device := s.devices[i]
+			if update(&device) {
+				s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			} else {
+				s.devices[i] = device
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// SummaryEventType is the event type of notifications that summarize several deferred events
+const SummaryEventType = "summary"
+
+// DeviceThrottle enforces a minimum interval between pushes to the same device.
+// Events arriving too soon are held and delivered as one summary push once the
+// interval has elapsed.
+type DeviceThrottle struct {
+	interval time.Duration
+	send     func(models.Device, *models.WebhookEvent)
+	now      func() time.Time // the clock; replaced in tests
+	mu       sync.Mutex
+	lastPush map[string]time.Time
+	pending  map[string]*pendingSummary
+}
+
+// pendingSummary collects the events held back for one device
+type pendingSummary struct {
+	device models.Device
+	events []*models.WebhookEvent
+}
+
+// NewDeviceThrottle creates a throttle that calls send with each device's summary event
+func NewDeviceThrottle(interval time.Duration, send func(models.Device, *models.WebhookEvent)) *DeviceThrottle {
+	return &DeviceThrottle{
+		interval: interval,
+		send:     send,
+		now:      time.Now,
+		lastPush: make(map[string]time.Time),
+		pending:  make(map[string]*pendingSummary),
+	}
+}
+
+// Interval returns the minimum time between pushes to one device
+func (t *DeviceThrottle) Interval() time.Duration {
+	return t.interval
+}
+
+// Allow reports whether the device may be pushed immediately. If not, the event
+// is held for the device's next summary push.
+func (t *DeviceThrottle) Allow(device models.Device, event *models.WebhookEvent) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if summary, ok := t.pending[device.Token]; ok {
+		summary.events = append(summary.events, event)
+		return false
+	}
+
+	last, seen := t.lastPush[device.Token]
+	if !seen || now.Sub(last) >= t.interval {
+		t.lastPush[device.Token] = now
+		return true
+	}
+
+	due := last.Add(t.interval)
+	t.pending[device.Token] = &pendingSummary{device: device, events: []*models.WebhookEvent{event}}
+	time.AfterFunc(due.Sub(now), func() { t.flush(device.Token, due) })
+	log.Printf("⏳ Deferring push to device %s until %s", MaskToken(device.Token), due.Format(time.RFC3339))
+	return false
+}
+
+// flush sends the summary held for a device, due at the given time. The summary
+// counts as pushed when due, not when the timer got round to it, so a late
+// timer doesn't delay the device's next push.
+func (t *DeviceThrottle) flush(token string, due time.Time) {
+	t.mu.Lock()
+	summary := t.pending[token]
+	delete(t.pending, token)
+	if summary != nil {
+		t.lastPush[token] = due
+	}
+	t.mu.Unlock()
+
+	if summary != nil {
+		t.send(summary.device, summarizeEvents(summary.events))
+	}
+}
+
+// summarizeEvents merges deferred events into a single notification event
+func summarizeEvents(events []*models.WebhookEvent) *models.WebhookEvent {
+	if len(events) == 1 {
+		return events[0]
+	}
+
+	repositories := make(map[string]bool)
+	summary := &models.WebhookEvent{
+		EventType:    SummaryEventType,
+		SummaryCount: len(events),
+	}
+	for _, event := range events {
+		repositories[event.RepositoryName] = true
+		summary.HasMarkdownChanges = summary.HasMarkdownChanges || event.HasMarkdownChanges
+		summary.ChangedFiles = append(summary.ChangedFiles, event.ChangedFiles...)
+	}
+	summary.ChangedFiles = removeDuplicates(summary.ChangedFiles)
+
+	names := make([]string, 0, len(repositories))
+	for name := range repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summary.RepositoryName = strings.Join(names, ", ")
+
+	return summary
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+func TestDeviceThrottleDefersIntoOneSummary(t *testing.T) {
+	sent := make(chan *models.WebhookEvent, 2)
+	throttle := NewDeviceThrottle(30*time.Millisecond, func(device models.Device, event *models.WebhookEvent) {
+		sent <- event
+	})
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+
+	if !throttle.Allow(device, &models.WebhookEvent{RepositoryName: "docs"}) {
+		t.Fatal("first event was not allowed")
+	}
+	for _, repository := range []string{"docs", "blog"} {
+		if throttle.Allow(device, &models.WebhookEvent{RepositoryName: repository, HasMarkdownChanges: true}) {
+			t.Fatalf("event for %s within the interval was allowed", repository)
+		}
+	}
+
+	select {
+	case summary := <-sent:
+		if summary.EventType != SummaryEventType || summary.SummaryCount != 2 {
+			t.Errorf("summary = %s of %d events, want %s of 2", summary.EventType, summary.SummaryCount, SummaryEventType)
+		}
+		if summary.RepositoryName != "blog, docs" || !summary.HasMarkdownChanges {
+			t.Errorf("summary = %+v, want both repositories with markdown changes", summary)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deferred events were never sent")
+	}
+	select {
+	case extra := <-sent:
+		t.Errorf("deferred events were sent more than once: %+v", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeviceThrottleNextPushAfterSummary(t *testing.T) {
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	throttle := NewDeviceThrottle(time.Hour, func(models.Device, *models.WebhookEvent) {})
+	throttle.now = func() time.Time { return now }
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+
+	throttle.Allow(device, &models.WebhookEvent{})
+	now = start.Add(10 * time.Minute)
+	if throttle.Allow(device, &models.WebhookEvent{}) {
+		t.Fatal("event within the interval was allowed")
+	}
+
+	// The summary's timer fires five minutes after it was due
+	due := start.Add(time.Hour)
+	now = due.Add(5 * time.Minute)
+	throttle.flush(device.Token, due)
+
+	now = due.Add(time.Hour)
+	if !throttle.Allow(device, &models.WebhookEvent{}) {
+		t.Error("push an interval after the summary was due was deferred by the late timer")
+	}
+}
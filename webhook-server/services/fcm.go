@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// Device platforms
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+// fcmScope is the OAuth2 scope for sending FCM messages
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCMService sends notifications to Android devices through the Firebase Cloud
+// Messaging HTTP v1 API, authenticating with a service account key
+type FCMService struct {
+	projectID   string
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURI    string
+	httpClient  *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMService creates an FCM service from a Firebase service account JSON key file
+func NewFCMService(credentialsPath string) (*FCMService, error) {
+	data, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+	}
+
+	var credentials struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("invalid FCM credentials: %w", err)
+	}
+	if credentials.ProjectID == "" || credentials.ClientEmail == "" {
+		return nil, fmt.Errorf("invalid FCM credentials: project_id and client_email are required")
+	}
+
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid FCM credentials: private_key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM private key: %w", err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid FCM private key: expected an RSA key")
+	}
+
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	log.Printf("🤖 FCM service created for project %s", credentials.ProjectID)
+	return &FCMService{
+		projectID:   credentials.ProjectID,
+		clientEmail: credentials.ClientEmail,
+		privateKey:  privateKey,
+		tokenURI:    credentials.TokenURI,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// SendNotification sends a notification to one Android device. Failures are a
+// *TransportError when FCM (or its OAuth token endpoint) couldn't be reached and
+// a *PushError when it refused the push.
+func (f *FCMService) SendNotification(ctx context.Context, device models.Device, event *models.WebhookEvent) error {
+	err := f.send(ctx, device, event)
+	countPush(err)
+	return err
+}
+
+// send makes one FCM request for SendNotification
+func (f *FCMService) send(ctx context.Context, device models.Device, event *models.WebhookEvent) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"message": fcmMessage(device, event)})
+	if err != nil {
+		return fmt.Errorf("failed to encode FCM message: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("https://fcm.googleapis.com/v1/projects/%s/messages:send", f.projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create FCM request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	log.Printf("🤖 Sending FCM notification to device %s", MaskToken(device.Token))
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return &TransportError{Service: "FCM", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &PushError{Service: "FCM", StatusCode: resp.StatusCode, Reason: strings.TrimSpace(string(detail))}
+	}
+
+	log.Printf("✅ FCM notification sent successfully")
+	return nil
+}
+
+// SendBroadcast sends a notification to multiple Android devices. When any
+// device fails, the error is a *BroadcastError with every device's outcome.
+func (f *FCMService) SendBroadcast(ctx context.Context, devices []models.Device, event *models.WebhookEvent) error {
+	if len(devices) == 0 {
+		return fmt.Errorf("no device tokens provided")
+	}
+
+	broadcastErr := &BroadcastError{}
+	successCount := 0
+	for _, device := range devices {
+		if ctx.Err() != nil {
+			broadcastErr.Aborted = ctx.Err()
+			break
+		}
+
+		err := f.SendNotification(ctx, device, event)
+		if err != nil {
+			log.Printf("❌ Failed to send to device %s: %v", MaskToken(device.Token), err)
+		} else {
+			successCount++
+		}
+		broadcastErr.Results = append(broadcastErr.Results, newDeviceResult(device, err))
+	}
+
+	log.Printf("🤖 FCM broadcast complete: %d/%d devices successful", successCount, len(devices))
+
+	if successCount < len(devices) {
+		return broadcastErr
+	}
+	return nil
+}
+
+// fcmMessage builds an FCM v1 message carrying the same text and custom keys as the APNs payload.
+// Silent pushes become data-only messages.
+func fcmMessage(device models.Device, event *models.WebhookEvent) map[string]interface{} {
+	data := map[string]string{
+		"repository":   event.RepositoryName,
+		"event_type":   event.EventType,
+		"has_markdown": strconv.FormatBool(event.HasMarkdownChanges),
+	}
+	if event.DeliveryID != "" && event.HasMarkdownChanges {
+		data["delivery_id"] = event.DeliveryID
+	}
+	if event.CompareURL != "" {
+		data["compare_url"] = event.CompareURL
+	}
+	if device.Canary {
+		data["canary"] = "true"
+	}
+	if device.Badge > 0 {
+		data["badge"] = strconv.Itoa(device.Badge)
+	}
+
+	message := map[string]interface{}{
+		"token": device.Token,
+		"data":  data,
+	}
+	if !device.Silent {
+		title, body := notificationText(event)
+		message["notification"] = map[string]string{"title": title, "body": body}
+	}
+	return message
+}
+
+// token returns a cached OAuth2 access token, exchanging a signed JWT for a new one when it expires
+func (f *FCMService) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.accessToken != "" && time.Until(f.expiresAt) > time.Minute {
+		return f.accessToken, nil
+	}
+
+	assertion, err := f.signedAssertion()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create FCM token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return "", &TransportError{Service: "FCM", Err: fmt.Errorf("failed to fetch access token: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if resp.StatusCode >= 500 {
+		// The token endpoint is down, not refusing our credentials
+		return "", &TransportError{Service: "FCM", Err: fmt.Errorf("token endpoint returned status %d", resp.StatusCode)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("FCM token endpoint returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.AccessToken == "" {
+		return "", fmt.Errorf("invalid FCM token response")
+	}
+
+	f.accessToken = result.AccessToken
+	f.expiresAt = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+// signedAssertion creates the RS256-signed JWT used to request an access token
+func (f *FCMService) signedAssertion() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   f.clientEmail,
+		"scope": fcmScope,
+		"aud":   f.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token request: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/metrics"
+	"mdtalkman-webhook/models"
+)
+
+// newTestFCMService creates an FCM service fetching access tokens from tokenURI
+func newTestFCMService(t *testing.T, tokenURI string) *FCMService {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	return &FCMService{
+		projectID:   "mdtalkman-test",
+		clientEmail: "push@mdtalkman-test.iam.gserviceaccount.com",
+		privateKey:  privateKey,
+		tokenURI:    tokenURI,
+		httpClient:  &http.Client{Timeout: time.Second},
+	}
+}
+
+func TestFCMTokenFailureIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokenURI func(t *testing.T) string
+	}{
+		{
+			name: "unreachable",
+			tokenURI: func(t *testing.T) string {
+				server := httptest.NewServer(http.NotFoundHandler())
+				server.Close()
+				return server.URL
+			},
+		},
+		{
+			name: "server error",
+			tokenURI: func(t *testing.T) string {
+				server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+				}))
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFCMService(t, tt.tokenURI(t))
+			failed := metrics.PushesFailed.Value()
+
+			err := f.SendNotification(context.Background(), models.Device{Token: "android-device-token-0001"}, &models.WebhookEvent{EventType: "push"})
+			var transportErr *TransportError
+			if !errors.As(err, &transportErr) {
+				t.Fatalf("SendNotification error = %v, want a *TransportError", err)
+			}
+			if !IsTransientPushError(err) {
+				t.Error("token failure is not transient")
+			}
+			if got := metrics.PushesFailed.Value() - failed; got != 1 {
+				t.Errorf("failed pushes counted = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mdtalkman-webhook/models"
+)
+
+// DeviceAcceptsEvent reports whether a device's registered filters allow it to
+// be notified about the event
+func DeviceAcceptsEvent(device models.Device, event *models.WebhookEvent) bool {
+	return matchesSubscriptions(device, event) && matchesAuthorFilters(device, event.Authors) &&
+		matchesPathPatterns(device.Paths, event.ChangedFiles)
+}
+
+// matchesPathPatterns reports whether any changed markdown file matches one of
+// a device's path globs. Devices without patterns, and events without changed
+// markdown files (e.g. installation events), always match.
+func matchesPathPatterns(patterns, changedFiles []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	markdown := filterMarkdown(changedFiles)
+	if len(markdown) == 0 {
+		return true
+	}
+	for _, file := range markdown {
+		if matchesAnyPattern(patterns, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyPattern reports whether path matches one of the path globs
+func matchesAnyPattern(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if re, err := compilePathPattern(pattern); err == nil && re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePathPatterns checks a device's path globs: "*" and "?" match within a
+// path segment and "**" across segments, e.g. "docs/*.md" or "api/**.md"
+func ValidatePathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := compilePathPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compilePathPattern translates a path glob into an anchored regular expression
+func compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, fmt.Errorf("empty path pattern")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// matchesSubscriptions applies a device's repository and organization
+// subscriptions: a device subscribed to an organization gets all of its
+// repositories. Devices without subscriptions, and events without a
+// repository, always match.
+func matchesSubscriptions(device models.Device, event *models.WebhookEvent) bool {
+	if len(device.Repositories) == 0 && len(device.Organizations) == 0 || event.RepositoryName == "" {
+		return true
+	}
+	return subscribedToRepository(device.Repositories, event) ||
+		event.Organization != "" && containsFold(device.Organizations, event.Organization)
+}
+
+// subscribedToRepository reports whether a subscription names the event's
+// repository. "owner/name" subscriptions match only that owner's repository;
+// bare names match a repository of that name under any owner.
+func subscribedToRepository(subscriptions []string, event *models.WebhookEvent) bool {
+	for _, subscription := range subscriptions {
+		name := event.RepositoryName
+		if strings.Contains(subscription, "/") {
+			name = event.RepositoryFullName
+		}
+		if strings.EqualFold(subscription, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsubscribe returns the device's repository subscriptions without repository,
+// and whether it was subscribed to it
+func Unsubscribe(device models.Device, repository string) ([]string, bool) {
+	var remaining []string
+	for _, subscribed := range device.Repositories {
+		if !strings.EqualFold(subscribed, repository) {
+			remaining = append(remaining, subscribed)
+		}
+	}
+	return remaining, len(remaining) < len(device.Repositories)
+}
+
+// FilterDevices returns the devices whose filters accept the event
+func FilterDevices(devices []models.Device, event *models.WebhookEvent) []models.Device {
+	var accepted []models.Device
+	for _, device := range devices {
+		if DeviceAcceptsEvent(device, event) {
+			accepted = append(accepted, device)
+		}
+	}
+	return accepted
+}
+
+// matchesAuthorFilters applies a device's include/exclude author lists.
+// Events without commit authors (e.g. installation events) always match.
+func matchesAuthorFilters(device models.Device, authors []string) bool {
+	if len(authors) == 0 {
+		return true
+	}
+
+	if len(device.IncludeAuthors) > 0 {
+		for _, author := range authors {
+			if containsFold(device.IncludeAuthors, author) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Excluded authors only suppress the push when nobody else contributed
+	for _, author := range authors {
+		if !containsFold(device.ExcludeAuthors, author) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list contains value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
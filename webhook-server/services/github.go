@@ -1,81 +1,577 @@
 package services
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"mdtalkman-webhook/models"
 )
 
+// defaultDeploymentEnvironment is the environment GitHub Pages deployments report
+const defaultDeploymentEnvironment = "github-pages"
+
 // GitHubService handles GitHub-specific operations
 type GitHubService struct {
 	webhookSecret string
+
+	// Reloadable settings, guarded by mu
+	mu                    sync.RWMutex
+	deploymentEnvironment string
+	senderAllowlist       []string
+	senderBlocklist       []string
+	webhookSecrets        map[string]string // installation ID or repo full name -> secret
+	directorySecrets      map[string]string // same, loaded from a secrets directory; these take precedence
+	packageEvents         bool              // notify for registry_package events
+	secretAlerts          bool              // notify for secret_scanning_alert events
+	requiredTopics        []string          // repositories must carry one of these topics to notify
+	topicCache            map[string]cachedTopics
+	apiClient             *GitHubAPIClient // looks up topics missing from payloads; nil when unset
+	topicCacheTTL         time.Duration
+	maxScanCommits        int // commits of a push scanned for markdown; 0 scans all
+	maxScanFiles          int // changed files collected per push; 0 collects all
+	botAuthors            []string
+	botDocsMode           string   // BotDocsNotify, BotDocsTag or BotDocsSuppress
+	ignoredAuthors        []string // usernames or emails whose markdown commits never notify
+	submodulePaths        []string // globs of submodule paths, never counted as markdown
+	draftPaths            []string // globs of work-in-progress docs, never counted as markdown
 }
 
 // NewGitHubService creates a new GitHub service instance
 func NewGitHubService(webhookSecret string) *GitHubService {
 	return &GitHubService{
-		webhookSecret: webhookSecret,
+		webhookSecret:         webhookSecret,
+		deploymentEnvironment: defaultDeploymentEnvironment,
+		topicCache:            make(map[string]cachedTopics),
+	}
+}
+
+// SetDeploymentEnvironment sets which deployment environment's status changes notify the app
+func (g *GitHubService) SetDeploymentEnvironment(environment string) {
+	if environment == "" {
+		environment = defaultDeploymentEnvironment
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.deploymentEnvironment = environment
+}
+
+// SetSenderFilters restricts notifications to events sent by allowlisted accounts
+// (any account when the allowlist is empty) and never for blocklisted accounts
+func (g *GitHubService) SetSenderFilters(allowlist, blocklist []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.senderAllowlist = allowlist
+	g.senderBlocklist = blocklist
+}
+
+// isSenderAllowed applies the sender filters; the blocklist takes precedence
+func (g *GitHubService) isSenderAllowed(login string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if containsFold(g.senderBlocklist, login) {
+		return false
 	}
+	return len(g.senderAllowlist) == 0 || containsFold(g.senderAllowlist, login)
+}
+
+// SetPackageEvents enables notifications for packages published to GitHub
+// Packages (registry_package events), for teams publishing docs as a package
+func (g *GitHubService) SetPackageEvents(enabled bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.packageEvents = enabled
+}
+
+// SetSecretScanningAlerts enables security notifications when GitHub secret
+// scanning finds a committed secret (e.g. in a markdown file) or an alert is resolved
+func (g *GitHubService) SetSecretScanningAlerts(enabled bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.secretAlerts = enabled
+}
+
+// SetScanLimits bounds the work done for huge pushes: at most maxCommits commits
+// are scanned, and once maxFiles changed files are collected the scan stops as
+// soon as markdown has been found. Zero means no limit.
+func (g *GitHubService) SetScanLimits(maxCommits, maxFiles int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.maxScanCommits = maxCommits
+	g.maxScanFiles = maxFiles
+}
+
+// SetSubmodulePaths lists globs (see ValidatePathPatterns) matching submodule
+// paths, e.g. "themes/*". Push payloads don't mark gitlink entries, so a
+// submodule whose path ends in .md would otherwise look like a markdown change
+// whenever its pointer moves.
+func (g *GitHubService) SetSubmodulePaths(patterns []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.submodulePaths = patterns
+}
+
+// SetDraftPaths lists globs (see ValidatePathPatterns) of work-in-progress docs,
+// e.g. "draft/" or "**/_drafts/**". A trailing slash covers everything under a
+// folder. Markdown changes there never count as markdown changes and are left
+// out of the event's changed files, so they can't match a device's paths either.
+func (g *GitHubService) SetDraftPaths(patterns []string) {
+	expanded := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		expanded[i] = pattern
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.draftPaths = expanded
+}
+
+// SetRequiredTopics restricts notifications to repositories tagged with at least
+// one of topics (any repository when empty)
+func (g *GitHubService) SetRequiredTopics(topics []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.requiredTopics = topics
+}
+
+// topicCacheCapacity is how many repositories' topics are cached; the least
+// recently used repository is dropped beyond it
+const topicCacheCapacity = 1000
+
+// cachedTopics are a repository's topics as of fetchedAt
+type cachedTopics struct {
+	topics    []string
+	fetchedAt time.Time
+	usedAt    time.Time
 }
 
+// UseAPIClient looks up repository topics that a webhook payload doesn't carry
+// through client, caching them per repository for cacheTTL
+func (g *GitHubService) UseAPIClient(client *GitHubAPIClient, cacheTTL time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.apiClient = client
+	g.topicCacheTTL = cacheTTL
+}
+
+// repositoryTopics returns a repository's topics. Topics in the webhook's
+// repository object are used as they are; otherwise, while REQUIRE_TOPIC needs
+// them, they come from the per-repository cache or are fetched from the API as
+// installationID, within ctx. When they can't be fetched (no API client, no
+// installation or an API error) the last known topics are used. Topics are only
+// cached while REQUIRE_TOPIC is set.
+func (g *GitHubService) repositoryTopics(ctx context.Context, repository models.Repository, installationID int) []string {
+	g.mu.Lock()
+	needed := len(g.requiredTopics) > 0
+	if !needed {
+		g.mu.Unlock()
+		return repository.Topics
+	}
+	if repository.Topics != nil {
+		g.cacheTopics(repository.FullName, repository.Topics)
+		g.mu.Unlock()
+		return repository.Topics
+	}
+	cached, ok := g.topicCache[repository.FullName]
+	if ok {
+		cached.usedAt = time.Now()
+		g.topicCache[repository.FullName] = cached
+	}
+	client, cacheTTL := g.apiClient, g.topicCacheTTL
+	g.mu.Unlock()
+
+	if client == nil || installationID == 0 || (ok && time.Since(cached.fetchedAt) < cacheTTL) {
+		return cached.topics
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, githubAPITimeout)
+	defer cancel()
+	topics, err := client.RepositoryTopics(ctx, installationID, repository.FullName)
+	if err != nil {
+		log.Printf("⚠️  %v; using the last known topics", err)
+		return cached.topics
+	}
+
+	g.mu.Lock()
+	g.cacheTopics(repository.FullName, topics)
+	g.mu.Unlock()
+	return topics
+}
+
+// cacheTopics stores a repository's topics, dropping the least recently used
+// repository beyond topicCacheCapacity. g.mu must be held.
+func (g *GitHubService) cacheTopics(repository string, topics []string) {
+	now := time.Now()
+	g.topicCache[repository] = cachedTopics{topics: topics, fetchedAt: now, usedAt: now}
+	if len(g.topicCache) <= topicCacheCapacity {
+		return
+	}
+
+	var oldest string
+	for name, cached := range g.topicCache {
+		if oldest == "" || cached.usedAt.Before(g.topicCache[oldest].usedAt) {
+			oldest = name
+		}
+	}
+	delete(g.topicCache, oldest)
+}
+
+// hasRequiredTopic reports whether the event's repository carries a required topic
+func (g *GitHubService) hasRequiredTopic(event *models.WebhookEvent) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if len(g.requiredTopics) == 0 || event.RepositoryName == "" {
+		return true
+	}
+	for _, topic := range event.RepositoryTopics {
+		if containsFold(g.requiredTopics, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetWebhookSecrets configures per-tenant webhook secrets keyed by installation ID
+// (e.g. "12345") or repository full name (e.g. "owner/repo"), for servers that
+// receive webhooks from several GitHub Apps or organizations
+func (g *GitHubService) SetWebhookSecrets(secrets map[string]string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.webhookSecrets = secrets
+}
+
+// SetDirectorySecrets configures per-tenant webhook secrets loaded from a
+// secrets directory (see LoadSecretsDir). They are kept apart from
+// SetWebhookSecrets' so the directory can be reloaded on its own, and win when
+// both have a secret for the same tenant.
+func (g *GitHubService) SetDirectorySecrets(secrets map[string]string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.directorySecrets = secrets
+}
+
+// tenantSecret returns the per-tenant secret for key; callers hold mu
+func (g *GitHubService) tenantSecret(key string) (string, bool) {
+	if secret, ok := g.directorySecrets[key]; ok {
+		return secret, true
+	}
+	secret, ok := g.webhookSecrets[key]
+	return secret, ok
+}
+
+// Reasons VerifyWebhookSignatureE rejects a signature
+var (
+	ErrMissingPrefix      = errors.New("signature is missing the sha256= prefix")
+	ErrMalformedSignature = errors.New("signature is not a hex-encoded SHA-256 digest")
+	ErrNoSecret           = errors.New("no webhook secret is configured")
+	ErrSignatureMismatch  = errors.New("signature does not match the payload")
+	ErrTenantMismatch     = errors.New("payload's installation and repository belong to different tenants")
+)
+
 // VerifyWebhookSignature verifies the GitHub webhook signature
 func (g *GitHubService) VerifyWebhookSignature(payload []byte, signature string) bool {
+	return g.VerifyWebhookSignatureE(payload, signature) == nil
+}
+
+// VerifyWebhookSignatureE verifies the GitHub webhook signature, returning
+// ErrMissingPrefix, ErrMalformedSignature, ErrNoSecret, ErrTenantMismatch or
+// ErrSignatureMismatch when it is rejected
+func (g *GitHubService) VerifyWebhookSignatureE(payload []byte, signature string) error {
 	// GitHub sends signature as "sha256=<hex_digest>"
-	if !strings.HasPrefix(signature, "sha256=") {
-		return false
+	digest, found := strings.CutPrefix(signature, "sha256=")
+	if !found {
+		return ErrMissingPrefix
 	}
-	
-	// Remove the "sha256=" prefix
-	receivedSignature := strings.TrimPrefix(signature, "sha256=")
-	
-	// Calculate expected signature
-	mac := hmac.New(sha256.New, []byte(g.webhookSecret))
-	mac.Write(payload)
-	expectedSignature := hex.EncodeToString(mac.Sum(nil))
-	
-	// Use constant-time comparison to prevent timing attacks
-	return hmac.Equal([]byte(receivedSignature), []byte(expectedSignature))
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+		return ErrMalformedSignature
+	}
+
+	secrets, err := g.secretsFor(payload)
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		return ErrNoSecret
+	}
+	for _, secret := range secrets {
+		// Use constant-time comparison to prevent timing attacks
+		if hmac.Equal([]byte(signature), []byte(ComputeSignature(secret, payload))) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
 }
 
-// ProcessWebhookEvent processes the webhook payload and returns relevant information
-func (g *GitHubService) ProcessWebhookEvent(payload *models.GitHubWebhookPayload, eventType string) *models.WebhookEvent {
+// ExpectedSignature computes the "sha256=<hex_digest>" header value GitHub would send for payload
+func (g *GitHubService) ExpectedSignature(payload []byte) string {
+	secrets, _ := g.secretsFor(payload)
+	if len(secrets) == 0 {
+		return ""
+	}
+	return ComputeSignature(secrets[0], payload)
+}
+
+// secretsFor returns the secrets a payload may be signed with. A tenant secret
+// matching the payload's installation or repository is the only candidate;
+// otherwise only the default secret is, so one tenant's secret can never sign
+// deliveries for another tenant or an untenanted repository. The payload isn't
+// verified yet, so when its installation and repository both belong to tenants
+// they must share a secret: otherwise one tenant could sign a payload naming
+// its own installation and another tenant's repository, and
+// ErrTenantMismatch is returned.
+func (g *GitHubService) secretsFor(payload []byte) ([]string, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if len(g.webhookSecrets) > 0 || len(g.directorySecrets) > 0 {
+		var target struct {
+			Installation struct {
+				ID int `json:"id"`
+			} `json:"installation"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		json.Unmarshal(payload, &target)
+
+		var installationSecret, repositorySecret string
+		var installationTenant, repositoryTenant bool
+		if target.Installation.ID != 0 {
+			installationSecret, installationTenant = g.tenantSecret(strconv.Itoa(target.Installation.ID))
+		}
+		if target.Repository.FullName != "" {
+			repositorySecret, repositoryTenant = g.tenantSecret(target.Repository.FullName)
+		}
+		switch {
+		case installationTenant && repositoryTenant && installationSecret != repositorySecret:
+			return nil, ErrTenantMismatch
+		case installationTenant:
+			return []string{installationSecret}, nil
+		case repositoryTenant:
+			return []string{repositorySecret}, nil
+		}
+	}
+
+	if g.webhookSecret == "" {
+		return nil, nil
+	}
+	return []string{g.webhookSecret}, nil
+}
+
+// NormalizeEventType trims and lowercases an X-GitHub-Event value, so test tools
+// sending "Push" or " push " are treated like GitHub's "push"
+func NormalizeEventType(eventType string) string {
+	return strings.ToLower(strings.TrimSpace(eventType))
+}
+
+// ProcessWebhookEvent processes the webhook payload and returns relevant information.
+// ctx bounds the GitHub API lookups it may need, e.g. the delivery's request.
+func (g *GitHubService) ProcessWebhookEvent(ctx context.Context, payload *models.GitHubWebhookPayload, eventType string) *models.WebhookEvent {
+	eventType = NormalizeEventType(eventType)
 	event := &models.WebhookEvent{
-		EventType:      eventType,
-		RepositoryName: payload.Repository.Name,
-		InstallationID: payload.Installation.ID,
-		Action:         payload.Action,
+		EventType:          eventType,
+		RepositoryName:     payload.Repository.Name,
+		RepositoryFullName: payload.Repository.FullName,
+		InstallationID:     payload.Installation.ID,
+		Action:             payload.Action,
+		SenderLogin:        payload.Sender.Login,
+		SenderAvatarURL:    payload.Sender.AvatarURL,
+	}
+	if payload.Organization != nil {
+		event.Organization = payload.Organization.Login
+	}
+	if payload.Repository.FullName != "" {
+		event.RepositoryTopics = g.repositoryTopics(ctx, payload.Repository, payload.Installation.ID)
+	}
+	if strings.HasPrefix(payload.Ref, "refs/heads/") {
+		event.Branch = strings.TrimPrefix(payload.Ref, "refs/heads/")
 	}
 	
+	event.RefCreated = eventType == "push" && payload.Created
+
 	// Check for markdown file changes in push events
-	if eventType == "push" && len(payload.Commits) > 0 {
+	if commits := PushCommits(payload); eventType == "push" && len(commits) > 0 {
 		var changedFiles []string
+		var added, removed []string
+		var authors []string
 		hasMarkdownChanges := false
 		
-		for _, commit := range payload.Commits {
-			// Collect all changed files
-			changedFiles = append(changedFiles, commit.Added...)
-			changedFiles = append(changedFiles, commit.Modified...)
-			changedFiles = append(changedFiles, commit.Removed...)
-			
+		g.mu.RLock()
+		maxCommits, maxFiles := g.maxScanCommits, g.maxScanFiles
+		submodulePaths, draftPaths := g.submodulePaths, g.draftPaths
+		ignoredAuthors := g.ignoredAuthors
+		g.mu.RUnlock()
+		isDraft := func(file string) bool {
+			return isMarkdownFile(file) && matchesAnyPattern(draftPaths, file)
+		}
+		isMarkdown := func(file string) bool {
+			return isMarkdownFile(file) && !matchesAnyPattern(submodulePaths, file) && !isDraft(file)
+		}
+
+		hasFileStats, markdownLines := false, 0
+		// Whether a commit touching markdown was made by an author who isn't ignored
+		hasUnignoredMarkdown := len(ignoredAuthors) == 0
+
+		for i, commit := range commits {
+			if maxCommits > 0 && i == maxCommits {
+				log.Printf("Scanned the first %d of %d commits in push to %s", maxCommits, len(commits), event.RepositoryName)
+				break
+			}
+			if commit.Author.Username != "" {
+				authors = append(authors, commit.Author.Username)
+			}
+
 			// Check for markdown files
-			for _, file := range changedFiles {
-				if isMarkdownFile(file) {
-					hasMarkdownChanges = true
-					break
+			files := make([]string, 0, len(commit.Added)+len(commit.Modified)+len(commit.Removed))
+			files = append(files, commit.Added...)
+			files = append(files, commit.Modified...)
+			files = append(files, commit.Removed...)
+			// Judge the commit by its markdown line changes when the payload has
+			// per-file stats for it (so a markdown file only renamed or chmod'ed
+			// doesn't count), and by the markdown files it touches otherwise
+			commitTouchesMarkdown := false
+			if len(commit.Files) > 0 {
+				hasFileStats = true
+				for _, file := range commit.Files {
+					if isMarkdown(file.Filename) {
+						markdownLines += file.Additions + file.Deletions
+						commitTouchesMarkdown = commitTouchesMarkdown || file.Additions+file.Deletions > 0
+					}
 				}
+			} else {
+				for _, file := range files {
+					if isMarkdown(file) {
+						commitTouchesMarkdown = true
+						break
+					}
+				}
+			}
+			hasMarkdownChanges = hasMarkdownChanges || commitTouchesMarkdown
+			if commitTouchesMarkdown && !isIgnoredAuthor(ignoredAuthors, commit.Author) {
+				hasUnignoredMarkdown = true
 			}
+
+			// Collect changed files until the sample is full, then stop as soon as
+			// markdown has been found, without scanning another commit
+			if maxFiles == 0 || len(changedFiles) < maxFiles {
+				changedFiles = append(changedFiles, files...)
+				added = append(added, commit.Added...)
+				removed = append(removed, commit.Removed...)
+			}
+			if maxFiles > 0 && len(changedFiles) >= maxFiles && hasMarkdownChanges && hasUnignoredMarkdown {
+				break
+			}
+		}
+		if maxFiles > 0 && len(changedFiles) > maxFiles {
+			changedFiles = changedFiles[:maxFiles]
+		}
+		if hasFileStats {
+			event.MarkdownLinesChanged = markdownLines
+		}
+		if hasMarkdownChanges && !hasUnignoredMarkdown {
+			log.Printf("Ignoring markdown changes in push to %s: made entirely by ignored authors", event.RepositoryName)
+			hasMarkdownChanges = false
 		}
 		
 		event.HasMarkdownChanges = hasMarkdownChanges
-		event.ChangedFiles = removeDuplicates(changedFiles)
+		event.RenamedFiles = DetectRenames(added, removed)
+		event.ChangedFiles = withoutRenameSources(removeDuplicates(changedFiles), event.RenamedFiles)
+		if len(draftPaths) > 0 {
+			published := event.ChangedFiles[:0]
+			for _, file := range event.ChangedFiles {
+				if !isDraft(file) {
+					published = append(published, file)
+				}
+			}
+			event.ChangedFiles = published
+		}
+		event.Authors = removeDuplicates(authors)
+
+		// Summarize the push by its head commit, falling back to the last commit
+		headCommit := payload.HeadCommit
+		if headCommit == nil {
+			headCommit = &commits[len(commits)-1]
+		}
+		event.CommitAuthor = headCommit.Author.Username
+		if event.CommitAuthor == "" {
+			event.CommitAuthor = headCommit.Author.Name
+		}
+		event.CommitMessage, _, _ = strings.Cut(strings.TrimSpace(headCommit.Message), "\n")
+		event.CompareURL = payload.Compare
+		event.AutoGenerated = event.HasMarkdownChanges && g.botDocsModeSetting() == BotDocsTag && g.isBotPush(event)
+	}
+
+	// Capture who gained or lost access for collaborator/team events
+	if payload.Member != nil {
+		event.Member = payload.Member.Login
+	}
+	if payload.Team != nil {
+		event.Team = payload.Team.Name
+	}
+
+	if payload.DeploymentStatus != nil {
+		event.DeploymentState = payload.DeploymentStatus.State
+		event.DeploymentEnvironment = payload.DeploymentStatus.Environment
+		event.DeploymentURL = payload.DeploymentStatus.EnvironmentURL
+		if event.DeploymentURL == "" {
+			event.DeploymentURL = payload.DeploymentStatus.TargetURL
+		}
+	}
+
+	if payload.RegistryPackage != nil {
+		event.PackageName = payload.RegistryPackage.Name
+		event.PackageVersion = payload.RegistryPackage.PackageVersion.Version
+	}
+
+	if payload.Alert != nil && eventType == "secret_scanning_alert" {
+		event.AlertNumber = payload.Alert.Number
+		event.SecretType = payload.Alert.SecretTypeDisplayName
+		if event.SecretType == "" {
+			event.SecretType = payload.Alert.SecretType
+		}
+		event.AlertResolution = payload.Alert.Resolution
+		event.AlertURL = payload.Alert.HTMLURL
 	}
 	
 	return event
 }
 
+// PushCommits returns the commits a push introduced. A push creating a ref
+// from commits that are already on another branch lists none, so its head
+// commit stands in for them; e.g. a new default branch whose commit adds the
+// README still notifies.
+func PushCommits(payload *models.GitHubWebhookPayload) []models.Commit {
+	if len(payload.Commits) == 0 && payload.Created && payload.HeadCommit != nil {
+		return []models.Commit{*payload.HeadCommit}
+	}
+	return payload.Commits
+}
+
 // isMarkdownFile checks if a file is a markdown file
 func isMarkdownFile(filename string) bool {
 	lowercaseFile := strings.ToLower(filename)
@@ -99,26 +595,48 @@ func removeDuplicates(slice []string) []string {
 
 // GetWebhookEvents returns the list of events this service handles
 func (g *GitHubService) GetWebhookEvents() []string {
-	return []string{
-		"push",                       // Repository push events
-		"installation",               // App installation events
-		"installation_repositories",  // Repository access changes
+	events := []string{
+		"push",                      // Repository push events
+		"installation",              // App installation events
+		"installation_repositories", // Repository access changes
+		"member",                    // Collaborator access changes
+		"team",                      // Team access changes
+		"deployment_status",         // Docs site deployments
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.packageEvents {
+		events = append(events, "registry_package") // Package versions published (opt-in)
+	}
+	if g.secretAlerts {
+		events = append(events, "secret_scanning_alert") // Leaked secrets (opt-in)
 	}
+	return events
 }
 
 // ShouldNotifyApp determines if the iOS app should be notified
 func (g *GitHubService) ShouldNotifyApp(event *models.WebhookEvent) bool {
-	switch event.EventType {
-	case "push":
-		// Only notify for markdown file changes
-		return event.HasMarkdownChanges
-	case "installation":
-		// Notify for installation changes (added/removed)
-		return event.Action == "created" || event.Action == "deleted"
-	case "installation_repositories":
-		// Notify for repository access changes
-		return event.Action == "added" || event.Action == "removed"
-	default:
+	if !g.isSenderAllowed(event.SenderLogin) {
+		log.Printf("Suppressing %s event for %s: sender %q is not allowed", event.EventType, event.RepositoryName, event.SenderLogin)
 		return false
 	}
+
+	if event.EventType == "push" && event.HasMarkdownChanges && g.botDocsModeSetting() == BotDocsSuppress && g.isBotPush(event) {
+		log.Printf("Suppressing push to %s: made entirely by bots", event.RepositoryName)
+		return false
+	}
+
+	if !g.hasRequiredTopic(event) {
+		log.Printf("Suppressing %s event for %s: repository has none of the required topics", event.EventType, event.RepositoryName)
+		return false
+	}
+
+	eventType := NormalizeEventType(event.EventType)
+	for _, rule := range g.NotificationRules() {
+		if rule.EventType == eventType {
+			return rule.Matches(event)
+		}
+	}
+	return false
 }
\ No newline at end of file
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultGitHubAPIBaseURL is github.com's REST API; GitHub Enterprise Server
+// serves it at https://<host>/api/v3
+const DefaultGitHubAPIBaseURL = "https://api.github.com"
+
+// githubAPITimeout bounds an API lookup made while processing a webhook
+const githubAPITimeout = 5 * time.Second
+
+// ErrNoInstallation is returned for API calls that need an installation token
+// when the delivery came from a webhook without a GitHub App installation
+var ErrNoInstallation = errors.New("delivery has no GitHub App installation to authenticate as")
+
+// GitHubAPIClient calls the GitHub REST API as an installation of a GitHub App,
+// exchanging a JWT signed with the app's private key for installation tokens
+type GitHubAPIClient struct {
+	appID      string
+	privateKey *rsa.PrivateKey
+	baseURL    string
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[int]installationToken // by installation ID
+}
+
+// installationToken is a cached installation access token
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewGitHubAPIClient creates an API client for the GitHub App appID from its
+// private key file, as downloaded from the app's settings page. Every call,
+// including the token exchange, goes to baseURL (DefaultGitHubAPIBaseURL when empty).
+func NewGitHubAPIClient(appID, privateKeyPath, baseURL string) (*GitHubAPIClient, error) {
+	if baseURL == "" {
+		baseURL = DefaultGitHubAPIBaseURL
+	}
+	if err := ValidateAPIBaseURL(baseURL); err != nil {
+		return nil, err
+	}
+	privateKey, err := loadGitHubAppKey(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitHubAPIClient{
+		appID:      appID,
+		privateKey: privateKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		tokens:     make(map[int]installationToken),
+	}, nil
+}
+
+// ValidateAPIBaseURL checks that baseURL is an absolute http(s) URL
+func ValidateAPIBaseURL(baseURL string) error {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("GitHub API base URL %q must be an absolute http(s) URL", baseURL)
+	}
+	return nil
+}
+
+// loadGitHubAppKey reads a GitHub App's PEM private key (PKCS#1, as GitHub
+// issues them, or PKCS#8)
+func loadGitHubAppKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("GitHub App private key %s is not readable: %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key %s is not PEM encoded", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("GitHub App private key %s could not be parsed: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key %s holds a %T, expected an RSA key", path, parsed)
+	}
+	return key, nil
+}
+
+// RepositoryTopics fetches the topics of repository ("owner/repo") as installationID
+func (c *GitHubAPIClient) RepositoryTopics(ctx context.Context, installationID int, repository string) ([]string, error) {
+	if installationID == 0 {
+		return nil, ErrNoInstallation
+	}
+	accessToken, err := c.installationToken(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Names []string `json:"names"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repository+"/topics", "token "+accessToken, http.StatusOK, &result); err != nil {
+		return nil, fmt.Errorf("failed to fetch topics of %s: %w", repository, err)
+	}
+	if result.Names == nil {
+		result.Names = []string{}
+	}
+	return result.Names, nil
+}
+
+// installationToken returns a cached installation access token, exchanging a
+// signed app JWT for a new one when it is about to expire
+func (c *GitHubAPIClient) installationToken(ctx context.Context, installationID int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.tokens[installationID]; ok && time.Until(cached.expiresAt) > time.Minute {
+		return cached.token, nil
+	}
+
+	appJWT, err := c.signedAppJWT()
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installationID)
+	if err := c.do(ctx, http.MethodPost, path, "Bearer "+appJWT, http.StatusCreated, &result); err != nil {
+		return "", fmt.Errorf("failed to create an access token for installation %d: %w", installationID, err)
+	}
+	if result.Token == "" {
+		return "", fmt.Errorf("invalid access token response for installation %d", installationID)
+	}
+
+	c.tokens[installationID] = installationToken{token: result.Token, expiresAt: result.ExpiresAt}
+	return result.Token, nil
+}
+
+// do sends an API request with the given Authorization header and decodes the
+// JSON response into result, failing unless it has status want
+func (c *GitHubAPIClient) do(ctx context.Context, method, path, authorization string, want int, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// signedAppJWT creates the RS256-signed JWT authenticating as the GitHub App.
+// It is backdated a minute to allow for clock drift, and GitHub accepts at most
+// ten minutes of validity.
+func (c *GitHubAPIClient) signedAppJWT() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": c.appID,
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"mdtalkman-webhook/models"
+)
+
+// tenantPayload is a push payload for installation and repository; zero values are left out
+func tenantPayload(installationID, repository string) []byte {
+	payload := `{"ref": "refs/heads/main"`
+	if installationID != "" {
+		payload += `, "installation": {"id": ` + installationID + `}`
+	}
+	if repository != "" {
+		payload += `, "repository": {"name": "docs", "full_name": "` + repository + `"}`
+	}
+	return []byte(payload + "}")
+}
+
+func TestVerifyWebhookSignatureTenants(t *testing.T) {
+	tenantSecrets := map[string]string{
+		"1001":          "secret-a",
+		"tenant-a/docs": "secret-a",
+		"2002":          "secret-b",
+		"tenant-b/docs": "secret-b",
+	}
+
+	tests := []struct {
+		name           string
+		installationID string
+		repository     string
+		signingSecret  string
+		wantErr        error
+	}{
+		{name: "own installation and repository", installationID: "1001", repository: "tenant-a/docs", signingSecret: "secret-a"},
+		{name: "own installation", installationID: "2002", repository: "untenanted/docs", signingSecret: "secret-b"},
+		{name: "own repository", repository: "tenant-b/docs", signingSecret: "secret-b"},
+		{name: "other tenant's secret", installationID: "1001", repository: "tenant-a/docs", signingSecret: "secret-b", wantErr: ErrSignatureMismatch},
+		{name: "other tenant's repository secret", repository: "tenant-b/docs", signingSecret: "secret-a", wantErr: ErrSignatureMismatch},
+		{name: "installation and repository of different tenants", installationID: "1001", repository: "tenant-b/docs", signingSecret: "secret-a", wantErr: ErrTenantMismatch},
+		{name: "tenant secret for an untenanted repository", repository: "untenanted/docs", signingSecret: "secret-a", wantErr: ErrSignatureMismatch},
+		{name: "default secret for an untenanted repository", repository: "untenanted/docs", signingSecret: "default-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGitHubService("default-secret")
+			g.SetWebhookSecrets(tenantSecrets)
+
+			payload := tenantPayload(tt.installationID, tt.repository)
+			err := g.VerifyWebhookSignatureE(payload, ComputeSignature(tt.signingSecret, payload))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhookSignatureE = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// scanPayload is a push with one commit per entry of commits, each modifying
+// those files and made by "author<N>"
+func scanPayload(commits ...[]string) *models.GitHubWebhookPayload {
+	payload := &models.GitHubWebhookPayload{Ref: "refs/heads/main", Repository: models.Repository{Name: "docs"}}
+	for i, files := range commits {
+		payload.Commits = append(payload.Commits, models.Commit{
+			ID:       fmt.Sprintf("commit%d", i+1),
+			Author:   models.CommitAuthor{Username: fmt.Sprintf("author%d", i+1)},
+			Modified: files,
+		})
+	}
+	return payload
+}
+
+func TestProcessWebhookEventScanLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxCommits     int
+		maxFiles       int
+		ignoredAuthors []string
+		commits        [][]string
+		wantMarkdown   bool
+		wantFiles      []string
+		wantAuthors    []string
+	}{
+		{
+			name:         "no limits scans every commit",
+			commits:      [][]string{{"a.go"}, {"b.go"}, {"c.md"}},
+			wantMarkdown: true,
+			wantFiles:    []string{"a.go", "b.go", "c.md"},
+			wantAuthors:  []string{"author1", "author2", "author3"},
+		},
+		{
+			name:         "commit cap before the markdown commit",
+			maxCommits:   2,
+			commits:      [][]string{{"a.go"}, {"b.go"}, {"c.md"}},
+			wantMarkdown: false,
+			wantFiles:    []string{"a.go", "b.go"},
+			wantAuthors:  []string{"author1", "author2"},
+		},
+		{
+			name:         "commit cap reaching the markdown commit",
+			maxCommits:   3,
+			commits:      [][]string{{"a.go"}, {"b.go"}, {"c.md"}, {"d.md"}},
+			wantMarkdown: true,
+			wantFiles:    []string{"a.go", "b.go", "c.md"},
+			wantAuthors:  []string{"author1", "author2", "author3"},
+		},
+		{
+			name:         "file cap stops at the first markdown file",
+			maxFiles:     2,
+			commits:      [][]string{{"a.go", "b.go"}, {"c.go"}, {"d.md"}, {"e.md"}},
+			wantMarkdown: true,
+			wantFiles:    []string{"a.go", "b.go"},
+			wantAuthors:  []string{"author1", "author2", "author3"},
+		},
+		{
+			name:         "file cap truncates a large commit",
+			maxFiles:     2,
+			commits:      [][]string{{"a.md", "b.md", "c.md"}, {"d.md"}},
+			wantMarkdown: true,
+			wantFiles:    []string{"a.md", "b.md"},
+			wantAuthors:  []string{"author1"},
+		},
+		{
+			name:         "file cap without markdown scans every commit",
+			maxFiles:     1,
+			commits:      [][]string{{"a.go"}, {"b.go"}, {"c.go"}},
+			wantMarkdown: false,
+			wantFiles:    []string{"a.go"},
+			wantAuthors:  []string{"author1", "author2", "author3"},
+		},
+		{
+			name:           "file cap keeps scanning past ignored authors' markdown",
+			maxFiles:       1,
+			ignoredAuthors: []string{"author2"},
+			commits:        [][]string{{"a.go"}, {"b.md"}, {"c.go"}, {"d.md"}},
+			wantMarkdown:   true,
+			wantFiles:      []string{"a.go"},
+			wantAuthors:    []string{"author1", "author2", "author3", "author4"},
+		},
+		{
+			name:           "file cap with only ignored authors' markdown",
+			maxFiles:       1,
+			ignoredAuthors: []string{"author2"},
+			commits:        [][]string{{"a.go"}, {"b.md"}, {"c.go"}},
+			wantMarkdown:   false,
+			wantFiles:      []string{"a.go"},
+			wantAuthors:    []string{"author1", "author2", "author3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGitHubService("scan-test-secret")
+			g.SetScanLimits(tt.maxCommits, tt.maxFiles)
+			g.SetIgnoredAuthors(tt.ignoredAuthors)
+
+			event := g.ProcessWebhookEvent(context.Background(), scanPayload(tt.commits...), "push")
+			if event.HasMarkdownChanges != tt.wantMarkdown {
+				t.Errorf("HasMarkdownChanges = %t, want %t", event.HasMarkdownChanges, tt.wantMarkdown)
+			}
+			if !reflect.DeepEqual(event.ChangedFiles, tt.wantFiles) {
+				t.Errorf("ChangedFiles = %v, want %v", event.ChangedFiles, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(event.Authors, tt.wantAuthors) {
+				t.Errorf("Authors = %v, want %v", event.Authors, tt.wantAuthors)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// HoldQueue holds a device's events until a given time, e.g. the end of its
+// quiet hours or its next scheduled delivery, and then delivers them as one
+// summary push
+type HoldQueue struct {
+	send    func(models.Device, *models.WebhookEvent)
+	mu      sync.Mutex
+	pending map[holdKey]*pendingSummary
+}
+
+// holdKey identifies the events held for one device until one time
+type holdKey struct {
+	token string
+	until int64 // Unix nanoseconds
+}
+
+// NewHoldQueue creates a queue that calls send with each device's summary event
+func NewHoldQueue(send func(models.Device, *models.WebhookEvent)) *HoldQueue {
+	return &HoldQueue{
+		send:    send,
+		pending: make(map[holdKey]*pendingSummary),
+	}
+}
+
+// Hold queues an event for the device until the given time. Events held for a
+// device until the same time are sent together; events held until another time
+// (e.g. after the device changed its schedule) are sent separately at theirs.
+func (q *HoldQueue) Hold(device models.Device, event *models.WebhookEvent, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := holdKey{token: device.Token, until: until.UnixNano()}
+	if summary, ok := q.pending[key]; ok {
+		summary.events = append(summary.events, event)
+		return
+	}
+
+	q.pending[key] = &pendingSummary{device: device, events: []*models.WebhookEvent{event}}
+	time.AfterFunc(time.Until(until), func() { q.flush(key) })
+	log.Printf("⏸️ Holding pushes to device %s until %s", MaskToken(device.Token), until.Format(time.RFC3339))
+}
+
+// flush sends the summary held for a device until one time
+func (q *HoldQueue) flush(key holdKey) {
+	q.mu.Lock()
+	summary := q.pending[key]
+	delete(q.pending, key)
+	q.mu.Unlock()
+
+	if summary != nil {
+		q.send(summary.device, summarizeEvents(summary.events))
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// sentSummary is a summary a HoldQueue sent, and when
+type sentSummary struct {
+	event *models.WebhookEvent
+	at    time.Time
+}
+
+// newRecordingHoldQueue returns a queue reporting each summary it sends on the channel
+func newRecordingHoldQueue() (*HoldQueue, chan sentSummary) {
+	sent := make(chan sentSummary, 10)
+	return NewHoldQueue(func(device models.Device, event *models.WebhookEvent) {
+		sent <- sentSummary{event: event, at: time.Now()}
+	}), sent
+}
+
+// nextSummary waits for the queue's next summary
+func nextSummary(t *testing.T, sent chan sentSummary) sentSummary {
+	t.Helper()
+
+	select {
+	case summary := <-sent:
+		return summary
+	case <-time.After(time.Second):
+		t.Fatal("held events were never sent")
+		return sentSummary{}
+	}
+}
+
+func TestHoldQueueFlushesAtReleaseTime(t *testing.T) {
+	q, sent := newRecordingHoldQueue()
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+
+	until := time.Now().Add(40 * time.Millisecond)
+	q.Hold(device, &models.WebhookEvent{RepositoryName: "docs"}, until)
+	q.Hold(device, &models.WebhookEvent{RepositoryName: "blog"}, until)
+
+	summary := nextSummary(t, sent)
+	if summary.at.Before(until) {
+		t.Errorf("summary sent at %s, before its release time %s", summary.at.Format(time.StampMicro), until.Format(time.StampMicro))
+	}
+	if summary.event.EventType != SummaryEventType || summary.event.SummaryCount != 2 {
+		t.Errorf("summary = %s of %d events, want %s of 2", summary.event.EventType, summary.event.SummaryCount, SummaryEventType)
+	}
+}
+
+func TestHoldQueueKeepsReleaseTimesApart(t *testing.T) {
+	q, sent := newRecordingHoldQueue()
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+
+	later := time.Now().Add(80 * time.Millisecond)
+	earlier := time.Now().Add(20 * time.Millisecond)
+	q.Hold(device, &models.WebhookEvent{RepositoryName: "later"}, later)
+	q.Hold(device, &models.WebhookEvent{RepositoryName: "earlier"}, earlier)
+
+	first := nextSummary(t, sent)
+	if first.event.RepositoryName != "earlier" || first.at.After(later) {
+		t.Errorf("first summary = %q at %s, want only the earlier event before %s",
+			first.event.RepositoryName, first.at.Format(time.StampMicro), later.Format(time.StampMicro))
+	}
+	second := nextSummary(t, sent)
+	if second.event.RepositoryName != "later" || second.at.Before(later) {
+		t.Errorf("second summary = %q at %s, want the later event at %s",
+			second.event.RepositoryName, second.at.Format(time.StampMicro), later.Format(time.StampMicro))
+	}
+}
+
+func TestHoldQueueSeparatesDevices(t *testing.T) {
+	q, sent := newRecordingHoldQueue()
+	until := time.Now().Add(20 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for _, token := range []string{"device-token-one-000001", "device-token-two-000002"} {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			q.Hold(models.Device{Token: token}, &models.WebhookEvent{RepositoryName: token}, until)
+		}(token)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		seen[nextSummary(t, sent).event.RepositoryName] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("summaries = %v, want one per device", seen)
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"mdtalkman-webhook/models"
+)
+
+// Placeholders an image URL template may contain, e.g.
+// https://render.example.com/{organization}/{repository}/{branch}/{file}.png
+var imageURLPlaceholders = []string{"{repository}", "{organization}", "{branch}", "{file}"}
+
+// ValidateImageURL checks that an image URL template is an absolute http(s) URL
+// once its placeholders are filled in
+func ValidateImageURL(template string) error {
+	sample := template
+	for _, placeholder := range imageURLPlaceholders {
+		sample = strings.ReplaceAll(sample, placeholder, "x")
+	}
+	if _, err := parseImageURL(sample); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BuildImageURL fills in an image URL template for an event: {repository},
+// {organization} and {branch} by name and {file} by the first changed markdown
+// file. It returns "" when a placeholder has no value for the event (e.g. a
+// {file} template for an event without markdown) or the result isn't a valid URL.
+func BuildImageURL(template string, event *models.WebhookEvent) string {
+	values := map[string]string{
+		"{repository}":   url.PathEscape(event.RepositoryName),
+		"{organization}": url.PathEscape(event.Organization),
+		"{branch}":       url.PathEscape(event.Branch),
+		"{file}":         escapeFilePath(firstMarkdownFile(event.ChangedFiles)),
+	}
+
+	built := template
+	for placeholder, value := range values {
+		if !strings.Contains(built, placeholder) {
+			continue
+		}
+		if value == "" {
+			return ""
+		}
+		built = strings.ReplaceAll(built, placeholder, value)
+	}
+	if _, err := parseImageURL(built); err != nil {
+		return ""
+	}
+	return built
+}
+
+// parseImageURL parses rawURL and requires an http(s) scheme and a host
+func parseImageURL(rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image URL: %w", err)
+	}
+	if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, fmt.Errorf("image URL must be an absolute http(s) URL, got %q", rawURL)
+	}
+	return parsed, nil
+}
+
+// firstMarkdownFile returns the first markdown file among files, or ""
+func firstMarkdownFile(files []string) string {
+	for _, file := range files {
+		if isMarkdownFile(file) {
+			return file
+		}
+	}
+	return ""
+}
+
+// escapeFilePath escapes each segment of a repository path, keeping the slashes
+func escapeFilePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindow is how many recent samples percentiles are computed over
+const latencyWindow = 1024
+
+// LatencyPercentiles summarizes recent latencies in milliseconds
+type LatencyPercentiles struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50_ms"`
+	P95     float64 `json:"p95_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+// LatencyRecorder keeps the most recent latencies in a ring buffer, for quick
+// percentiles without a metrics system
+type LatencyRecorder struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	next    int
+	count   int
+}
+
+// NewLatencyRecorder creates an empty recorder
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{}
+}
+
+// Record adds a latency, replacing the oldest once the window is full
+func (r *LatencyRecorder) Record(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.next] = latency
+	r.next = (r.next + 1) % latencyWindow
+	if r.count < latencyWindow {
+		r.count++
+	}
+}
+
+// Percentiles returns the nearest-rank percentiles of the recorded window
+func (r *LatencyRecorder) Percentiles() LatencyPercentiles {
+	r.mu.Lock()
+	sorted := make([]time.Duration, r.count)
+	copy(sorted, r.samples[:r.count])
+	r.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return LatencyPercentiles{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(p float64) float64 {
+		i := int(p*float64(len(sorted))+0.999999) - 1
+		if i < 0 {
+			i = 0
+		}
+		return float64(sorted[i]) / float64(time.Millisecond)
+	}
+	return LatencyPercentiles{
+		Samples: len(sorted),
+		P50:     rank(0.50),
+		P95:     rank(0.95),
+		P99:     rank(0.99),
+		Max:     float64(sorted[len(sorted)-1]) / float64(time.Millisecond),
+	}
+}
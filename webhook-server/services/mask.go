@@ -0,0 +1,14 @@
+package services
+
+// minUnmaskedTokenLength is the shortest token that keeps any characters when masked.
+// Shorter tokens would reveal most of their value through the prefix and suffix.
+const minUnmaskedTokenLength = 12
+
+// MaskToken masks a device token for logging (security). Only the first and last
+// 4 characters of long tokens are kept, so the full token is never returned.
+func MaskToken(token string) string {
+	if len(token) < minUnmaskedTokenLength {
+		return "***"
+	}
+	return token[:4] + "..." + token[len(token)-4:]
+}
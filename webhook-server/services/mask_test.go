@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaskToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "empty", token: "", want: "***"},
+		{name: "short", token: "abcdefghijk", want: "***"},
+		{name: "boundary", token: "abcdefghijkl", want: "abcd...ijkl"},
+		{name: "long", token: "0123456789abcdef0123456789abcdef", want: "0123...cdef"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskToken(tt.token); got != tt.want {
+				t.Errorf("MaskToken(%q) = %q, want %q", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskTokenNeverRevealsMiddle(t *testing.T) {
+	for length := minUnmaskedTokenLength; length <= 64; length++ {
+		token := strings.Repeat("a", 4) + strings.Repeat("m", length-8) + strings.Repeat("z", 4)
+		masked := MaskToken(token)
+		if strings.Contains(masked, "m") {
+			t.Errorf("MaskToken of a %d-character token revealed its middle: %q", length, masked)
+		}
+		if masked == token {
+			t.Errorf("MaskToken returned a %d-character token unmasked", length)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sideshow/apns2"
+)
+
+// NotificationProfile describes how pushes for one event type are presented.
+// Empty fields keep the defaults: high priority, the default sound, no
+// interruption level, the event's default category and an alert push.
+type NotificationProfile struct {
+	Priority          int    `json:"priority,omitempty"`           // APNs priority: 10 (immediate) or 5 (power-considerate)
+	Sound             string `json:"sound,omitempty"`              // aps sound; "none" plays none
+	InterruptionLevel string `json:"interruption_level,omitempty"` // passive, active, time-sensitive or critical
+	Category          string `json:"category,omitempty"`           // aps category; "none" sends none
+	PushType          string `json:"push_type,omitempty"`          // "alert" or "background"
+}
+
+// defaultInterruptionLevels break through Focus for security events
+var defaultInterruptionLevels = map[string]string{
+	"secret_scanning_alert": "time-sensitive",
+}
+
+// noValue disables a profile's sound or category
+const noValue = "none"
+
+// ParseNotificationProfiles parses profiles given as a JSON object keyed by
+// event type, e.g. {"push": {"priority": 5, "sound": "none"}}
+func ParseNotificationProfiles(text string) (map[string]NotificationProfile, error) {
+	profiles := make(map[string]NotificationProfile)
+	if text == "" {
+		return profiles, nil
+	}
+	if err := json.Unmarshal([]byte(text), &profiles); err != nil {
+		return nil, fmt.Errorf("invalid notification profiles: %w", err)
+	}
+	for eventType, profile := range profiles {
+		if err := profile.Validate(); err != nil {
+			return nil, fmt.Errorf("notification profile %s: %w", eventType, err)
+		}
+	}
+	return profiles, nil
+}
+
+// Validate reports the first field holding a value APNs doesn't accept
+func (p NotificationProfile) Validate() error {
+	if p.Priority != 0 && p.Priority != apns2.PriorityHigh && p.Priority != apns2.PriorityLow {
+		return fmt.Errorf("priority must be %d or %d", apns2.PriorityHigh, apns2.PriorityLow)
+	}
+	if p.InterruptionLevel != "" && !validInterruptionLevels[p.InterruptionLevel] {
+		return fmt.Errorf("unknown interruption level %q", p.InterruptionLevel)
+	}
+	if p.PushType != "" && p.PushType != string(apns2.PushTypeAlert) && p.PushType != string(apns2.PushTypeBackground) {
+		return fmt.Errorf("push type must be alert or background")
+	}
+	return nil
+}
+
+// profileFor returns the event type's profile with the defaults filled in;
+// callers hold settingsMu
+func (a *APNsService) profileFor(eventType string) NotificationProfile {
+	profile := a.profiles[eventType]
+	if profile.Priority == 0 {
+		profile.Priority = apns2.PriorityHigh
+	}
+	if profile.Sound == "" {
+		profile.Sound = "default"
+	}
+	if profile.Category == "" {
+		profile.Category = defaultCategories[eventType]
+	}
+	if profile.InterruptionLevel == "" {
+		profile.InterruptionLevel = defaultInterruptionLevels[eventType]
+	}
+	if profile.PushType == "" {
+		profile.PushType = string(apns2.PushTypeAlert)
+	}
+	return profile
+}
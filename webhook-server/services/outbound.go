@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// Outbound webhook formats
+const (
+	OutboundFormatJSON  = "json"  // the WebhookEvent as JSON
+	OutboundFormatSlack = "slack" // a Slack incoming webhook message
+)
+
+// OutboundDestination is a URL notified alongside the push services
+type OutboundDestination struct {
+	URL    string `json:"url"`
+	Format string `json:"format,omitempty"` // OutboundFormatJSON or OutboundFormatSlack; Slack webhook URLs default to slack
+	Secret string `json:"secret,omitempty"` // signs bodies in X-MDTalkman-Signature when set
+}
+
+// OutboundSignatureHeader carries the HMAC-SHA256 of an outbound body as
+// "sha256=<hex_digest>", computed like GitHub's X-Hub-Signature-256
+const OutboundSignatureHeader = "X-MDTalkman-Signature"
+
+// ParseOutboundDestinations parses destinations given as comma-separated URLs or
+// as a JSON array, e.g. [{"url": "https://example.com/hook", "format": "json"}]
+func ParseOutboundDestinations(text string) ([]OutboundDestination, error) {
+	text = strings.TrimSpace(text)
+	var destinations []OutboundDestination
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &destinations); err != nil {
+			return nil, fmt.Errorf("invalid outbound webhooks: %w", err)
+		}
+	} else {
+		for _, rawURL := range strings.Split(text, ",") {
+			if rawURL = strings.TrimSpace(rawURL); rawURL != "" {
+				destinations = append(destinations, OutboundDestination{URL: rawURL})
+			}
+		}
+	}
+
+	for i := range destinations {
+		destination := &destinations[i]
+		parsed, err := url.Parse(destination.URL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("outbound webhook URL %q must be an absolute http(s) URL", destination.URL)
+		}
+		if destination.Format == "" {
+			destination.Format = OutboundFormatJSON
+			if parsed.Host == "hooks.slack.com" {
+				destination.Format = OutboundFormatSlack
+			}
+		}
+		if destination.Format != OutboundFormatJSON && destination.Format != OutboundFormatSlack {
+			return nil, fmt.Errorf("outbound webhook format must be json or slack, got %q", destination.Format)
+		}
+	}
+	return destinations, nil
+}
+
+// OutboundNotifier posts each notification to the configured destinations, e.g.
+// a Slack channel, independently of APNs and FCM
+type OutboundNotifier struct {
+	destinations []OutboundDestination
+	httpClient   *http.Client
+}
+
+// NewOutboundNotifier creates a notifier for destinations
+func NewOutboundNotifier(destinations []OutboundDestination) *OutboundNotifier {
+	return &OutboundNotifier{
+		destinations: destinations,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the event to every destination. Failures are logged and
+// otherwise ignored, so they never affect push delivery.
+func (n *OutboundNotifier) Notify(ctx context.Context, event *models.WebhookEvent) {
+	for _, destination := range n.destinations {
+		if err := n.post(ctx, destination, event); err != nil {
+			log.Printf("⚠️ Outbound webhook to %s failed: %v", redactURL(destination.URL), err)
+		}
+	}
+}
+
+// post sends the event to one destination in its format
+func (n *OutboundNotifier) post(ctx context.Context, destination OutboundDestination, event *models.WebhookEvent) error {
+	var message interface{} = event
+	if destination.Format == OutboundFormatSlack {
+		message = slackMessage(event)
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, destination.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MDTalkman-Webhook")
+	if destination.Secret != "" {
+		req.Header.Set(OutboundSignatureHeader, ComputeSignature(destination.Secret, body))
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// slackMessage renders the event like its push notification, linking the diff when known
+func slackMessage(event *models.WebhookEvent) map[string]string {
+	title, body := notificationText(event)
+	text := fmt.Sprintf("*%s*\n%s", title, body)
+	if event.CompareURL != "" {
+		text += fmt.Sprintf("\n<%s|View changes>", event.CompareURL)
+	}
+	return map[string]string{"text": text}
+}
+
+// redactURL drops the path and query of a URL for logging, since webhook URLs
+// (e.g. Slack's) carry their secret in the path
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/..."
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// maxPayloadSize is the APNs limit for a regular remote notification payload
+const maxPayloadSize = 4096
+
+// compressedEncoding tells the app how to decode the "payload" key
+const compressedEncoding = "gzip+base64"
+
+// compressCustomPayload gzips and base64-encodes the custom (non-aps) keys,
+// keeping aps readable by iOS. It only returns a payload when that is smaller
+// than plainSize and fits under the APNs size limit.
+func compressCustomPayload(aps, custom map[string]interface{}, plainSize int) ([]byte, bool) {
+	customOnly := make(map[string]interface{}, len(custom))
+	for key, value := range custom {
+		if key != "aps" {
+			customOnly[key] = value
+		}
+	}
+	data, err := json.Marshal(customOnly)
+	if err != nil {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return nil, false
+	}
+
+	compressed, err := json.Marshal(map[string]interface{}{
+		"aps":              aps,
+		"payload_encoding": compressedEncoding,
+		"payload":          base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+	if err != nil || len(compressed) >= plainSize || len(compressed) > maxPayloadSize {
+		return nil, false
+	}
+	return compressed, true
+}
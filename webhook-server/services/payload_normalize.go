@@ -0,0 +1,79 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	"mdtalkman-webhook/models"
+)
+
+// payloadAlternates holds fields that older GitHub and GitHub Enterprise Server
+// payloads use in place of the ones GitHubWebhookPayload reads
+type payloadAlternates struct {
+	Repository struct {
+		Owner struct {
+			Login string `json:"login"`
+			Name  string `json:"name"` // older push payloads name the owner instead of giving its login
+			Type  string `json:"type"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Pusher struct {
+		Name string `json:"name"`
+	} `json:"pusher"`
+	Commits    []alternateCommit `json:"commits"`
+	HeadCommit *alternateCommit  `json:"head_commit"`
+}
+
+// alternateCommit holds a commit author's login, sent by some payloads instead of username
+type alternateCommit struct {
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+// DecodePayload decodes a webhook payload, filling the fields event processing
+// depends on from their alternate names and locations when GitHub sent those instead
+func DecodePayload(data []byte) (*models.GitHubWebhookPayload, error) {
+	var payload models.GitHubWebhookPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	var alternates payloadAlternates
+	// Alternates are best effort: a shape we don't know leaves the payload as decoded
+	json.Unmarshal(data, &alternates)
+
+	normalizePayload(&payload, &alternates)
+	return &payload, nil
+}
+
+// normalizePayload fills empty payload fields from their alternates
+func normalizePayload(payload *models.GitHubWebhookPayload, alternates *payloadAlternates) {
+	repository := &payload.Repository
+	owner := alternates.Repository.Owner.Login
+	if owner == "" {
+		owner = alternates.Repository.Owner.Name
+	}
+	if repository.Name == "" && repository.FullName != "" {
+		repository.Name = repository.FullName[strings.LastIndex(repository.FullName, "/")+1:]
+	}
+	if repository.FullName == "" && repository.Name != "" && owner != "" {
+		repository.FullName = owner + "/" + repository.Name
+	}
+	if payload.Organization == nil && owner != "" && alternates.Repository.Owner.Type == "Organization" {
+		payload.Organization = &models.Organization{Login: owner}
+	}
+
+	// Push payloads predating the sender object only name the pusher
+	if payload.Sender.Login == "" && alternates.Pusher.Name != "" {
+		payload.Sender.Login = alternates.Pusher.Name
+	}
+
+	for i := range payload.Commits {
+		if i < len(alternates.Commits) && payload.Commits[i].Author.Username == "" {
+			payload.Commits[i].Author.Username = alternates.Commits[i].Author.Login
+		}
+	}
+	if payload.HeadCommit != nil && alternates.HeadCommit != nil && payload.HeadCommit.Author.Username == "" {
+		payload.HeadCommit.Author.Username = alternates.HeadCommit.Author.Login
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+
+	"mdtalkman-webhook/metrics"
+)
+
+// Sending a push fails in one of three ways:
+//   - ErrCircuitOpen (wrapped): the push wasn't attempted because APNs is failing or throttling
+//   - *TransportError: the push service couldn't be reached; retry later, the device is fine
+//   - *PushError: the push service answered and refused the push; inspect StatusCode and Reason
+
+// TransportError means the push service couldn't be reached: a connection, TLS
+// or timeout failure. It is transient and says nothing about the device token.
+type TransportError struct {
+	Service string // "APNs" or "FCM"
+	Err     error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("failed to send %s notification: %v", e.Service, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// PushError is a push the push service refused, e.g. APNs answering 410
+// Unregistered (prune the token) or 429 TooManyRequests (retry later)
+type PushError struct {
+	Service    string // "APNs" or "FCM"
+	StatusCode int
+	Reason     string
+}
+
+func (e *PushError) Error() string {
+	return fmt.Sprintf("%s returned non-200 status: %d - %s", e.Service, e.StatusCode, e.Reason)
+}
+
+// Retryable reports whether the push may succeed if sent again later
+// (throttling or a server error), as opposed to a problem with the push or token
+func (e *PushError) Retryable() bool {
+	return e.StatusCode == 429 || e.StatusCode >= 500
+}
+
+// countPush records a notification's outcome in the process-wide metrics
+func countPush(err error) {
+	if err != nil {
+		metrics.PushesFailed.Inc()
+	} else {
+		metrics.PushesSent.Inc()
+	}
+}
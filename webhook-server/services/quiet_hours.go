@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// Quiet hours modes: what happens to a push during a device's quiet hours
+const (
+	QuietHoursSuppress = "suppress" // don't push at all
+	QuietHoursSilent   = "silent"   // push without alert, sound or badge
+)
+
+// quietHoursLayout is the clock time format for quiet hours, e.g. "22:00"
+const quietHoursLayout = "15:04"
+
+// ValidateQuietHours checks that a quiet hours window has valid times and timezone
+func ValidateQuietHours(quiet *models.QuietHours) error {
+	if _, err := time.Parse(quietHoursLayout, quiet.Start); err != nil {
+		return fmt.Errorf("invalid start %q, expected HH:MM", quiet.Start)
+	}
+	if _, err := time.Parse(quietHoursLayout, quiet.End); err != nil {
+		return fmt.Errorf("invalid end %q, expected HH:MM", quiet.End)
+	}
+	if _, err := time.LoadLocation(quiet.TimeZone); err != nil {
+		return fmt.Errorf("invalid timezone %q", quiet.TimeZone)
+	}
+	return nil
+}
+
+// QuietUntil reports whether now falls in the quiet hours window and, if so,
+// when the window ends. Windows may cross midnight (e.g. 22:00-07:00).
+func QuietUntil(quiet *models.QuietHours, now time.Time) (time.Time, bool) {
+	if quiet == nil {
+		return time.Time{}, false
+	}
+	start, errStart := time.Parse(quietHoursLayout, quiet.Start)
+	end, errEnd := time.Parse(quietHoursLayout, quiet.End)
+	location, errLocation := time.LoadLocation(quiet.TimeZone)
+	if errStart != nil || errEnd != nil || errLocation != nil || quiet.Start == quiet.End {
+		return time.Time{}, false
+	}
+
+	local := now.In(location)
+	at := func(clock time.Time, dayOffset int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+dayOffset, clock.Hour(), clock.Minute(), 0, 0, location)
+	}
+	startToday, endToday := at(start, 0), at(end, 0)
+
+	if startToday.Before(endToday) {
+		// Same-day window, e.g. 12:00-14:00
+		if !local.Before(startToday) && local.Before(endToday) {
+			return endToday, true
+		}
+		return time.Time{}, false
+	}
+
+	// Overnight window, e.g. 22:00-07:00
+	if !local.Before(startToday) {
+		return at(end, 1), true
+	}
+	if local.Before(endToday) {
+		return endToday, true
+	}
+	return time.Time{}, false
+}
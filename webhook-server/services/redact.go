@@ -0,0 +1,67 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// redactedValue replaces redacted fields in logged payloads
+const redactedValue = "***"
+
+// RedactJSON returns body with the values at paths replaced by "***", for logging.
+// Paths are dot-separated field names, with a "[]" suffix descending into every
+// element of an array, e.g. "repository.full_name" or "commits[].message".
+// Bodies that aren't JSON objects are not logged verbatim.
+func RedactJSON(body []byte, paths []string) string {
+	var root interface{}
+	if err := json.Unmarshal(body, &root); err != nil {
+		return fmt.Sprintf("<non-JSON body, %d bytes>", len(body))
+	}
+
+	for _, path := range paths {
+		redactPath(root, strings.Split(path, "."))
+	}
+
+	redacted, err := json.Marshal(root)
+	if err != nil {
+		return fmt.Sprintf("<unencodable body, %d bytes>", len(body))
+	}
+	return string(redacted)
+}
+
+// redactPath replaces the value at the path segments below node
+func redactPath(node interface{}, segments []string) {
+	object, ok := node.(map[string]interface{})
+	if !ok || len(segments) == 0 {
+		return
+	}
+
+	name, isArray := strings.CutSuffix(segments[0], "[]")
+	value, exists := object[name]
+	if !exists {
+		return
+	}
+	last := len(segments) == 1
+
+	if !isArray {
+		if last {
+			object[name] = redactedValue
+		} else {
+			redactPath(value, segments[1:])
+		}
+		return
+	}
+
+	elements, ok := value.([]interface{})
+	if !ok {
+		return
+	}
+	for i, element := range elements {
+		if last {
+			elements[i] = redactedValue
+		} else {
+			redactPath(element, segments[1:])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	body := []byte(`{
+		"ref": "refs/heads/main",
+		"repository": {"name": "secret-docs", "full_name": "octocat/secret-docs"},
+		"commits": [
+			{"id": "abc123", "message": "Fix the unreleased roadmap"},
+			{"id": "def456", "message": "Draft the acquisition memo"}
+		],
+		"labels": ["internal", "private"]
+	}`)
+
+	tests := []struct {
+		name     string
+		paths    []string
+		want     []string
+		wantGone []string
+	}{
+		{
+			name:     "nested field",
+			paths:    []string{"repository.full_name"},
+			want:     []string{`"full_name":"***"`, `"name":"secret-docs"`, "Fix the unreleased roadmap"},
+			wantGone: []string{"octocat/secret-docs"},
+		},
+		{
+			name:     "field of every array element",
+			paths:    []string{"commits[].message"},
+			want:     []string{`"message":"***"`, `"id":"abc123"`, `"id":"def456"`, "octocat/secret-docs"},
+			wantGone: []string{"unreleased roadmap", "acquisition memo"},
+		},
+		{
+			name:     "every array element",
+			paths:    []string{"labels[]"},
+			want:     []string{`"labels":["***","***"]`},
+			wantGone: []string{"internal", "private"},
+		},
+		{
+			name:  "missing paths are ignored",
+			paths: []string{"head_commit.message", "sender.login", "ref[]"},
+			want:  []string{"octocat/secret-docs", "unreleased roadmap", `"ref":"refs/heads/main"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RedactJSON(body, tt.paths)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("RedactJSON = %s, want it to contain %s", got, want)
+				}
+			}
+			for _, gone := range tt.wantGone {
+				if strings.Contains(got, gone) {
+					t.Errorf("RedactJSON = %s, leaked %q", got, gone)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactJSONNonJSON(t *testing.T) {
+	got := RedactJSON([]byte("payload=octocat%2Fsecret-docs"), []string{"repository.full_name"})
+	if strings.Contains(got, "secret-docs") {
+		t.Errorf("RedactJSON logged a non-JSON body verbatim: %s", got)
+	}
+}
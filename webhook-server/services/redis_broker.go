@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// EventBroker fans processed webhook events out to every server instance, so
+// each one can notify the devices registered with it
+type EventBroker interface {
+	// Publish sends an event to all subscribed instances (including this one)
+	Publish(ctx context.Context, event *models.WebhookEvent) error
+	// Subscribe calls handler for every published event until Close is called
+	Subscribe(handler func(*models.WebhookEvent))
+	// Close stops the subscription and releases connections
+	Close() error
+}
+
+// RedisBroker implements EventBroker with Redis pub/sub, speaking the RESP
+// protocol directly. It only needs AUTH, PUBLISH and SUBSCRIBE, so a minimal
+// client keeps the APNs library the server's only runtime dependency.
+type RedisBroker struct {
+	addr     string
+	password string
+	channel  string
+
+	mu      sync.Mutex
+	pubConn *redisConn
+	closed  chan struct{}
+}
+
+// redisConn is a single connection to Redis
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisBroker creates a broker from a redis://[:password@]host:port URL
+func NewRedisBroker(rawURL, channel string) (*RedisBroker, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "redis" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid redis URL %q: expected redis://[:password@]host:port", rawURL)
+	}
+
+	password, _ := parsed.User.Password()
+	broker := &RedisBroker{
+		addr:     parsed.Host,
+		password: password,
+		channel:  channel,
+		closed:   make(chan struct{}),
+	}
+
+	// Fail fast on an unreachable broker instead of on the first webhook
+	conn, err := broker.dial()
+	if err != nil {
+		return nil, err
+	}
+	broker.pubConn = conn
+
+	return broker, nil
+}
+
+// Publish sends an event to every instance subscribed to the channel
+func (b *RedisBroker) Publish(ctx context.Context, event *models.WebhookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pubConn == nil {
+		if b.pubConn, err = b.dial(); err != nil {
+			return err
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		b.pubConn.conn.SetDeadline(deadline)
+	} else {
+		b.pubConn.conn.SetDeadline(time.Time{})
+	}
+
+	if _, err := b.pubConn.do("PUBLISH", b.channel, string(data)); err != nil {
+		// Drop the connection so the next publish reconnects
+		b.pubConn.conn.Close()
+		b.pubConn = nil
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe starts a background subscription that reconnects until Close is called
+func (b *RedisBroker) Subscribe(handler func(*models.WebhookEvent)) {
+	go func() {
+		backoff := time.Second
+		for {
+			err := b.subscribeOnce(handler)
+
+			select {
+			case <-b.closed:
+				return
+			default:
+			}
+
+			log.Printf("⚠️  Redis subscription lost (%v), reconnecting in %s", err, backoff)
+			time.Sleep(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+	}()
+}
+
+// subscribeOnce reads messages from one subscription connection until it fails
+func (b *RedisBroker) subscribeOnce(handler func(*models.WebhookEvent)) error {
+	conn, err := b.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.conn.Close()
+
+	// Unblock the read loop when the broker is closed
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-b.closed:
+			conn.conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := conn.send("SUBSCRIBE", b.channel); err != nil {
+		return err
+	}
+	log.Printf("📡 Subscribed to Redis channel %s", b.channel)
+
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+
+		// Messages arrive as ["message", channel, payload]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		payload, _ := parts[2].(string)
+
+		var event models.WebhookEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Printf("⚠️  Ignoring malformed event from Redis: %v", err)
+			continue
+		}
+		handler(&event)
+	}
+}
+
+// Close stops the subscription and closes the publish connection
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+		return nil
+	default:
+		close(b.closed)
+	}
+
+	if b.pubConn != nil {
+		err := b.pubConn.conn.Close()
+		b.pubConn = nil
+		return err
+	}
+	return nil
+}
+
+// dial opens and authenticates a new connection
+func (b *RedisBroker) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", b.addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", b.addr, err)
+	}
+
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if b.password != "" {
+		if _, err := rc.do("AUTH", b.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis authentication failed: %w", err)
+		}
+	}
+	return rc, nil
+}
+
+// do sends a command and reads its reply
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// send writes a command as a RESP array of bulk strings
+func (c *redisConn) send(args ...string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write([]byte(sb.String()))
+	return err
+}
+
+// read parses one RESP reply
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis error: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply: %q", line)
+	}
+}
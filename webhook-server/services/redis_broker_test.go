@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"mdtalkman-webhook/models"
+)
+
+// subscribedBroker connects a broker to server and forwards the events it receives to the returned channel
+func subscribedBroker(t *testing.T, server *miniredis.Miniredis, channel string) (*RedisBroker, <-chan *models.WebhookEvent) {
+	t.Helper()
+
+	broker, err := NewRedisBroker("redis://"+server.Addr(), channel)
+	if err != nil {
+		t.Fatalf("NewRedisBroker: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	events := make(chan *models.WebhookEvent, 10)
+	broker.Subscribe(func(event *models.WebhookEvent) { events <- event })
+	return broker, events
+}
+
+// receive waits for the next event from events
+func receive(t *testing.T, events <-chan *models.WebhookEvent) *models.WebhookEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func TestRedisBrokerFansOutAcrossInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	brokerA, eventsA := subscribedBroker(t, server, "mdtalkman:events")
+	brokerB, eventsB := subscribedBroker(t, server, "mdtalkman:events")
+
+	// Publishing before both subscriptions are active would lose the event
+	deadline := time.Now().Add(5 * time.Second)
+	for server.PubSubNumSub("mdtalkman:events")["mdtalkman:events"] < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for both brokers to subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx := context.Background()
+	if err := brokerA.Publish(ctx, &models.WebhookEvent{EventType: "push", RepositoryName: "from-a"}); err != nil {
+		t.Fatalf("Publish from A: %v", err)
+	}
+	if err := brokerB.Publish(ctx, &models.WebhookEvent{EventType: "push", RepositoryName: "from-b"}); err != nil {
+		t.Fatalf("Publish from B: %v", err)
+	}
+
+	// Each instance receives both events, in publish order
+	for name, events := range map[string]<-chan *models.WebhookEvent{"A": eventsA, "B": eventsB} {
+		for _, want := range []string{"from-a", "from-b"} {
+			if got := receive(t, events).RepositoryName; got != want {
+				t.Errorf("broker %s received %q, want %q", name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"path"
+
+	"mdtalkman-webhook/models"
+)
+
+// DetectRenames pairs removed and added paths that look like the same file moved:
+// the same file name in a different directory. Push payloads have no rename
+// information, so a move shows up as one removal plus one addition.
+func DetectRenames(added, removed []string) []models.FileRename {
+	addedPaths := make(map[string]bool, len(added))
+	for _, file := range added {
+		addedPaths[file] = true
+	}
+	removedPaths := make(map[string]bool, len(removed))
+	for _, file := range removed {
+		removedPaths[file] = true
+	}
+
+	var renames []models.FileRename
+	paired := make(map[string]bool)
+	for _, from := range removeDuplicates(removed) {
+		// A path removed and re-added is a modification, not a move
+		if addedPaths[from] {
+			continue
+		}
+		for _, to := range removeDuplicates(added) {
+			if paired[to] || removedPaths[to] || path.Base(to) != path.Base(from) {
+				continue
+			}
+			renames = append(renames, models.FileRename{From: from, To: to})
+			paired[to] = true
+			break
+		}
+	}
+	return renames
+}
+
+// withoutRenameSources drops the old paths of renamed files, so each rename
+// counts as one changed file
+func withoutRenameSources(files []string, renames []models.FileRename) []string {
+	if len(renames) == 0 {
+		return files
+	}
+	sources := make(map[string]bool, len(renames))
+	for _, rename := range renames {
+		sources[rename.From] = true
+	}
+
+	kept := []string{}
+	for _, file := range files {
+		if !sources[file] {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// DeliveryTimestamp returns when a delivery was created, for rejecting replayed
+// deliveries: from headerValue (RFC 3339 or Unix seconds, set by a proxy that
+// stamps requests) when given, otherwise from the newest commit of a push.
+// GitHub doesn't sign a timestamp, so this only bounds replays of pushes or of
+// requests passing through such a proxy.
+func DeliveryTimestamp(payload *models.GitHubWebhookPayload, headerValue string) (time.Time, bool) {
+	if headerValue != "" {
+		if t, err := time.Parse(time.RFC3339, headerValue); err == nil {
+			return t, true
+		}
+		if seconds, err := strconv.ParseInt(headerValue, 10, 64); err == nil {
+			return time.Unix(seconds, 0), true
+		}
+		return time.Time{}, false
+	}
+
+	var newest time.Time
+	for _, commit := range PushCommits(payload) {
+		if commit.Timestamp.After(newest) {
+			newest = commit.Timestamp
+		}
+	}
+	return newest, !newest.IsZero()
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RepoStat is how often a repository's events have notified devices
+type RepoStat struct {
+	Repository    string    `json:"repository"`
+	Notifications int       `json:"notifications"`
+	LastNotified  time.Time `json:"last_notified"`
+}
+
+// RepoStats counts notifications per repository, to spot noisy repositories
+type RepoStats struct {
+	mu    sync.Mutex
+	repos map[string]*RepoStat
+}
+
+// NewRepoStats creates empty per-repository counters
+func NewRepoStats() *RepoStats {
+	return &RepoStats{repos: make(map[string]*RepoStat)}
+}
+
+// Record counts a notification for repository
+func (s *RepoStats) Record(repository string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stat, ok := s.repos[repository]
+	if !ok {
+		stat = &RepoStat{Repository: repository}
+		s.repos[repository] = stat
+	}
+	stat.Notifications++
+	stat.LastNotified = at
+}
+
+// Snapshot returns the counters, most notifications first
+func (s *RepoStats) Snapshot() []RepoStat {
+	s.mu.Lock()
+	stats := make([]RepoStat, 0, len(s.repos))
+	for _, stat := range s.repos {
+		stats = append(stats, *stat)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Notifications != stats[j].Notifications {
+			return stats[i].Notifications > stats[j].Notifications
+		}
+		return stats[i].Repository < stats[j].Repository
+	})
+	return stats
+}
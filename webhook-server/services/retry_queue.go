@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// RetryItem is a push to one device waiting to be retried
+type RetryItem struct {
+	ID          string               `json:"id"`
+	Device      models.Device        `json:"device"`
+	Event       *models.WebhookEvent `json:"event"`
+	Attempts    int                  `json:"attempts"` // sends so far, including the original broadcast
+	NextAttempt time.Time            `json:"next_attempt"`
+	LastError   string               `json:"last_error,omitempty"`
+}
+
+// RetryQueue re-sends pushes that failed transiently during a broadcast, with
+// exponential backoff, until they succeed or maxAttempts sends have been made.
+// Pushes that fail permanently or run out of attempts are dead letters: logged,
+// and appended to path + ".dead" when the queue is persisted. With a path the
+// pending retries are saved on every change and resumed by Start after a restart.
+type RetryQueue struct {
+	path        string
+	maxAttempts int
+	backoff     time.Duration
+	send        func(context.Context, models.Device, *models.WebhookEvent) error
+
+	mu      sync.Mutex
+	pending map[string]*RetryItem
+	nextID  int
+}
+
+// OpenRetryQueue creates a queue, loading the retries saved at path when it is set
+func OpenRetryQueue(path string, maxAttempts int, backoff time.Duration) (*RetryQueue, error) {
+	q := &RetryQueue{
+		path:        path,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		pending:     make(map[string]*RetryItem),
+	}
+	if path == "" {
+		return q, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry queue: %w", err)
+	}
+	var items []*RetryItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to read retry queue: %w", err)
+	}
+	for _, item := range items {
+		q.pending[item.ID] = item
+		if id, err := strconv.Atoi(item.ID); err == nil && id >= q.nextID {
+			q.nextID = id + 1
+		}
+	}
+	return q, nil
+}
+
+// Start sets how pushes are sent and schedules the retries loaded from disk
+func (q *RetryQueue) Start(send func(context.Context, models.Device, *models.WebhookEvent) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.send = send
+	if len(q.pending) > 0 {
+		log.Printf("🔁 Resuming %d pending push retries", len(q.pending))
+	}
+	for _, item := range q.pending {
+		q.schedule(item)
+	}
+}
+
+// Len returns the number of pushes waiting to be retried
+func (q *RetryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// Add queues a retry of each device whose push failed transiently in a
+// broadcast's error (see RetryableDevices); its first send counts as an attempt
+func (q *RetryQueue) Add(devices []models.Device, event *models.WebhookEvent, broadcastErr error) {
+	retryable := RetryableDevices(devices, broadcastErr)
+	if len(retryable) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, device := range retryable {
+		item := &RetryItem{
+			ID:        strconv.Itoa(q.nextID),
+			Device:    device,
+			Event:     event,
+			Attempts:  1,
+			LastError: broadcastErr.Error(),
+		}
+		q.nextID++
+		if !q.reschedule(item) {
+			continue
+		}
+		q.pending[item.ID] = item
+	}
+	log.Printf("🔁 Retrying %d failed devices in %s", len(retryable), q.backoff)
+	q.save()
+}
+
+// reschedule sets the item's next attempt after the backoff for its attempts so
+// far and schedules it, or dead-letters it when no attempts are left; callers hold mu
+func (q *RetryQueue) reschedule(item *RetryItem) bool {
+	if item.Attempts >= q.maxAttempts {
+		q.deadLetter(item)
+		return false
+	}
+	item.NextAttempt = time.Now().Add(q.backoff << (item.Attempts - 1))
+	q.schedule(item)
+	return true
+}
+
+// schedule runs the item's next attempt when it is due; callers hold mu
+func (q *RetryQueue) schedule(item *RetryItem) {
+	if q.send == nil {
+		return // Start schedules it
+	}
+	time.AfterFunc(time.Until(item.NextAttempt), func() { q.attempt(item.ID) })
+}
+
+// attempt sends one retry and requeues or dead-letters it if it fails
+func (q *RetryQueue) attempt(id string) {
+	q.mu.Lock()
+	item, ok := q.pending[id]
+	send := q.send
+	q.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	err := send(context.Background(), item.Device, item.Event)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item.Attempts++
+	switch {
+	case err == nil:
+		log.Printf("✅ Retry %d succeeded for device %s", item.Attempts-1, MaskToken(item.Device.Token))
+		delete(q.pending, id)
+	case !IsTransientPushError(err):
+		item.LastError = err.Error()
+		delete(q.pending, id)
+		q.deadLetter(item)
+	default:
+		item.LastError = err.Error()
+		if !q.reschedule(item) {
+			delete(q.pending, id)
+		}
+	}
+	q.save()
+}
+
+// deadLetter records a push that won't be retried; callers hold mu
+func (q *RetryQueue) deadLetter(item *RetryItem) {
+	log.Printf("☠️ Giving up on push to device %s after %d attempts: %s", MaskToken(item.Device.Token), item.Attempts, item.LastError)
+	if q.path == "" {
+		return
+	}
+
+	file, err := os.OpenFile(q.path+".dead", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Error opening dead letter log: %v", err)
+		return
+	}
+	defer file.Close()
+	data, _ := json.Marshal(item)
+	file.Write(append(data, '\n'))
+}
+
+// save writes the pending retries to path; callers hold mu
+func (q *RetryQueue) save() {
+	if q.path == "" {
+		return
+	}
+
+	items := make([]*RetryItem, 0, len(q.pending))
+	for _, item := range q.pending {
+		items = append(items, item)
+	}
+	data, _ := json.Marshal(items)
+	tmpPath := q.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		log.Printf("Error saving retry queue: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		log.Printf("Error saving retry queue: %v", err)
+	}
+}
+
+// RetryableDevices returns the devices a broadcast failed for transiently: those
+// whose push service couldn't be reached, throttled or failed with a server
+// error, and those not attempted because the broadcast was aborted. A broadcast
+// error's results are in the order of devices.
+func RetryableDevices(devices []models.Device, err error) []models.Device {
+	var broadcastErr *BroadcastError
+	if !errors.As(err, &broadcastErr) {
+		return nil
+	}
+
+	var retryable []models.Device
+	for i, device := range devices {
+		if i >= len(broadcastErr.Results) {
+			retryable = append(retryable, device)
+			continue
+		}
+		if broadcastErr.Results[i].Retryable() {
+			retryable = append(retryable, device)
+		}
+	}
+	return retryable
+}
+
+// IsTransientPushError reports whether a push may succeed when sent again later
+func IsTransientPushError(err error) bool {
+	var transportErr *TransportError
+	var pushErr *PushError
+	switch {
+	case errors.As(err, &pushErr):
+		return pushErr.Retryable()
+	case errors.As(err, &transportErr), errors.Is(err, ErrCircuitOpen),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"mdtalkman-webhook/models"
+)
+
+func TestRetryableDevices(t *testing.T) {
+	devices := []models.Device{
+		{Token: "sent-device-token-0001"},
+		{Token: "unreachable-device-0002"},
+		{Token: "throttled-device-0003"},
+		{Token: "unregistered-device-04"},
+		{Token: "unconfigured-device-05"},
+		{Token: "not-attempted-device-6"},
+	}
+	err := &BroadcastError{
+		Results: []DeviceResult{
+			newDeviceResult(devices[0], nil),
+			newDeviceResult(devices[1], &TransportError{Service: "APNs", Err: errors.New("connection refused")}),
+			newDeviceResult(devices[2], &PushError{Service: "APNs", StatusCode: 429, Reason: "TooManyRequests"}),
+			newDeviceResult(devices[3], &PushError{Service: "APNs", StatusCode: 410, Reason: "Unregistered"}),
+			newDeviceResult(devices[4], fmt.Errorf("FCM is not configured")),
+		},
+		Aborted: fmt.Errorf("APNs is unavailable: %w", ErrCircuitOpen),
+	}
+
+	got := RetryableDevices(devices, err)
+	want := []string{devices[1].Token, devices[2].Token, devices[5].Token}
+	if len(got) != len(want) {
+		t.Fatalf("RetryableDevices returned %d devices, want %d: %v", len(got), len(want), got)
+	}
+	for i, device := range got {
+		if device.Token != want[i] {
+			t.Errorf("retryable device %d = %s, want %s", i, device.Token, want[i])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import "mdtalkman-webhook/models"
+
+// NotificationRule describes which events of one type notify the app
+type NotificationRule struct {
+	EventType             string   `json:"event_type"`
+	Actions               []string `json:"actions,omitempty"` // actions that notify; empty means any
+	RequiresMarkdown      bool     `json:"requires_markdown"`
+	DeploymentEnvironment string   `json:"deployment_environment,omitempty"`
+	DeploymentStates      []string `json:"deployment_states,omitempty"`
+}
+
+// Matches reports whether event satisfies the rule
+func (r NotificationRule) Matches(event *models.WebhookEvent) bool {
+	if len(r.Actions) > 0 && !contains(r.Actions, event.Action) {
+		return false
+	}
+	if r.RequiresMarkdown && !event.HasMarkdownChanges {
+		return false
+	}
+	if r.DeploymentEnvironment != "" && event.DeploymentEnvironment != r.DeploymentEnvironment {
+		return false
+	}
+	if len(r.DeploymentStates) > 0 && !contains(r.DeploymentStates, event.DeploymentState) {
+		return false
+	}
+	return true
+}
+
+// NotificationRules returns the active rule for every event type that can notify
+func (g *GitHubService) NotificationRules() []NotificationRule {
+	g.mu.RLock()
+	environment := g.deploymentEnvironment
+	packageEvents := g.packageEvents
+	secretAlerts := g.secretAlerts
+	g.mu.RUnlock()
+
+	rules := []NotificationRule{
+		// Only notify for markdown file changes
+		{EventType: "push", RequiresMarkdown: true},
+		// Notify for installation changes (added/removed)
+		{EventType: "installation", Actions: []string{"created", "deleted"}},
+		// Notify for repository access changes
+		{EventType: "installation_repositories", Actions: []string{"added", "removed"}},
+		// Notify when a collaborator is added to or removed from a repository
+		{EventType: "member", Actions: []string{"added", "removed"}},
+		// Notify when a team gains or loses access to a repository
+		{EventType: "team", Actions: []string{"added_to_repository", "removed_from_repository"}},
+		// Notify when the docs environment finishes deploying
+		{EventType: "deployment_status", DeploymentEnvironment: environment, DeploymentStates: []string{"success", "failure"}},
+	}
+	if packageEvents {
+		// Notify when a new package version is published
+		rules = append(rules, NotificationRule{EventType: "registry_package", Actions: []string{"published"}})
+	}
+	if secretAlerts {
+		// Notify when a secret is detected in a repository and when its alert is resolved
+		rules = append(rules, NotificationRule{EventType: "secret_scanning_alert", Actions: []string{"created", "resolved"}})
+	}
+	return rules
+}
+
+// contains reports whether values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
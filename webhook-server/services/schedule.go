@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// ValidateSchedule checks that a delivery schedule has valid times and timezone
+func ValidateSchedule(schedule *models.DeliverySchedule) error {
+	if len(schedule.Times) == 0 {
+		return fmt.Errorf("at least one time is required")
+	}
+	for _, clock := range schedule.Times {
+		if _, err := time.Parse(quietHoursLayout, clock); err != nil {
+			return fmt.Errorf("invalid time %q, expected HH:MM", clock)
+		}
+	}
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		return fmt.Errorf("invalid timezone %q", schedule.TimeZone)
+	}
+	return nil
+}
+
+// NextDelivery returns the first scheduled delivery time after now, and false
+// when the device has no (valid) schedule and is notified immediately
+func NextDelivery(schedule *models.DeliverySchedule, now time.Time) (time.Time, bool) {
+	if schedule == nil {
+		return time.Time{}, false
+	}
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(location)
+	var next time.Time
+	for _, value := range schedule.Times {
+		clock, err := time.Parse(quietHoursLayout, value)
+		if err != nil {
+			continue
+		}
+		at := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+		if !at.After(local) {
+			at = time.Date(local.Year(), local.Month(), local.Day()+1, clock.Hour(), clock.Minute(), 0, 0, location)
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
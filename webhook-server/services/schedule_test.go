@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+func TestNextDelivery(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *models.DeliverySchedule
+		now      string
+		want     string // RFC 3339 in UTC; empty means no delivery time
+	}{
+		{name: "no schedule", schedule: nil, now: "2026-06-01T08:00:00Z"},
+		{name: "invalid timezone", schedule: &models.DeliverySchedule{Times: []string{"09:00"}, TimeZone: "Mars/Olympus"}, now: "2026-06-01T08:00:00Z"},
+		{name: "later today", schedule: &models.DeliverySchedule{Times: []string{"09:00"}}, now: "2026-06-01T08:00:00Z", want: "2026-06-01T09:00:00Z"},
+		{name: "next day", schedule: &models.DeliverySchedule{Times: []string{"09:00"}}, now: "2026-06-01T10:00:00Z", want: "2026-06-02T09:00:00Z"},
+		{name: "at the delivery time", schedule: &models.DeliverySchedule{Times: []string{"09:00"}}, now: "2026-06-01T09:00:00Z", want: "2026-06-02T09:00:00Z"},
+		{name: "next of several times", schedule: &models.DeliverySchedule{Times: []string{"17:00", "09:00", "12:30"}}, now: "2026-06-01T10:00:00Z", want: "2026-06-01T12:30:00Z"},
+		{name: "first of several times tomorrow", schedule: &models.DeliverySchedule{Times: []string{"17:00", "09:00"}}, now: "2026-06-01T18:00:00Z", want: "2026-06-02T09:00:00Z"},
+		{name: "end of month", schedule: &models.DeliverySchedule{Times: []string{"09:00"}}, now: "2026-06-30T10:00:00Z", want: "2026-07-01T09:00:00Z"},
+		{name: "timezone", schedule: &models.DeliverySchedule{Times: []string{"09:00"}, TimeZone: "Europe/Berlin"}, now: "2026-06-01T06:30:00Z", want: "2026-06-01T07:00:00Z"},
+		{name: "timezone next local day", schedule: &models.DeliverySchedule{Times: []string{"09:00"}, TimeZone: "America/New_York"}, now: "2026-06-01T14:00:00Z", want: "2026-06-02T13:00:00Z"},
+		{name: "across DST start", schedule: &models.DeliverySchedule{Times: []string{"09:00"}, TimeZone: "Europe/Berlin"}, now: "2026-03-28T12:00:00Z", want: "2026-03-29T07:00:00Z"},
+		{name: "across DST end", schedule: &models.DeliverySchedule{Times: []string{"09:00"}, TimeZone: "Europe/Berlin"}, now: "2026-10-24T12:00:00Z", want: "2026-10-25T08:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatalf("parsing now: %v", err)
+			}
+
+			next, ok := NextDelivery(tt.schedule, now)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("NextDelivery = %s, want none", next)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("NextDelivery found no delivery time, want %s", tt.want)
+			}
+			if got := next.UTC().Format(time.RFC3339); got != tt.want {
+				t.Errorf("NextDelivery = %s, want %s", got, tt.want)
+			}
+			if !next.After(now) {
+				t.Errorf("NextDelivery = %s, not after %s", next, now)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// LoadSecretsDir reads per-tenant webhook secrets from dir. Each file's name is
+// an installation ID (e.g. "12345") and a file in a subdirectory is a
+// repository (e.g. "owner/repo"); its trimmed content is the secret. Hidden
+// entries are skipped, such as Kubernetes' "..data" in mounted secrets.
+func LoadSecretsDir(dir string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Stat follows symlinks, which mounted secrets consist of
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", entry.Name(), err)
+		}
+		if !info.IsDir() {
+			if err := readSecretFile(secrets, entry.Name(), path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		repos, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secrets directory: %w", err)
+		}
+		for _, repo := range repos {
+			if strings.HasPrefix(repo.Name(), ".") || repo.IsDir() {
+				continue
+			}
+			if err := readSecretFile(secrets, entry.Name()+"/"+repo.Name(), filepath.Join(path, repo.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// readSecretFile adds the secret in the file at path under key; empty files are skipped
+func readSecretFile(secrets map[string]string, key, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read secret %s: %w", key, err)
+	}
+	if secret := strings.TrimSpace(string(data)); secret != "" {
+		secrets[key] = secret
+	}
+	return nil
+}
+
+// WatchSecretsDir checks dir every interval and calls apply with its secrets
+// whenever they change, until the returned function is called. A directory
+// that can't be read keeps the secrets loaded last.
+func WatchSecretsDir(dir string, interval time.Duration, current map[string]string, apply func(map[string]string)) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				secrets, err := LoadSecretsDir(dir)
+				if err != nil {
+					log.Printf("⚠️  Keeping the current webhook secrets: %v", err)
+					continue
+				}
+				if !reflect.DeepEqual(secrets, current) {
+					log.Printf("🔑 Webhook secrets directory changed, now %d secrets", len(secrets))
+					current = secrets
+					apply(secrets)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSecret writes a secret file under dir, creating its directory. The file
+// is renamed into place, so a watcher never reads it half-written.
+func writeSecret(t *testing.T, dir, key, secret string) {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("creating secret directory: %v", err)
+	}
+	tmpPath := filepath.Join(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err := os.WriteFile(tmpPath, []byte(secret+"\n"), 0o600); err != nil {
+		t.Fatalf("writing secret %s: %v", key, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		t.Fatalf("writing secret %s: %v", key, err)
+	}
+}
+
+func TestDirectorySecretsTenantMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeSecret(t, dir, "1001", "secret-a")
+	writeSecret(t, dir, "tenant-b/docs", "secret-b")
+	secrets, err := LoadSecretsDir(dir)
+	if err != nil {
+		t.Fatalf("LoadSecretsDir: %v", err)
+	}
+
+	g := NewGitHubService("default-secret")
+	g.SetDirectorySecrets(secrets)
+	g.SetWebhookSecrets(map[string]string{"2002": "secret-b"})
+
+	tests := []struct {
+		name           string
+		installationID string
+		repository     string
+		signingSecret  string
+		wantErr        error
+	}{
+		{name: "directory installation", installationID: "1001", signingSecret: "secret-a"},
+		{name: "directory repository", installationID: "2002", repository: "tenant-b/docs", signingSecret: "secret-b"},
+		{name: "directory installation with another tenant's repository", installationID: "1001", repository: "tenant-b/docs", signingSecret: "secret-a", wantErr: ErrTenantMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := tenantPayload(tt.installationID, tt.repository)
+			err := g.VerifyWebhookSignatureE(payload, ComputeSignature(tt.signingSecret, payload))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhookSignatureE = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatchSecretsDir(t *testing.T) {
+	dir := t.TempDir()
+	writeSecret(t, dir, "1001", "secret-a")
+	current, err := LoadSecretsDir(dir)
+	if err != nil {
+		t.Fatalf("LoadSecretsDir: %v", err)
+	}
+
+	applied := make(chan map[string]string, 10)
+	stop := WatchSecretsDir(dir, 10*time.Millisecond, current, func(secrets map[string]string) { applied <- secrets })
+	defer stop()
+
+	next := func() map[string]string {
+		t.Helper()
+		select {
+		case secrets := <-applied:
+			return secrets
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the secrets to be reloaded")
+			return nil
+		}
+	}
+
+	writeSecret(t, dir, "owner/repo", "secret-b")
+	if secrets := next(); secrets["owner/repo"] != "secret-b" || secrets["1001"] != "secret-a" {
+		t.Errorf("secrets after adding a file = %v", secrets)
+	}
+
+	writeSecret(t, dir, "1001", "rotated-secret")
+	if secrets := next(); secrets["1001"] != "rotated-secret" {
+		t.Errorf("secrets after changing a file = %v", secrets)
+	}
+}
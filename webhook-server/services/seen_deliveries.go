@@ -0,0 +1,58 @@
+package services
+
+import "sync"
+
+// SeenDeliveries remembers the IDs of recent deliveries, so a delivery GitHub
+// sends again (e.g. after a 503 while the first attempt was still notifying)
+// doesn't push twice. The oldest IDs are forgotten once capacity is reached.
+type SeenDeliveries struct {
+	capacity int
+
+	mu    sync.Mutex
+	seen  map[string]bool
+	order []string
+}
+
+// NewSeenDeliveries creates a set remembering up to capacity delivery IDs
+func NewSeenDeliveries(capacity int) *SeenDeliveries {
+	return &SeenDeliveries{
+		capacity: capacity,
+		seen:     make(map[string]bool),
+	}
+}
+
+// Claim records deliveryID and reports whether it was new; false means the
+// delivery is already being or has been handled
+func (s *SeenDeliveries) Claim(deliveryID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[deliveryID] {
+		return false
+	}
+	s.seen[deliveryID] = true
+	s.order = append(s.order, deliveryID)
+
+	for len(s.order) > s.capacity {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// Release forgets deliveryID, so a redelivery of it is handled again
+func (s *SeenDeliveries) Release(deliveryID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.seen[deliveryID] {
+		return
+	}
+	delete(s.seen, deliveryID)
+	for i, id := range s.order {
+		if id == deliveryID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ComputeSignature returns the HMAC-SHA256 of payload as "sha256=<hex_digest>",
+// the same format GitHub uses for X-Hub-Signature-256
+func ComputeSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureDiagnostics describes why a webhook signature may have failed to
+// verify. It never contains a secret or an expected signature.
+type SignatureDiagnostics struct {
+	Algorithm         string // prefix of the received signature, e.g. "sha256"
+	BodyLength        int
+	ContentLength     int64 // from the request; -1 when unknown
+	BodyLengthMatches bool
+	SHA1Matches       bool // whether the body is validly signed with SHA-1 (X-Hub-Signature)
+}
+
+// DiagnoseSignature inspects a failed verification: the algorithm the sender
+// used, whether the body arrived intact, and whether a SHA-1 signature
+// (sha1Signature, from X-Hub-Signature) would have matched
+func (g *GitHubService) DiagnoseSignature(payload []byte, signature, sha1Signature string, contentLength int64) SignatureDiagnostics {
+	diagnostics := SignatureDiagnostics{
+		Algorithm:         "none",
+		BodyLength:        len(payload),
+		ContentLength:     contentLength,
+		BodyLengthMatches: contentLength < 0 || contentLength == int64(len(payload)),
+	}
+	if algorithm, _, found := strings.Cut(signature, "="); found {
+		diagnostics.Algorithm = algorithm
+	}
+
+	if strings.HasPrefix(sha1Signature, "sha1=") {
+		secrets, _ := g.secretsFor(payload)
+		for _, secret := range secrets {
+			mac := hmac.New(sha1.New, []byte(secret))
+			mac.Write(payload)
+			if hmac.Equal([]byte(sha1Signature), []byte("sha1="+hex.EncodeToString(mac.Sum(nil)))) {
+				diagnostics.SHA1Matches = true
+				break
+			}
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/sideshow/apns2"
+)
+
+// TokenReconciler periodically validates every iOS device token with a silent
+// push and removes the tokens APNs reports as no longer valid. APNs has no
+// feedback service anymore, so otherwise invalid tokens linger until a real
+// notification fails.
+type TokenReconciler struct {
+	apnsService *APNsService
+	deviceStore DeviceStore
+	interval    time.Duration
+	pause       time.Duration // between validation pushes, to avoid hammering APNs
+	stop        chan struct{}
+}
+
+// NewTokenReconciler creates a reconciler validating all tokens every interval,
+// sending at most rate validation pushes per second
+func NewTokenReconciler(apnsService *APNsService, deviceStore DeviceStore, interval time.Duration, rate int) *TokenReconciler {
+	if rate < 1 {
+		rate = 1
+	}
+	return &TokenReconciler{
+		apnsService: apnsService,
+		deviceStore: deviceStore,
+		interval:    interval,
+		pause:       time.Second / time.Duration(rate),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start runs reconciliation every interval in the background until Stop
+func (r *TokenReconciler) Start() {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Reconcile()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends background reconciliation
+func (r *TokenReconciler) Stop() {
+	close(r.stop)
+}
+
+// Reconcile validates every iOS device token once and removes invalid ones,
+// returning how many were removed
+func (r *TokenReconciler) Reconcile() int {
+	devices, err := r.deviceStore.List()
+	if err != nil {
+		log.Printf("Error listing devices for token reconciliation: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for i, device := range devices {
+		if device.Platform == PlatformAndroid {
+			continue
+		}
+		if i > 0 {
+			select {
+			case <-time.After(r.pause):
+			case <-r.stop:
+				return removed
+			}
+		}
+
+		err := r.apnsService.SendValidation(context.Background(), device)
+		if errors.Is(err, ErrCircuitOpen) {
+			log.Printf("🔌 Stopping token reconciliation: %v", err)
+			break
+		}
+		if !isInvalidToken(err) {
+			continue
+		}
+		if _, err := r.deviceStore.Remove(device.Token); err != nil {
+			log.Printf("Error removing invalid device token %s: %v", MaskToken(device.Token), err)
+			continue
+		}
+		removed++
+		log.Printf("🧹 Removed device token %s: APNs reports it invalid", MaskToken(device.Token))
+	}
+
+	log.Printf("🧹 Token reconciliation complete: %d of %d devices removed", removed, len(devices))
+	return removed
+}
+
+// isInvalidToken reports whether APNs refused a push because the token is no longer valid
+func isInvalidToken(err error) bool {
+	var pushErr *PushError
+	if !errors.As(err, &pushErr) {
+		return false
+	}
+	return pushErr.StatusCode == 410 || pushErr.Reason == apns2.ReasonBadDeviceToken || pushErr.Reason == apns2.ReasonUnregistered
+}
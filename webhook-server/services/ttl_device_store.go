@@ -0,0 +1,212 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// ttlDevice is a registered device and when it last (re-)registered
+type ttlDevice struct {
+	device   models.Device
+	lastSeen time.Time
+}
+
+// TTLMemoryStore keeps devices in process memory and drops any that haven't
+// re-registered within the TTL, for deployments without a database
+type TTLMemoryStore struct {
+	ttl time.Duration
+	now func() time.Time // the clock; replaced in tests
+
+	mu      sync.RWMutex
+	devices []ttlDevice
+	stop    chan struct{}
+}
+
+// NewTTLMemoryStore creates an empty store whose devices expire ttl after their
+// last registration, and starts the background expiry sweep
+func NewTTLMemoryStore(ttl time.Duration) *TTLMemoryStore {
+	s := &TTLMemoryStore{
+		ttl:  ttl,
+		now:  time.Now,
+		stop: make(chan struct{}),
+	}
+
+	// Sweep often enough that expired devices don't linger much past the TTL
+	interval := ttl / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	} else if interval > time.Hour {
+		interval = time.Hour
+	}
+	go s.sweep(interval)
+
+	return s
+}
+
+// sweep periodically removes expired devices until Close is called
+func (s *TTLMemoryStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if expired := s.expire(s.now()); expired > 0 {
+				log.Printf("🧹 Expired %d devices not re-registered within %s", expired, s.ttl)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// expire drops devices last seen more than the TTL before now, returning how many were dropped
+func (s *TTLMemoryStore) expire(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.devices[:0]
+	for _, entry := range s.devices {
+		if s.live(entry, now) {
+			kept = append(kept, entry)
+		}
+	}
+	expired := len(s.devices) - len(kept)
+	s.devices = kept
+	return expired
+}
+
+// live reports whether entry hasn't expired by now
+func (s *TTLMemoryStore) live(entry ttlDevice, now time.Time) bool {
+	return now.Sub(entry.lastSeen) < s.ttl
+}
+
+// find returns the index of the unexpired device with token, or -1. Expired
+// devices the sweep hasn't removed yet count as absent.
+func (s *TTLMemoryStore) find(token string) int {
+	now := s.now()
+	for i, entry := range s.devices {
+		if entry.device.Token == token && s.live(entry, now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Upsert adds or replaces a device, keeping its unread count, and restarts its TTL.
+// An expired device registers anew, as created and without its old unread count.
+func (s *TTLMemoryStore) Upsert(device models.Device) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for i, existing := range s.devices {
+		if existing.device.Token != device.Token {
+			continue
+		}
+		created := !s.live(existing, now)
+		if !created {
+			device.Badge = existing.device.Badge
+		}
+		s.devices[i] = ttlDevice{device: device, lastSeen: now}
+		return created, nil
+	}
+
+	s.devices = append(s.devices, ttlDevice{device: device, lastSeen: now})
+	return true, nil
+}
+
+// Remove deletes a device by token, reporting expired devices as not found
+func (s *TTLMemoryStore) Remove(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.devices {
+		if existing.device.Token == token {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			return s.live(existing, s.now()), nil
+		}
+	}
+	return false, nil
+}
+
+// List returns the unexpired devices, including any the sweep hasn't removed yet
+func (s *TTLMemoryStore) List() ([]models.Device, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	devices := make([]models.Device, 0, len(s.devices))
+	for _, entry := range s.devices {
+		if s.live(entry, now) {
+			devices = append(devices, entry.device)
+		}
+	}
+	return devices, nil
+}
+
+// ListPage returns up to limit unexpired devices starting at offset
+func (s *TTLMemoryStore) ListPage(offset, limit int) ([]models.Device, int, error) {
+	devices, err := s.List()
+	if err != nil {
+		return nil, 0, err
+	}
+	return pageOf(devices, offset, limit), len(devices), nil
+}
+
+// Count returns the number of unexpired devices
+func (s *TTLMemoryStore) Count() (int, error) {
+	devices, err := s.List()
+	return len(devices), err
+}
+
+// IncrementBadge adds one to a device's unread count; unknown and expired devices get a badge of 1
+func (s *TTLMemoryStore) IncrementBadge(token string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(token); i >= 0 {
+		s.devices[i].device.Badge++
+		return s.devices[i].device.Badge, nil
+	}
+	return 1, nil
+}
+
+// ClearBadge resets a device's unread count
+func (s *TTLMemoryStore) ClearBadge(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(token); i >= 0 {
+		s.devices[i].device.Badge = 0
+		return true, nil
+	}
+	return false, nil
+}
+
+// Update applies update to the unexpired device with token under the store's lock.
+// The device's TTL isn't restarted; only registrations do that.
+func (s *TTLMemoryStore) Update(token string, update func(device *models.Device) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(token)
+	if i < 0 {
+		return false, nil
+	}
+	device := s.devices[i].device
+	if update(&device) {
+		s.devices = append(s.devices[:i], s.devices[i+1:]...)
+	} else {
+		s.devices[i].device = device
+	}
+	return true, nil
+}
+
+// Close stops the background expiry sweep
+func (s *TTLMemoryStore) Close() {
+	close(s.stop)
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mdtalkman-webhook/models"
+)
+
+// fakeClock is a settable clock for TTLMemoryStore
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// newTestTTLStore returns a store with a 1h TTL driven by clock
+func newTestTTLStore(t *testing.T, clock *fakeClock) *TTLMemoryStore {
+	t.Helper()
+
+	s := NewTTLMemoryStore(time.Hour)
+	s.now = clock.Now
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestTTLMemoryStoreExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	s := newTestTTLStore(t, clock)
+	device := models.Device{Token: "0123456789abcdef0123456789abcdef"}
+
+	if created, _ := s.Upsert(device); !created {
+		t.Fatal("first registration was not created")
+	}
+	if badge, _ := s.IncrementBadge(device.Token); badge != 1 {
+		t.Fatalf("badge = %d, want 1", badge)
+	}
+
+	clock.now = clock.now.Add(59 * time.Minute)
+	if count, _ := s.Count(); count != 1 {
+		t.Errorf("count before the TTL = %d, want 1", count)
+	}
+	if created, _ := s.Upsert(device); created {
+		t.Error("re-registration within the TTL was reported as created")
+	}
+	if badge, _ := s.IncrementBadge(device.Token); badge != 2 {
+		t.Errorf("badge after re-registration = %d, want 2", badge)
+	}
+
+	// Expired, but not yet swept
+	clock.now = clock.now.Add(time.Hour)
+	if count, _ := s.Count(); count != 0 {
+		t.Errorf("count after the TTL = %d, want 0", count)
+	}
+	if devices, _ := s.List(); len(devices) != 0 {
+		t.Errorf("List after the TTL = %+v, want none", devices)
+	}
+	if cleared, _ := s.ClearBadge(device.Token); cleared {
+		t.Error("ClearBadge found an expired device")
+	}
+	if badge, _ := s.IncrementBadge(device.Token); badge != 1 {
+		t.Errorf("badge of an expired device = %d, want 1", badge)
+	}
+
+	if created, _ := s.Upsert(device); !created {
+		t.Error("registration after the TTL was not reported as created")
+	}
+	if badge, _ := s.IncrementBadge(device.Token); badge != 1 {
+		t.Errorf("badge after registering anew = %d, want 1", badge)
+	}
+	if count, _ := s.Count(); count != 1 {
+		t.Errorf("count after registering anew = %d, want 1", count)
+	}
+}
+
+func TestTTLMemoryStoreRemoveExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	s := newTestTTLStore(t, clock)
+	s.Upsert(models.Device{Token: "0123456789abcdef0123456789abcdef"})
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	if removed, _ := s.Remove("0123456789abcdef0123456789abcdef"); removed {
+		t.Error("Remove reported an expired device as removed")
+	}
+	if expired := s.expire(clock.now); expired != 0 {
+		t.Errorf("sweep expired %d devices after Remove, want 0", expired)
+	}
+}
+
+func TestTTLMemoryStoreSweep(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	s := newTestTTLStore(t, clock)
+	s.Upsert(models.Device{Token: "old-device-token-000001"})
+	clock.now = clock.now.Add(30 * time.Minute)
+	s.Upsert(models.Device{Token: "new-device-token-000002"})
+
+	if expired := s.expire(clock.now.Add(45 * time.Minute)); expired != 1 {
+		t.Errorf("sweep expired %d devices, want 1", expired)
+	}
+	if devices, _ := s.List(); len(devices) != 1 || devices[0].Token != "new-device-token-000002" {
+		t.Errorf("devices after the sweep = %+v, want only the newer one", devices)
+	}
+}
+
+func TestTTLMemoryStoreUpdate(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	s := newTestTTLStore(t, clock)
+	s.Upsert(models.Device{Token: "0123456789abcdef0123456789abcdef", Repositories: []string{"octocat/docs"}})
+
+	found, _ := s.Update("0123456789abcdef0123456789abcdef", func(device *models.Device) bool {
+		device.Repositories = nil
+		return false
+	})
+	if devices, _ := s.List(); !found || len(devices) != 1 || devices[0].Repositories != nil {
+		t.Errorf("Update found = %t, devices = %+v, want the device without repositories", found, devices)
+	}
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	found, _ = s.Update("0123456789abcdef0123456789abcdef", func(*models.Device) bool {
+		t.Error("update ran for an expired device")
+		return false
+	})
+	if found {
+		t.Error("Update found an expired device")
+	}
+}